@@ -0,0 +1,148 @@
+// Package apiversion tags the requests of the versioned routes with their api
+// version, in the request context, the spans and the metrics, and marks the
+// deprecated versions with the Deprecation, Sunset and Link headers.
+package apiversion
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openzipkin/zipkin-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Key is the attribute, and the zipkin tag, holding the api version.
+const Key = attribute.Key("api.version")
+
+var duration metric.Float64Histogram
+
+func init() {
+	var err error
+	duration, err = otel.Meter("microservice-meter").Float64Histogram("http.server.request.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of the http requests, by api version, route and status."),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+}
+
+// Version is a version of the api.
+type Version struct {
+	Name string // e.g. "v1"
+	// Deprecated is when the version was deprecated, zero if it is not.
+	Deprecated time.Time
+	// Sunset is when the version stops being served, zero if not scheduled.
+	Sunset time.Time
+}
+
+// Deprecate returns a copy of v deprecated since deprecated and removed at sunset.
+func (v Version) Deprecate(deprecated, sunset time.Time) Version {
+	v.Deprecated, v.Sunset = deprecated, sunset
+	return v
+}
+
+// IsDeprecated reports whether v is deprecated.
+func (v Version) IsDeprecated() bool {
+	return !v.Deprecated.IsZero()
+}
+
+type ctxKey struct{}
+
+// FromContext returns the api version of the request of ctx, or "" if it has none.
+func FromContext(ctx context.Context) string {
+	v, _ := ctx.Value(ctxKey{}).(string)
+	return v
+}
+
+// Attributes returns the span attributes of the api version of the request of ctx.
+func Attributes(ctx context.Context) []attribute.KeyValue {
+	v := FromContext(ctx)
+	if v == "" {
+		return nil
+	}
+	return []attribute.KeyValue{Key.String(v)}
+}
+
+// Handle returns h serving route in the version v.
+//
+// The version is put in the request context and tagged in the zipkin span of the
+// request, and the duration of the request is recorded with the version, route and
+// status. If v is deprecated, the response has the Deprecation (RFC 9745) and Sunset
+// (RFC 8594) headers, and, if successor is not empty, a Link to it. The wildcards of
+// successor, e.g. {id} in /v2/alerts/{id}, are replaced by the path values of the request.
+func (v Version) Handle(route, successor string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx := context.WithValue(r.Context(), ctxKey{}, v.Name)
+		if span := zipkin.SpanFromContext(ctx); span != nil {
+			span.Tag(string(Key), v.Name)
+		}
+		if v.IsDeprecated() {
+			w.Header().Set("Deprecation", "@"+strconv.FormatInt(v.Deprecated.Unix(), 10))
+			if !v.Sunset.IsZero() {
+				w.Header().Set("Sunset", v.Sunset.UTC().Format(http.TimeFormat))
+			}
+			if successor != "" {
+				w.Header().Add("Link", "<"+expand(successor, r)+`>; rel="successor-version"`)
+			}
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h(sw, r.WithContext(ctx))
+
+		duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+			Key.String(v.Name),
+			attribute.Bool("api.deprecated", v.IsDeprecated()),
+			attribute.String("http.route", route),
+			attribute.Int("http.response.status_code", sw.status),
+		))
+	}
+}
+
+// expand returns the route pattern with its wildcards, {name} or {name...}, replaced by
+// the path values of r.
+func expand(pattern string, r *http.Request) string {
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			name, rest := strings.CutSuffix(strings.Trim(segment, "{}"), "...")
+			if rest {
+				segments[i] = r.PathValue(name)
+			} else {
+				segments[i] = url.PathEscape(r.PathValue(name))
+			}
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// statusWriter records the status written to the ResponseWriter.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = status, true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the wrapped ResponseWriter, for http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,132 @@
+package apiversion
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestVersion_Handle(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	deprecated := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2027, 4, 30, 0, 0, 0, 0, time.UTC)
+	v1 := Version{Name: "v1"}.Deprecate(deprecated, sunset)
+	v2 := Version{Name: "v2"}
+
+	var gotVersion string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		gotVersion = FromContext(r.Context())
+		w.WriteHeader(http.StatusTeapot)
+	}
+
+	tests := []struct {
+		name           string
+		version        Version
+		route          string
+		successor      string
+		target         string
+		wantDeprecated bool
+		wantHeaders    map[string]string
+	}{
+		{
+			name:           "deprecated",
+			version:        v1,
+			successor:      "/v2/weather",
+			wantDeprecated: true,
+			wantHeaders: map[string]string{
+				"Deprecation": "@1792368000",
+				"Sunset":      "Fri, 30 Apr 2027 00:00:00 GMT",
+				"Link":        `</v2/weather>; rel="successor-version"`,
+			},
+		},
+		{
+			name:           "deprecated with wildcards",
+			version:        v1,
+			route:          "/alerts/{id}",
+			successor:      "/v2/alerts/{id}",
+			target:         "/alerts/a%2Fb",
+			wantDeprecated: true,
+			wantHeaders: map[string]string{
+				"Deprecation": "@1792368000",
+				"Link":        `</v2/alerts/a%2Fb>; rel="successor-version"`,
+			},
+		},
+		{
+			name:        "current",
+			version:     v2,
+			wantHeaders: map[string]string{"Deprecation": "", "Sunset": "", "Link": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route, target := cmp.Or(tt.route, "/weather"), cmp.Or(tt.target, "/weather")
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET "+route, tt.version.Handle(route, tt.successor, handler))
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+
+			if gotVersion != tt.version.Name {
+				t.Errorf("FromContext() = %q, want %q", gotVersion, tt.version.Name)
+			}
+			if w.Code != http.StatusTeapot {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusTeapot)
+			}
+			for name, want := range tt.wantHeaders {
+				if got := w.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+
+			var rm metricdata.ResourceMetrics
+			if err := reader.Collect(context.Background(), &rm); err != nil {
+				t.Fatal(err)
+			}
+			want := attribute.NewSet(
+				Key.String(tt.version.Name),
+				attribute.Bool("api.deprecated", tt.wantDeprecated),
+				attribute.String("http.route", route),
+				attribute.Int("http.response.status_code", http.StatusTeapot),
+			)
+			if !recorded(rm, want) {
+				t.Errorf("no http.server.request.duration recorded with %v", want.Encoded(attribute.DefaultEncoder()))
+			}
+		})
+	}
+}
+
+func recorded(rm metricdata.ResourceMetrics, attrs attribute.Set) bool {
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			h, ok := m.Data.(metricdata.Histogram[float64])
+			if m.Name != "http.server.request.duration" || !ok {
+				continue
+			}
+			for _, dp := range h.DataPoints {
+				if dp.Attributes.Equals(&attrs) && dp.Count == 1 {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func TestAttributes(t *testing.T) {
+	if got := Attributes(context.Background()); got != nil {
+		t.Errorf("Attributes() = %v, want nil", got)
+	}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "v2")
+	if got := Attributes(ctx); len(got) != 1 || got[0] != Key.String("v2") {
+		t.Errorf("Attributes() = %v, want [api.version=v2]", got)
+	}
+}
@@ -0,0 +1,127 @@
+// Package endpoint discovers the address a service advertises in its zipkin spans.
+package endpoint
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"time"
+
+	"github.com/openzipkin/zipkin-go/model"
+)
+
+// lookupTimeout bounds every name resolution done while discovering the
+// advertised address, so a missing DNS server never blocks the startup.
+const lookupTimeout = 2 * time.Second
+
+// these are variables so tests can replace them.
+var (
+	interfaceAddrs = localInterfaceAddrs
+	lookupIP       = resolve
+	hostname       = os.Hostname
+)
+
+// Local returns the zipkin endpoint that describes this service.
+//
+// The address is chosen, in order, from:
+//   - the ADVERTISED_IP environment variable, a literal IPv4 or IPv6 address;
+//   - the ADVERTISED_HOST environment variable, resolved to an address;
+//   - the first non loopback address of an interface that is up;
+//   - the addresses of the machine hostname;
+//   - the loopback address.
+//
+// None of the steps needs external network, and Local never fails.
+func Local(serviceName string, port uint16) *model.Endpoint {
+	ip, source := AdvertisedIP()
+	slog.Info("advertised endpoint", "service", serviceName, "ip", ip.String(), "port", port, "source", source)
+
+	e := &model.Endpoint{ServiceName: serviceName, Port: port}
+	if ip4 := ip.To4(); ip4 != nil {
+		e.IPv4 = ip4
+	} else {
+		e.IPv6 = ip
+	}
+	return e
+}
+
+// AdvertisedIP returns the address this service should advertise, and the
+// name of the source it came from. See Local for the lookup order.
+func AdvertisedIP() (net.IP, string) {
+	if v := os.Getenv("ADVERTISED_IP"); v != "" {
+		if ip := net.ParseIP(v); ip != nil {
+			return ip, "ADVERTISED_IP"
+		}
+		slog.Warn("advertised endpoint", "error", "ADVERTISED_IP is not an ip address", "value", v)
+	}
+	if v := os.Getenv("ADVERTISED_HOST"); v != "" {
+		if ip := firstIP(lookupIP(v)); ip != nil {
+			return ip, "ADVERTISED_HOST"
+		}
+		slog.Warn("advertised endpoint", "error", "can not resolve ADVERTISED_HOST", "value", v)
+	}
+	if ip := firstIP(interfaceAddrs()); ip != nil {
+		return ip, "interface"
+	}
+	if h, err := hostname(); err == nil {
+		if ip := firstIP(lookupIP(h)); ip != nil {
+			return ip, "hostname"
+		}
+	}
+	return net.IPv4(127, 0, 0, 1), "loopback"
+}
+
+// firstIP returns the first global unicast IPv4 address in ips, or the
+// first global unicast IPv6 address if there is no IPv4 one.
+func firstIP(ips []net.IP) net.IP {
+	var ip6 net.IP
+	for _, ip := range ips {
+		if !ip.IsGlobalUnicast() {
+			continue
+		}
+		if ip.To4() != nil {
+			return ip
+		}
+		if ip6 == nil {
+			ip6 = ip
+		}
+	}
+	return ip6
+}
+
+func localInterfaceAddrs() []net.IP {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var ips []net.IP
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok {
+				ips = append(ips, ipnet.IP)
+			}
+		}
+	}
+	return ips
+}
+
+func resolve(host string) []net.IP {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, a := range addrs {
+		ips = append(ips, a.IP)
+	}
+	return ips
+}
@@ -0,0 +1,103 @@
+package endpoint
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+)
+
+func TestAdvertisedIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		ip         string
+		host       string
+		ifaces     []net.IP
+		hostname   string
+		lookup     map[string][]net.IP
+		want       string
+		wantSource string
+	}{
+		{
+			name:       "advertised ip",
+			ip:         "10.0.0.7",
+			host:       "servicob",
+			ifaces:     []net.IP{net.ParseIP("172.17.0.2")},
+			want:       "10.0.0.7",
+			wantSource: "ADVERTISED_IP",
+		},
+		{
+			name:       "advertised ipv6",
+			ip:         "2001:db8::7",
+			want:       "2001:db8::7",
+			wantSource: "ADVERTISED_IP",
+		},
+		{
+			name:       "invalid advertised ip falls back to host",
+			ip:         "not-an-ip",
+			host:       "servicob",
+			lookup:     map[string][]net.IP{"servicob": {net.ParseIP("172.18.0.3")}},
+			want:       "172.18.0.3",
+			wantSource: "ADVERTISED_HOST",
+		},
+		{
+			name:       "unresolvable host falls back to interfaces",
+			host:       "servicob",
+			ifaces:     []net.IP{net.ParseIP("fe80::1"), net.ParseIP("2001:db8::2"), net.ParseIP("172.17.0.2")},
+			want:       "172.17.0.2",
+			wantSource: "interface",
+		},
+		{
+			name:       "ipv6 only interface",
+			ifaces:     []net.IP{net.ParseIP("fe80::1"), net.ParseIP("2001:db8::2")},
+			want:       "2001:db8::2",
+			wantSource: "interface",
+		},
+		{
+			name:       "hostname",
+			hostname:   "box",
+			lookup:     map[string][]net.IP{"box": {net.ParseIP("127.0.1.1"), net.ParseIP("192.168.0.10")}},
+			want:       "192.168.0.10",
+			wantSource: "hostname",
+		},
+		{
+			name:       "offline",
+			want:       "127.0.0.1",
+			wantSource: "loopback",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ADVERTISED_IP", tt.ip)
+			t.Setenv("ADVERTISED_HOST", tt.host)
+			interfaceAddrs = func() []net.IP { return tt.ifaces }
+			lookupIP = func(host string) []net.IP { return tt.lookup[host] }
+			hostname = func() (string, error) {
+				if tt.hostname == "" {
+					return "", errors.New("no hostname")
+				}
+				return tt.hostname, nil
+			}
+			t.Cleanup(func() { interfaceAddrs, lookupIP, hostname = localInterfaceAddrs, resolve, os.Hostname })
+
+			got, gotSource := AdvertisedIP()
+			if got.String() != tt.want {
+				t.Errorf("AdvertisedIP() got = %v, want %v", got, tt.want)
+			}
+			if gotSource != tt.wantSource {
+				t.Errorf("AdvertisedIP() gotSource = %v, want %v", gotSource, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestLocal(t *testing.T) {
+	t.Setenv("ADVERTISED_IP", "2001:db8::7")
+	got := Local("servicob", 8081)
+	if got.ServiceName != "servicob" || got.Port != 8081 {
+		t.Errorf("Local() = %+v", got)
+	}
+	if got.IPv4 != nil || !got.IPv6.Equal(net.ParseIP("2001:db8::7")) {
+		t.Errorf("Local() IPv4 = %v, IPv6 = %v, want IPv6 2001:db8::7", got.IPv4, got.IPv6)
+	}
+}
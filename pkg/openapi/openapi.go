@@ -0,0 +1,166 @@
+// Package openapi serves the OpenAPI specification of a service, with a Swagger UI
+// page, and validates the requests, and optionally the responses, against it. The
+// services embed their specification and pass it to Load and SpecHandler.
+package openapi
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// Load parses and validates the json specification spec.
+func Load(spec []byte) (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(spec)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// SpecHandler returns the handler serving the json specification spec.
+func SpecHandler(spec []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(spec)
+	}
+}
+
+const swaggerUI = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Swagger UI</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.onload = () => {
+      window.ui = SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui" });
+    };
+  </script>
+</body>
+</html>
+`
+
+// DocsHandler serves the Swagger UI page of the specification.
+func DocsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, swaggerUI)
+}
+
+// ErrorHandler writes the response of a request rejected by the validation, with status
+// 400 or 422. err is an openapi3filter error; Violations describes it.
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, status int, err error)
+
+// Validator validates the requests against a specification.
+type Validator struct {
+	router  routers.Router
+	onError ErrorHandler
+	// ValidateResponses makes the json responses be validated too. The mismatches are
+	// logged, the responses are sent unchanged. Responses are buffered while enabled,
+	// so it is meant for development; streams, event streams and websockets, are not.
+	ValidateResponses bool
+}
+
+// NewValidator returns a Validator of the requests against doc, which writes the
+// rejected requests with onError.
+func NewValidator(doc *openapi3.T, onError ErrorHandler) (*Validator, error) {
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+	return &Validator{router: router, onError: onError}, nil
+}
+
+// Handler returns next with the requests of the routes of the specification validated
+// before they reach it. Requests of unknown routes or methods are passed unchanged, so
+// next answers them as usual.
+//
+// Malformed requests, such as a body that is not json, are rejected with 400; requests
+// breaking the schemas, such as a missing parameter or a cep with letters, with 422;
+// bodies over the limit of an http.MaxBytesReader, with 413.
+func (v *Validator) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, pathParams, err := v.router.FindRoute(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    &openapi3filter.Options{MultiError: true, AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+		}
+		if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			v.onError(w, r, Status(err), err)
+			return
+		}
+		if !v.ValidateResponses || isStream(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &recorder{header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		v.validateResponse(r.Context(), input, rec)
+		for name, values := range rec.header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes())
+	})
+}
+
+// isStream reports whether r asks for a stream, whose response can not be buffered.
+func isStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream") ||
+		strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+func (v *Validator) validateResponse(ctx context.Context, input *openapi3filter.RequestValidationInput, rec *recorder) {
+	options := &openapi3filter.Options{MultiError: true}
+	if !strings.HasPrefix(rec.header.Get("Content-Type"), "application/json") {
+		options.ExcludeResponseBody = true
+	}
+	err := openapi3filter.ValidateResponse(ctx, &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 rec.status,
+		Header:                 rec.header,
+		Body:                   io.NopCloser(bytes.NewReader(rec.body.Bytes())),
+		Options:                options,
+	})
+	if err != nil {
+		slog.Warn("response does not match the openapi spec",
+			"method", input.Request.Method, "path", input.Route.Path, "status", rec.status, "error", err)
+	}
+}
+
+// recorder buffers a response.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header { return r.header }
+
+func (r *recorder) WriteHeader(status int) { r.status = status }
+
+func (r *recorder) Write(b []byte) (int, error) { return r.body.Write(b) }
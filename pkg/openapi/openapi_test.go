@@ -0,0 +1,159 @@
+package openapi
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/validation"
+)
+
+// testSpec has a route with query parameters and one with a json body, with nested
+// properties, to check the statuses and the field paths of the violations.
+const testSpec = `{
+  "openapi": "3.0.3",
+  "info": {"title": "test", "version": "1"},
+  "paths": {
+    "/items": {
+      "get": {
+        "parameters": [
+          {"name": "cep", "in": "query", "required": true, "schema": {"type": "string", "pattern": "^[0-9]{8}$", "x-error-message": "invalid zipcode"}},
+          {"name": "page", "in": "query", "schema": {"type": "integer", "minimum": 1}},
+          {"name": "units", "in": "query", "schema": {"type": "string", "enum": ["metric", "imperial"]}}
+        ],
+        "responses": {"204": {"description": "ok"}}
+      },
+      "post": {
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {
+            "type": "object",
+            "required": ["cep"],
+            "properties": {
+              "cep": {"type": "string"},
+              "address": {"type": "object", "properties": {"street": {"type": "string", "minLength": 3}}},
+              "tags": {"type": "array", "maxItems": 1, "items": {"type": "string"}}
+            }
+          }}}
+        },
+        "responses": {"204": {"description": "ok"}}
+      }
+    }
+  }
+}`
+
+func TestValidator_Handler(t *testing.T) {
+	doc, err := Load([]byte(testSpec))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	var rejected error
+	v, err := NewValidator(doc, func(w http.ResponseWriter, r *http.Request, status int, err error) {
+		rejected = err
+		w.WriteHeader(status)
+	})
+	if err != nil {
+		t.Fatalf("NewValidator() error = %v", err)
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		maxBytes       int64
+		wantStatus     int
+		wantViolations validation.Errors
+	}{
+		{name: "valid query", method: http.MethodGet, target: "/items?cep=01001000&page=2", wantStatus: http.StatusNoContent},
+		{name: "valid body", method: http.MethodPost, target: "/items", body: `{"cep":"01001000","address":{"street":"Praça da Sé"}}`, wantStatus: http.StatusNoContent},
+		{name: "unknown route", method: http.MethodGet, target: "/other?cep=x", wantStatus: http.StatusNoContent},
+		{name: "unknown method", method: http.MethodDelete, target: "/items", wantStatus: http.StatusNoContent},
+		{
+			name:       "missing parameter",
+			method:     http.MethodGet,
+			target:     "/items",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantViolations: validation.Errors{
+				{Field: "cep", Rule: validation.RuleRequired, Message: "cep is required"},
+			},
+		},
+		{
+			name:       "parameter violations",
+			method:     http.MethodGet,
+			target:     "/items?cep=0100100A&page=0&units=si",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantViolations: validation.Errors{
+				{Field: "cep", Rule: validation.RuleFormat, Value: "0100100A", Message: "invalid zipcode"},
+				{Field: "page", Rule: validation.RuleRange, Value: "0", Message: "number must be at least 1"},
+				{Field: "units", Rule: validation.RuleOneOf, Value: "si", Message: "value is not one of the allowed values [\"metric\",\"imperial\"]"},
+			},
+		},
+		{
+			name:       "parameter not a number",
+			method:     http.MethodGet,
+			target:     "/items?cep=01001000&page=abc",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantViolations: validation.Errors{
+				{Field: "page", Rule: validation.RuleFormat, Value: "abc", Message: "page is an invalid integer"},
+			},
+		},
+		{
+			name:       "body violations",
+			method:     http.MethodPost,
+			target:     "/items",
+			body:       `{"address":{"street":"Sé"},"tags":["a","b"]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantViolations: validation.Errors{
+				{Field: "address.street", Rule: validation.RuleMinLength, Value: "Sé", Message: "minimum string length is 3"},
+				{Field: "tags", Rule: validation.RuleRange, Value: "[a b]", Message: "maximum number of items is 1"},
+				{Field: "cep", Rule: validation.RuleRequired, Message: `property "cep" is missing`},
+			},
+		},
+		{name: "body not json", method: http.MethodPost, target: "/items", body: `{"cep":`, wantStatus: http.StatusBadRequest},
+		{name: "missing body", method: http.MethodPost, target: "/items", wantStatus: http.StatusUnprocessableEntity, wantViolations: validation.Errors{
+			{Field: "body", Rule: validation.RuleRequired, Message: "body is required"},
+		}},
+		{name: "body too large", method: http.MethodPost, target: "/items", body: `{"cep":"01001000"}`, maxBytes: 4, wantStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rejected = nil
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.body != "" {
+				r.Header.Set("Content-Type", "application/json")
+			}
+			w := httptest.NewRecorder()
+			if tt.maxBytes > 0 {
+				r.Body = http.MaxBytesReader(w, r.Body, tt.maxBytes)
+			}
+			v.Handler(next).ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (error %v)", w.Code, tt.wantStatus, rejected)
+			}
+			if rejected == nil {
+				return
+			}
+			if got := Status(rejected); got != tt.wantStatus {
+				t.Errorf("Status() = %d, want %d", got, tt.wantStatus)
+			}
+			if got := Violations(rejected); !reflect.DeepEqual(got, tt.wantViolations) {
+				t.Errorf("Violations() = %#v, want %#v", got, tt.wantViolations)
+			}
+		})
+	}
+}
+
+func TestStatus_NotRequestError(t *testing.T) {
+	err := errors.New("not an openapi3filter error")
+	if got := Status(err); got != http.StatusBadRequest {
+		t.Errorf("Status() = %d, want %d", got, http.StatusBadRequest)
+	}
+	if got := Violations(err); got != nil {
+		t.Errorf("Violations() = %#v, want none", got)
+	}
+}
@@ -0,0 +1,143 @@
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/validation"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+// ErrorMessageExtension is the schema extension holding the message of the violations
+// of the schema, e.g. "invalid zipcode", instead of the generic one of the validator.
+const ErrorMessageExtension = "x-error-message"
+
+// Status returns the status of the validation error err: 422 when parameters or the
+// body break their schemas or are missing, 413 when the body is larger than the limit
+// of http.MaxBytesReader, 400 when the request is malformed, e.g. its body is not json.
+func Status(err error) int {
+	var maxBytes *http.MaxBytesError
+	if errors.As(err, &maxBytes) {
+		return http.StatusRequestEntityTooLarge
+	}
+	leaves := requestErrors(err)
+	if len(leaves) == 0 {
+		return http.StatusBadRequest
+	}
+	for _, rerr := range leaves {
+		if !isViolation(rerr) {
+			return http.StatusBadRequest
+		}
+	}
+	return http.StatusUnprocessableEntity
+}
+
+// Violations returns the violations of the schemas described by the validation error err.
+// Errors of malformed requests have no violation.
+func Violations(err error) validation.Errors {
+	var errs validation.Errors
+	for _, rerr := range requestErrors(err) {
+		if isViolation(rerr) {
+			errs = append(errs, violation(rerr))
+		}
+	}
+	return errs
+}
+
+// requestErrors flattens err into one RequestError per problem found.
+func requestErrors(err error) []*openapi3filter.RequestError {
+	var merr openapi3.MultiError
+	if errors.As(err, &merr) && !isRequestError(err) {
+		var leaves []*openapi3filter.RequestError
+		for _, e := range merr {
+			leaves = append(leaves, requestErrors(e)...)
+		}
+		return leaves
+	}
+	var rerr *openapi3filter.RequestError
+	if !errors.As(err, &rerr) {
+		return nil
+	}
+	var inner openapi3.MultiError
+	if !errors.As(rerr.Err, &inner) {
+		return []*openapi3filter.RequestError{rerr}
+	}
+	var leaves []*openapi3filter.RequestError
+	for _, e := range inner {
+		leaf := *rerr
+		leaf.Err = e
+		leaves = append(leaves, &leaf)
+	}
+	return leaves
+}
+
+func isRequestError(err error) bool {
+	_, ok := err.(*openapi3filter.RequestError)
+	return ok
+}
+
+// isViolation reports whether rerr is a broken schema or a missing value, rather than a
+// malformed request.
+func isViolation(rerr *openapi3filter.RequestError) bool {
+	var serr *openapi3.SchemaError
+	var perr *openapi3filter.ParseError
+	switch {
+	case errors.As(rerr.Err, &serr),
+		errors.Is(rerr.Err, openapi3filter.ErrInvalidRequired),
+		errors.Is(rerr.Err, openapi3filter.ErrInvalidEmptyValue):
+		return true
+	case errors.As(rerr.Err, &perr):
+		// a parameter which is not a number, e.g. page=abc; a body which is not json is malformed
+		return rerr.Parameter != nil
+	}
+	return false
+}
+
+func violation(rerr *openapi3filter.RequestError) validation.Violation {
+	field := "body"
+	if rerr.Parameter != nil {
+		field = rerr.Parameter.Name
+	}
+
+	var serr *openapi3.SchemaError
+	var perr *openapi3filter.ParseError
+	switch {
+	case errors.As(rerr.Err, &serr):
+		if pointer := serr.JSONPointer(); len(pointer) > 0 {
+			field = strings.Join(pointer, ".")
+		}
+		v := validation.Violation{Field: field, Rule: rule(serr.SchemaField), Message: serr.Reason}
+		if v.Rule != validation.RuleRequired {
+			v.Value = fmt.Sprint(serr.Value)
+		}
+		if msg, ok := serr.Schema.Extensions[ErrorMessageExtension].(string); ok {
+			v.Message = msg
+		}
+		return v
+	case errors.As(rerr.Err, &perr):
+		return validation.Violation{Field: field, Rule: validation.RuleFormat, Value: fmt.Sprint(perr.Value), Message: field + " is " + perr.Reason}
+	case errors.Is(rerr.Err, openapi3filter.ErrInvalidRequired):
+		return validation.Violation{Field: field, Rule: validation.RuleRequired, Message: field + " is required"}
+	default:
+		return validation.Violation{Field: field, Rule: validation.RuleFormat, Message: rerr.Reason}
+	}
+}
+
+// rule returns the validation rule of the schema keyword schemaField.
+func rule(schemaField string) string {
+	switch schemaField {
+	case "required":
+		return validation.RuleRequired
+	case "enum":
+		return validation.RuleOneOf
+	case "minLength":
+		return validation.RuleMinLength
+	case "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum", "maxLength", "minItems", "maxItems":
+		return validation.RuleRange
+	default:
+		return validation.RuleFormat
+	}
+}
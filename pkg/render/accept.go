@@ -0,0 +1,90 @@
+package render
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// mediaRange is one of the media ranges of an Accept header, e.g. "text/*;q=0.5".
+type mediaRange struct {
+	typ     string // e.g. "text", or "*"
+	subtype string // e.g. "csv", or "*"
+	q       float64
+	order   int
+}
+
+// specificity is 0 for "*/*", 1 for "type/*" and 2 for "type/subtype".
+func (m mediaRange) specificity() int {
+	switch {
+	case m.typ == "*":
+		return 0
+	case m.subtype == "*":
+		return 1
+	default:
+		return 2
+	}
+}
+
+// matches reports whether the media type mediaType, without parameters, is in the range.
+func (m mediaRange) matches(mediaType string) bool {
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+	return (m.typ == "*" || m.typ == typ) && (m.subtype == "*" || m.subtype == subtype)
+}
+
+// parseAccept parses an Accept header into its media ranges, most preferred first:
+// by quality, then by specificity, then by their order in the header. Ranges with
+// q=0, which are refused, are kept last. An empty header is "*/*".
+func parseAccept(accept string) []mediaRange {
+	if strings.TrimSpace(accept) == "" {
+		return []mediaRange{{typ: "*", subtype: "*", q: 1}}
+	}
+	var ranges []mediaRange
+	for i, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(params[0])), "/")
+		if !ok || typ == "" || subtype == "" || (typ == "*" && subtype != "*") {
+			continue
+		}
+		m := mediaRange{typ: typ, subtype: subtype, q: 1, order: i}
+		for _, p := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if strings.ToLower(strings.TrimSpace(name)) != "q" {
+				continue
+			}
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && q >= 0 && q <= 1 {
+				m.q = q
+			}
+		}
+		ranges = append(ranges, m)
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		if ranges[i].specificity() != ranges[j].specificity() {
+			return ranges[i].specificity() > ranges[j].specificity()
+		}
+		return ranges[i].order < ranges[j].order
+	})
+	return ranges
+}
+
+// refused reports whether mediaType is explicitly refused, with q=0, by the most specific
+// range that matches it.
+func refused(ranges []mediaRange, mediaType string) bool {
+	best := -1
+	q := 1.0
+	for _, m := range ranges {
+		if m.matches(mediaType) && m.specificity() > best {
+			best, q = m.specificity(), m.q
+		}
+	}
+	return best >= 0 && q == 0
+}
+
+// baseType returns the media type without its parameters, in lower case.
+func baseType(mediaType string) string {
+	t, _, _ := strings.Cut(mediaType, ";")
+	return strings.ToLower(strings.TrimSpace(t))
+}
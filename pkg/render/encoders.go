@@ -0,0 +1,88 @@
+package render
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+)
+
+// CSVMarshaler is implemented by the values that can be encoded as csv.
+type CSVMarshaler interface {
+	// MarshalCSV returns the csv records, the first one being the header.
+	MarshalCSV() [][]string
+}
+
+// ProtoMarshaler is implemented by the values that can be encoded as protobuf.
+type ProtoMarshaler interface {
+	// MarshalProto returns the protobuf wire encoding of the value.
+	MarshalProto() ([]byte, error)
+}
+
+// JSON encodes any value with encoding/json.
+type JSON struct{}
+
+func (JSON) Supports(v any) bool { return true }
+
+func (JSON) Encode(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// XML encodes any value with encoding/xml.
+type XML struct{}
+
+func (XML) Supports(v any) bool { return true }
+
+func (XML) Encode(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(v)
+}
+
+// CSV encodes the values implementing CSVMarshaler.
+type CSV struct{}
+
+func (CSV) Supports(v any) bool {
+	_, ok := v.(CSVMarshaler)
+	return ok
+}
+
+func (CSV) Encode(w io.Writer, v any) error {
+	m, ok := v.(CSVMarshaler)
+	if !ok {
+		return errors.New("render: value does not implement CSVMarshaler")
+	}
+	return csv.NewWriter(w).WriteAll(m.MarshalCSV())
+}
+
+// Protobuf encodes the values implementing ProtoMarshaler.
+type Protobuf struct{}
+
+func (Protobuf) Supports(v any) bool {
+	_, ok := v.(ProtoMarshaler)
+	return ok
+}
+
+func (Protobuf) Encode(w io.Writer, v any) error {
+	m, ok := v.(ProtoMarshaler)
+	if !ok {
+		return errors.New("render: value does not implement ProtoMarshaler")
+	}
+	b, err := m.MarshalProto()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func init() {
+	Register("application/json", JSON{})
+	Register("application/xml; charset=utf-8", XML{})
+	Register("text/xml; charset=utf-8", XML{})
+	Register("text/csv; charset=utf-8", CSV{})
+	Register("application/x-protobuf", Protobuf{})
+	Register("application/protobuf", Protobuf{})
+}
@@ -0,0 +1,125 @@
+// Package render writes the http responses in the media type negotiated with the
+// client through the Accept header. Encoders are registered per media type; JSON,
+// XML, CSV and protobuf are registered by default.
+package render
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+)
+
+var ErrNotAcceptable = errors.New("not acceptable")
+
+// Encoder encodes values in a media type.
+type Encoder interface {
+	// Supports reports whether the encoder can encode v.
+	Supports(v any) bool
+	// Encode writes v to w.
+	Encode(w io.Writer, v any) error
+}
+
+type registration struct {
+	contentType string // the Content-Type header, with parameters
+	mediaType   string // the media type without parameters
+	encoder     Encoder
+}
+
+var (
+	mu       sync.RWMutex
+	registry []registration
+)
+
+// Register registers the encoder for contentType, e.g. "text/csv; charset=utf-8".
+//
+// The encoders are tried in the order they were registered, so the first one is
+// chosen when the client accepts anything. Registering a media type again replaces
+// its encoder.
+func Register(contentType string, e Encoder) {
+	mu.Lock()
+	defer mu.Unlock()
+	r := registration{contentType: contentType, mediaType: baseType(contentType), encoder: e}
+	for i := range registry {
+		if registry[i].mediaType == r.mediaType {
+			registry[i] = r
+			return
+		}
+	}
+	registry = append(registry, r)
+}
+
+// MediaTypes returns the registered media types, in registration order.
+func MediaTypes() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	types := make([]string, len(registry))
+	for i, r := range registry {
+		types[i] = r.mediaType
+	}
+	return types
+}
+
+// Negotiate chooses, following the Accept header accept, the encoder for v.
+// It returns the Content-Type to send and the encoder, or ErrNotAcceptable if no
+// registered encoder of an accepted media type supports v.
+func Negotiate(accept string, v any) (string, Encoder, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	ranges := parseAccept(accept)
+	for _, m := range ranges {
+		if m.q == 0 {
+			break
+		}
+		for _, r := range registry {
+			if m.matches(r.mediaType) && !refused(ranges, r.mediaType) && r.encoder.Supports(v) {
+				return r.contentType, r.encoder, nil
+			}
+		}
+	}
+	return "", nil, ErrNotAcceptable
+}
+
+// NegotiateType returns the registered media type preferred by the Accept header
+// accept, whatever the value to encode, or ErrNotAcceptable if none is accepted. It
+// is for the responses relayed from a service registering the same encoders.
+func NegotiateType(accept string) (string, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	ranges := parseAccept(accept)
+	for _, m := range ranges {
+		if m.q == 0 {
+			break
+		}
+		for _, r := range registry {
+			if m.matches(r.mediaType) && !refused(ranges, r.mediaType) {
+				return r.mediaType, nil
+			}
+		}
+	}
+	return "", ErrNotAcceptable
+}
+
+// Write writes v with status, encoded in the media type negotiated from the Accept
+// header of r. The headers are set before the status is written.
+//
+// It returns ErrNotAcceptable, without writing anything, if v can not be encoded in
+// any accepted media type, and the encoding error, without writing anything, if
+// encoding fails.
+func Write(w http.ResponseWriter, r *http.Request, status int, v any) error {
+	contentType, encoder, err := Negotiate(r.Header.Get("Accept"), v)
+	w.Header().Add("Vary", "Accept")
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	if err := encoder.Encode(&body, v); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, err = w.Write(body.Bytes())
+	return err
+}
@@ -0,0 +1,127 @@
+package render
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type plain struct {
+	Name string `json:"name"`
+}
+
+type table struct{ plain }
+
+func (t table) MarshalCSV() [][]string { return [][]string{{"name"}, {t.Name}} }
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name    string
+		accept  string
+		v       any
+		want    string
+		wantErr error
+	}{
+		{name: "empty accept", accept: "", v: plain{}, want: "application/json"},
+		{name: "any", accept: "*/*", v: plain{}, want: "application/json"},
+		{name: "json", accept: "application/json", v: plain{}, want: "application/json"},
+		{name: "xml", accept: "application/xml", v: plain{}, want: "application/xml; charset=utf-8"},
+		{name: "text xml", accept: "text/xml", v: plain{}, want: "text/xml; charset=utf-8"},
+		{name: "case insensitive", accept: "Application/XML", v: plain{}, want: "application/xml; charset=utf-8"},
+		{name: "csv", accept: "text/csv", v: table{}, want: "text/csv; charset=utf-8"},
+		{name: "csv not supported", accept: "text/csv", v: plain{}, wantErr: ErrNotAcceptable},
+		{name: "csv not supported falls back", accept: "text/csv, application/json;q=0.5", v: plain{}, want: "application/json"},
+		{name: "quality", accept: "application/json;q=0.5, application/xml", v: plain{}, want: "application/xml; charset=utf-8"},
+		{name: "specificity", accept: "text/*, text/csv", v: table{}, want: "text/csv; charset=utf-8"},
+		{name: "type wildcard", accept: "text/*", v: plain{}, want: "text/xml; charset=utf-8"},
+		{name: "refused", accept: "*/*, application/json;q=0", v: plain{}, want: "application/xml; charset=utf-8"},
+		{name: "only refused", accept: "application/json;q=0", v: plain{}, wantErr: ErrNotAcceptable},
+		{name: "unsupported", accept: "image/png", v: plain{}, wantErr: ErrNotAcceptable},
+		{name: "protobuf not supported", accept: "application/x-protobuf", v: plain{}, wantErr: ErrNotAcceptable},
+		{name: "malformed ranges are ignored", accept: "json, application/xml", v: plain{}, want: "application/xml; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := Negotiate(tt.accept, tt.v)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Negotiate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Negotiate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name            string
+		accept          string
+		wantErr         error
+		wantContentType string
+		wantBody        string
+	}{
+		{name: "json", accept: "application/json", wantContentType: "application/json", wantBody: "{\"name\":\"Montes Claros\"}\n"},
+		{name: "csv", accept: "text/csv", wantContentType: "text/csv; charset=utf-8", wantBody: "name\nMontes Claros\n"},
+		{name: "not acceptable", accept: "image/png", wantErr: ErrNotAcceptable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			err := Write(w, r, http.StatusCreated, table{plain{Name: "Montes Claros"}})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Write() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := w.Header().Get("Vary"); got != "Accept" {
+				t.Errorf("Vary = %q, want Accept", got)
+			}
+			if tt.wantErr != nil {
+				if w.Body.Len() != 0 {
+					t.Errorf("Write() wrote %q, want nothing", w.Body.String())
+				}
+				return
+			}
+			if w.Code != http.StatusCreated {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusCreated)
+			}
+			if got := w.Result().Header.Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestNegotiateType(t *testing.T) {
+	tests := []struct {
+		name    string
+		accept  string
+		want    string
+		wantErr error
+	}{
+		{name: "empty accept", accept: "", want: "application/json"},
+		{name: "any", accept: "*/*", want: "application/json"},
+		{name: "csv", accept: "text/csv", want: "text/csv"},
+		{name: "protobuf", accept: "application/x-protobuf", want: "application/x-protobuf"},
+		{name: "quality", accept: "application/json;q=0.9, application/xml", want: "application/xml"},
+		{name: "specificity", accept: "text/*, text/csv", want: "text/csv"},
+		{name: "refused", accept: "*/*, application/json;q=0", want: "application/xml"},
+		{name: "unsupported", accept: "image/png", wantErr: ErrNotAcceptable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NegotiateType(tt.accept)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NegotiateType() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NegotiateType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package shared
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidCep = errors.New("invalid zipcode")
+
+// Cep is a Brazilian postal code.
+//
+// A Cep is always valid: the only ways to build one are ParseCep, MustParseCep and
+// the unmarshal and Scan methods, all of which reject invalid input. The zero
+// value is the empty Cep, reported by IsZero.
+type Cep struct {
+	digits string
+}
+
+// ParseCep parses s as a cep.
+//
+// s must have exactly 8 digits, which may be separated by dashes, dots and spaces,
+// so "39408078", "39408-078", "39.408-078" and " 39408 078 " are all the same cep.
+//
+// It returns ErrInvalidCep if s is not a valid cep.
+func ParseCep(s string) (Cep, error) {
+	var digits [8]byte
+	n := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= '0' && c <= '9':
+			if n == len(digits) {
+				return Cep{}, ErrInvalidCep
+			}
+			digits[n] = c
+			n++
+		case c == '-' || c == '.' || c == ' ':
+		default:
+			return Cep{}, ErrInvalidCep
+		}
+	}
+	if n != len(digits) {
+		return Cep{}, ErrInvalidCep
+	}
+	return Cep{digits: string(digits[:])}, nil
+}
+
+// MustParseCep is like ParseCep but panics if s is not a valid cep.
+func MustParseCep(s string) Cep {
+	c, err := ParseCep(s)
+	if err != nil {
+		panic(fmt.Sprintf("shared: invalid cep %q", s))
+	}
+	return c
+}
+
+// IsZero reports whether c is the empty Cep.
+func (c Cep) IsZero() bool {
+	return c.digits == ""
+}
+
+// Canonical returns the canonical form of the cep, its 8 digits, e.g. "39408078".
+// It is the form the external apis and the storage use.
+func (c Cep) Canonical() string {
+	return c.digits
+}
+
+// String returns the formatted form of the cep, e.g. "39408-078".
+func (c Cep) String() string {
+	if c.IsZero() {
+		return ""
+	}
+	return c.digits[:5] + "-" + c.digits[5:]
+}
+
+// MarshalText returns the formatted form of the cep.
+func (c Cep) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText parses text with ParseCep.
+func (c *Cep) UnmarshalText(text []byte) error {
+	p, err := ParseCep(string(text))
+	if err != nil {
+		return err
+	}
+	*c = p
+	return nil
+}
+
+// Scan implements sql.Scanner. A NULL value scans to the empty Cep.
+func (c *Cep) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*c = Cep{}
+		return nil
+	case string:
+		return c.UnmarshalText([]byte(v))
+	case []byte:
+		return c.UnmarshalText(v)
+	default:
+		return fmt.Errorf("shared: can not scan %T into Cep", src)
+	}
+}
+
+// Value implements driver.Valuer. The cep is stored in its canonical form,
+// and the empty Cep is stored as NULL.
+func (c Cep) Value() (driver.Value, error) {
+	if c.IsZero() {
+		return nil, nil
+	}
+	return c.digits, nil
+}
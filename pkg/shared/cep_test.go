@@ -0,0 +1,189 @@
+package shared
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseCep(t *testing.T) {
+	tests := []struct {
+		name          string
+		cep           string
+		wantCanonical string
+		wantString    string
+		wantErr       bool
+	}{
+		{
+			name:          "parse digits",
+			cep:           "39408078",
+			wantCanonical: "39408078",
+			wantString:    "39408-078",
+		},
+		{
+			name:          "parse with dash",
+			cep:           "39408-078",
+			wantCanonical: "39408078",
+			wantString:    "39408-078",
+		},
+		{
+			name:          "parse with dot and dash",
+			cep:           "39.408-078",
+			wantCanonical: "39408078",
+			wantString:    "39408-078",
+		},
+		{
+			name:          "parse with spaces",
+			cep:           " 39408 078 ",
+			wantCanonical: "39408078",
+			wantString:    "39408-078",
+		},
+		{
+			name:    "parse short",
+			cep:     "3940807",
+			wantErr: true,
+		},
+		{
+			name:    "parse long",
+			cep:     "394080781",
+			wantErr: true,
+		},
+		{
+			name:    "parse letter",
+			cep:     "3940807A",
+			wantErr: true,
+		},
+		{
+			name:    "parse non ascii digit",
+			cep:     "3940807٨",
+			wantErr: true,
+		},
+		{
+			name:    "parse empty",
+			cep:     "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCep(tt.cep)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseCep() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidCep) || !got.IsZero() {
+					t.Errorf("ParseCep() = %v, %v, want zero Cep and ErrInvalidCep", got, err)
+				}
+				return
+			}
+			if got.Canonical() != tt.wantCanonical {
+				t.Errorf("ParseCep().Canonical() = %v, want %v", got.Canonical(), tt.wantCanonical)
+			}
+			if got.String() != tt.wantString {
+				t.Errorf("ParseCep().String() = %v, want %v", got.String(), tt.wantString)
+			}
+		})
+	}
+}
+
+func TestCep_JSON(t *testing.T) {
+	type request struct {
+		Cep Cep `json:"cep"`
+	}
+	var r request
+	if err := json.Unmarshal([]byte(`{"cep": "39.408-078"}`), &r); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	j, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if string(j) != `{"cep":"39408-078"}` {
+		t.Errorf("json.Marshal() = %s", j)
+	}
+	for _, invalid := range []string{`{"cep": "3940807"}`, `{"cep": 39408078}`} {
+		if err := json.Unmarshal([]byte(invalid), &r); err == nil {
+			t.Errorf("json.Unmarshal(%s) error = nil, want error", invalid)
+		}
+	}
+}
+
+func TestCep_ScanValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     any
+		want    Cep
+		wantErr bool
+	}{
+		{name: "scan string", src: "39408078", want: MustParseCep("39408078")},
+		{name: "scan bytes", src: []byte("39408-078"), want: MustParseCep("39408078")},
+		{name: "scan null", src: nil, want: Cep{}},
+		{name: "scan invalid", src: "394", wantErr: true},
+		{name: "scan int", src: int64(39408078), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Cep
+			err := got.Scan(tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Cep.Scan() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Cep.Scan() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	v, err := MustParseCep("39408-078").Value()
+	if err != nil || v != "39408078" {
+		t.Errorf("Cep.Value() = %v, %v, want 39408078", v, err)
+	}
+	v, err = Cep{}.Value()
+	if err != nil || v != nil {
+		t.Errorf("Cep{}.Value() = %v, %v, want nil", v, err)
+	}
+}
+
+func FuzzParseCep(f *testing.F) {
+	for _, seed := range []string{"39408078", "39408-078", "39.408-078", " 39408 078 ", "3940807", "3940807A", "", "--------", "٣٩٤٠٨٠٧٨"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		c, err := ParseCep(s)
+		if err != nil {
+			if !c.IsZero() {
+				t.Fatalf("ParseCep(%q) returned %v with error %v", s, c, err)
+			}
+			return
+		}
+		if !cepWithoutDashRegex.MatchString(c.Canonical()) {
+			t.Fatalf("ParseCep(%q).Canonical() = %q, want 8 digits", s, c.Canonical())
+		}
+		if !cepWithDashRegex.MatchString(c.String()) {
+			t.Fatalf("ParseCep(%q).String() = %q, want 00000-000", s, c.String())
+		}
+		for _, form := range []string{c.Canonical(), c.String()} {
+			if again, err := ParseCep(form); err != nil || again != c {
+				t.Fatalf("ParseCep(%q) = %v, %v, want %v", form, again, err, c)
+			}
+		}
+		j, err := json.Marshal(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var back Cep
+		if err := json.Unmarshal(j, &back); err != nil || back != c {
+			t.Fatalf("json round trip of %v = %v, %v", c, back, err)
+		}
+		v, err := c.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var scanned Cep
+		if err := scanned.Scan(v); err != nil || scanned != c {
+			t.Fatalf("sql round trip of %v = %v, %v", c, scanned, err)
+		}
+	})
+}
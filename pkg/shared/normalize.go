@@ -0,0 +1,42 @@
+package shared
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeText returns the normalized form of a place name, used to compare states,
+// cities and neighborhoods, and to build cache keys.
+//
+// The text is decomposed (Unicode NFD) and stripped of its combining marks, so
+// "São Paulo" and "Sao Paulo" are the same; case folded, so "SAO PAULO" is too;
+// and its white space runs are collapsed to a single space and trimmed, so
+// " Sao   Paulo " is too.
+func NormalizeText(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), cases.Fold(), norm.NFC)
+	folded, _, err := transform.String(t, s)
+	if err != nil {
+		folded = strings.ToLower(s)
+	}
+	return strings.Join(strings.Fields(folded), " ")
+}
+
+// EqualText reports whether a and b are the same place name, comparing their NormalizeText forms.
+func EqualText(a, b string) bool {
+	return NormalizeText(a) == NormalizeText(b)
+}
+
+// CacheKey returns a cache key made of the normalized parts, so lookups that only
+// differ in accents, case or white space share the same entry.
+func CacheKey(parts ...string) string {
+	normalized := make([]string, len(parts))
+	for i, p := range parts {
+		normalized[i] = NormalizeText(p)
+	}
+	return strings.Join(normalized, "|")
+}
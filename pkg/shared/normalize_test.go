@@ -0,0 +1,96 @@
+package shared
+
+import (
+	"testing"
+)
+
+func TestNormalizeText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "accents", text: "São Paulo", want: "sao paulo"},
+		{name: "cedilla", text: "Açailândia", want: "acailandia"},
+		{name: "upper case", text: "GOIÂNIA", want: "goiania"},
+		{name: "white space", text: " \tMogi   das Cruzes\n", want: "mogi das cruzes"},
+		{name: "hyphen is kept", text: "Ji-Paraná", want: "ji-parana"},
+		{name: "decomposed input", text: "Sa\u0303o Lui\u0301s", want: "sao luis"},
+		{name: "empty", text: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeText(tt.text); got != tt.want {
+				t.Errorf("NormalizeText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEqualText_States(t *testing.T) {
+	// the names as they are usually typed, without accents and in upper case
+	plain := map[string]string{
+		"AC": "ACRE", "AL": "ALAGOAS", "AP": "AMAPA", "AM": "AMAZONAS", "BA": "BAHIA",
+		"CE": "CEARA", "DF": "DISTRITO FEDERAL", "ES": "ESPIRITO SANTO", "GO": "GOIAS",
+		"MA": "MARANHAO", "MT": "MATO GROSSO", "MS": "MATO GROSSO DO SUL", "MG": "MINAS GERAIS",
+		"PA": "PARA", "PB": "PARAIBA", "PR": "PARANA", "PE": "PERNAMBUCO", "PI": "PIAUI",
+		"RJ": "RIO DE JANEIRO", "RN": "RIO GRANDE DO NORTE", "RS": "RIO GRANDE DO SUL",
+		"RO": "RONDONIA", "RR": "RORAIMA", "SC": "SANTA CATARINA", "SP": "SAO PAULO",
+		"SE": "SERGIPE", "TO": "TOCANTINS",
+	}
+	if len(plain) != len(States) {
+		t.Fatalf("len(plain) = %v, want %v", len(plain), len(States))
+	}
+	for _, s := range States {
+		t.Run(s.UF, func(t *testing.T) {
+			if !EqualText(s.Name, plain[s.UF]) {
+				t.Errorf("EqualText(%q, %q) = false", s.Name, plain[s.UF])
+			}
+			if got, ok := StateByName(plain[s.UF]); !ok || got.UF != s.UF {
+				t.Errorf("StateByName(%q) = %v, %v, want %v", plain[s.UF], got.UF, ok, s.UF)
+			}
+			for _, other := range States {
+				if other.UF != s.UF && EqualText(s.Name, other.Name) {
+					t.Errorf("EqualText(%q, %q) = true", s.Name, other.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestEqualText_Municipalities(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want bool
+	}{
+		{a: "Montes Claros", b: "montes claros", want: true},
+		{a: "Florianópolis", b: "FLORIANOPOLIS", want: true},
+		{a: "São Luís", b: "Sao Luis", want: true},
+		{a: "Goiânia", b: "goiania", want: true},
+		{a: "Cuiabá", b: "CUIABA", want: true},
+		{a: "Maceió", b: "Maceio", want: true},
+		{a: "Vitória da Conquista", b: "vitoria  da conquista", want: true},
+		{a: "Itaquaquecetuba", b: "Itaquaquecetuba ", want: true},
+		{a: "Feira de Santana", b: "Feira  de\tSantana", want: true},
+		{a: "Paraí", b: "Pará", want: false},
+		{a: "Belém", b: "Belém do São Francisco", want: false},
+		{a: "São João del-Rei", b: "Sao Joao del Rei", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"|"+tt.b, func(t *testing.T) {
+			if got := EqualText(tt.a, tt.b); got != tt.want {
+				t.Errorf("EqualText(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	if got, want := CacheKey("MG", "Montes Claros"), CacheKey("mg", " MONTES  CLAROS "); got != want {
+		t.Errorf("CacheKey() = %q, want %q", got, want)
+	}
+	if got := CacheKey("SP", "São Paulo"); got != "sp|sao paulo" {
+		t.Errorf("CacheKey() = %q, want %q", got, "sp|sao paulo")
+	}
+}
@@ -1,22 +1,16 @@
+// Package shared holds the ceps, states and place names common to the services.
 package shared
 
 import (
 	"errors"
 	"regexp"
-
-	"golang.org/x/exp/slices"
 )
 
-var states_short = []string{"AC", "AL", "AP", "AM", "BA", "CE", "DF", "ES", "GO", "MA", "MT", "MS", "MG", "PA", "PB", "PR", "PE", "PI", "RJ", "RN", "RS", "RO", "RR", "SC", "SP", "SE", "TO"}
-
-var states_long = []string{"Acre", "Alagoas",
-	"Amapá", "Amazonas", "Bahia", "Ceará", "Distrito Federal",
-	"Espirito Santo", "Goiás", "Maranhão", "Mato Grosso", "Mato Grosso do Sul",
-	"Minas Gerais", "Paraí", "Pará", "Paraná", "Pernambuco", "Piaui", "Rio de Janeiro",
-	"Rio Grande do Norte", "Rio Grande do Sul", "Rondônia", "Roraima", "Santa Catarina",
-	"São Paulo", "Sergipe", "Tocantins"}
-
-var regioes = []string{"Sul", "Sudeste", "Centro-Oeste", "Norte", "Nordeste"}
+var (
+	cepRegex            = regexp.MustCompile(`^\d{5}-?\d{3}$`)
+	cepWithDashRegex    = regexp.MustCompile(`^\d{5}-\d{3}$`)
+	cepWithoutDashRegex = regexp.MustCompile(`^\d{8}$`)
+)
 
 // ValidateCep checks if the given cep is valid.
 //
@@ -25,7 +19,6 @@ var regioes = []string{"Sul", "Sudeste", "Centro-Oeste", "Norte", "Nordeste"}
 //
 // If the cep is valid, it returns true, nil. Otherwise, it returns false, error.
 func ValidateCep(cep string) (bool, error) {
-	var cepRegex = regexp.MustCompile(`^\d{5}-?\d{3}$`)
 	if !cepRegex.MatchString(cep) {
 		return false, errors.New("cep must have 8 digits, optionally with '-'")
 	}
@@ -39,8 +32,7 @@ func ValidateCep(cep string) (bool, error) {
 //
 // If the cep is valid, it returns true, nil. Otherwise, it returns false, error.
 func ValidateCepWithDash(cep string) (bool, error) {
-	var cepRegex = regexp.MustCompile(`^\d{5}-\d{3}$`)
-	if !cepRegex.MatchString(cep) {
+	if !cepWithDashRegex.MatchString(cep) {
 		return false, errors.New("cep must have 8 digits, optionally with '-'")
 	}
 	return true, nil
@@ -53,8 +45,7 @@ func ValidateCepWithDash(cep string) (bool, error) {
 //
 // If the cep is valid, it returns true, nil. Otherwise, it returns false, error.
 func ValidateCepWithoutDash(cep string) (bool, error) {
-	var cepRegex = regexp.MustCompile(`^\d{8}$`)
-	if !cepRegex.MatchString(cep) {
+	if !cepWithoutDashRegex.MatchString(cep) {
 		return false, errors.New("cep must have 8 digits, optionally with '-'")
 	}
 	return true, nil
@@ -65,9 +56,11 @@ func ValidateCepWithoutDash(cep string) (bool, error) {
 // A valid state abbreviation must be one of the recognized Brazilian state codes,
 // such as "AC" for Acre or "SP" for São Paulo.
 //
-// If the state abbreviation is valid, it returns true. Otherwise, it returns false.
+// The comparison ignores case. If the state abbreviation is valid, it returns true.
+// Otherwise, it returns false.
 func ValidateStateShort(state string) bool {
-	return slices.Contains(states_short, state)
+	_, ok := StateByUF(state)
+	return ok
 }
 
 // ValidateStateLong checks if the given state name is valid.
@@ -75,9 +68,11 @@ func ValidateStateShort(state string) bool {
 // A valid state name must be one of the recognized Brazilian state names,
 // such as "Acre" or "São Paulo".
 //
-// If the state name is valid, it returns true. Otherwise, it returns false.
+// The comparison ignores case and accents. If the state name is valid, it returns true.
+// Otherwise, it returns false.
 func ValidateStateLong(state string) bool {
-	return slices.Contains(states_long, state)
+	_, ok := StateByName(state)
+	return ok
 }
 
 // ValidateRegiao checks if the given region name is valid.
@@ -85,7 +80,9 @@ func ValidateStateLong(state string) bool {
 // A valid region name must be one of the recognized Brazilian region names,
 // such as "Sul" or "Nordeste".
 //
-// If the region name is valid, it returns true. Otherwise, it returns false.
+// The comparison ignores case and accents. If the region name is valid, it returns true.
+// Otherwise, it returns false.
 func ValidateRegiao(regiao string) bool {
-	return slices.Contains(regioes, regiao)
+	_, ok := ParseRegion(regiao)
+	return ok
 }
@@ -0,0 +1,120 @@
+package shared
+
+import (
+	"strings"
+)
+
+// Region is one of the five Brazilian regions.
+type Region string
+
+const (
+	Norte       Region = "Norte"
+	Nordeste    Region = "Nordeste"
+	CentroOeste Region = "Centro-Oeste"
+	Sudeste     Region = "Sudeste"
+	Sul         Region = "Sul"
+)
+
+// Regions lists the Brazilian regions.
+var Regions = []Region{Norte, Nordeste, CentroOeste, Sudeste, Sul}
+
+// State is a Brazilian state, or the Distrito Federal.
+type State struct {
+	UF       string // two letter abbreviation, e.g. "MG"
+	Name     string // e.g. "Minas Gerais"
+	IBGE     int    // two digit IBGE code, the prefix of the IBGE code of its municipalities
+	Region   Region
+	Capital  string
+	Timezone string // IANA time zone of the capital
+}
+
+// States lists the 26 Brazilian states and the Distrito Federal.
+var States = []State{
+	{UF: "AC", Name: "Acre", IBGE: 12, Region: Norte, Capital: "Rio Branco", Timezone: "America/Rio_Branco"},
+	{UF: "AL", Name: "Alagoas", IBGE: 27, Region: Nordeste, Capital: "Maceió", Timezone: "America/Maceio"},
+	{UF: "AP", Name: "Amapá", IBGE: 16, Region: Norte, Capital: "Macapá", Timezone: "America/Belem"},
+	{UF: "AM", Name: "Amazonas", IBGE: 13, Region: Norte, Capital: "Manaus", Timezone: "America/Manaus"},
+	{UF: "BA", Name: "Bahia", IBGE: 29, Region: Nordeste, Capital: "Salvador", Timezone: "America/Bahia"},
+	{UF: "CE", Name: "Ceará", IBGE: 23, Region: Nordeste, Capital: "Fortaleza", Timezone: "America/Fortaleza"},
+	{UF: "DF", Name: "Distrito Federal", IBGE: 53, Region: CentroOeste, Capital: "Brasília", Timezone: "America/Sao_Paulo"},
+	{UF: "ES", Name: "Espírito Santo", IBGE: 32, Region: Sudeste, Capital: "Vitória", Timezone: "America/Sao_Paulo"},
+	{UF: "GO", Name: "Goiás", IBGE: 52, Region: CentroOeste, Capital: "Goiânia", Timezone: "America/Sao_Paulo"},
+	{UF: "MA", Name: "Maranhão", IBGE: 21, Region: Nordeste, Capital: "São Luís", Timezone: "America/Fortaleza"},
+	{UF: "MT", Name: "Mato Grosso", IBGE: 51, Region: CentroOeste, Capital: "Cuiabá", Timezone: "America/Cuiaba"},
+	{UF: "MS", Name: "Mato Grosso do Sul", IBGE: 50, Region: CentroOeste, Capital: "Campo Grande", Timezone: "America/Campo_Grande"},
+	{UF: "MG", Name: "Minas Gerais", IBGE: 31, Region: Sudeste, Capital: "Belo Horizonte", Timezone: "America/Sao_Paulo"},
+	{UF: "PA", Name: "Pará", IBGE: 15, Region: Norte, Capital: "Belém", Timezone: "America/Belem"},
+	{UF: "PB", Name: "Paraíba", IBGE: 25, Region: Nordeste, Capital: "João Pessoa", Timezone: "America/Fortaleza"},
+	{UF: "PR", Name: "Paraná", IBGE: 41, Region: Sul, Capital: "Curitiba", Timezone: "America/Sao_Paulo"},
+	{UF: "PE", Name: "Pernambuco", IBGE: 26, Region: Nordeste, Capital: "Recife", Timezone: "America/Recife"},
+	{UF: "PI", Name: "Piauí", IBGE: 22, Region: Nordeste, Capital: "Teresina", Timezone: "America/Fortaleza"},
+	{UF: "RJ", Name: "Rio de Janeiro", IBGE: 33, Region: Sudeste, Capital: "Rio de Janeiro", Timezone: "America/Sao_Paulo"},
+	{UF: "RN", Name: "Rio Grande do Norte", IBGE: 24, Region: Nordeste, Capital: "Natal", Timezone: "America/Fortaleza"},
+	{UF: "RS", Name: "Rio Grande do Sul", IBGE: 43, Region: Sul, Capital: "Porto Alegre", Timezone: "America/Sao_Paulo"},
+	{UF: "RO", Name: "Rondônia", IBGE: 11, Region: Norte, Capital: "Porto Velho", Timezone: "America/Porto_Velho"},
+	{UF: "RR", Name: "Roraima", IBGE: 14, Region: Norte, Capital: "Boa Vista", Timezone: "America/Boa_Vista"},
+	{UF: "SC", Name: "Santa Catarina", IBGE: 42, Region: Sul, Capital: "Florianópolis", Timezone: "America/Sao_Paulo"},
+	{UF: "SP", Name: "São Paulo", IBGE: 35, Region: Sudeste, Capital: "São Paulo", Timezone: "America/Sao_Paulo"},
+	{UF: "SE", Name: "Sergipe", IBGE: 28, Region: Nordeste, Capital: "Aracaju", Timezone: "America/Maceio"},
+	{UF: "TO", Name: "Tocantins", IBGE: 17, Region: Norte, Capital: "Palmas", Timezone: "America/Araguaina"},
+}
+
+// StateByUF returns the state with the abbreviation uf, ignoring case and surrounding white space.
+func StateByUF(uf string) (State, bool) {
+	uf = strings.ToUpper(strings.TrimSpace(uf))
+	for _, s := range States {
+		if s.UF == uf {
+			return s, true
+		}
+	}
+	return State{}, false
+}
+
+// StateByName returns the state called name, compared with NormalizeText, so "Espírito Santo", "espirito santo" and "ESPIRITO SANTO" all match.
+func StateByName(name string) (State, bool) {
+	name = NormalizeText(name)
+	for _, s := range States {
+		if NormalizeText(s.Name) == name {
+			return s, true
+		}
+	}
+	return State{}, false
+}
+
+// StateByIBGE returns the state with the two digit IBGE code.
+func StateByIBGE(code int) (State, bool) {
+	for _, s := range States {
+		if s.IBGE == code {
+			return s, true
+		}
+	}
+	return State{}, false
+}
+
+// ParseRegion returns the region called name, compared with NormalizeText.
+func ParseRegion(name string) (Region, bool) {
+	name = NormalizeText(name)
+	for _, r := range Regions {
+		if NormalizeText(string(r)) == name {
+			return r, true
+		}
+	}
+	return "", false
+}
+
+// States returns the states of the region r.
+func (r Region) States() []State {
+	var states []State
+	for _, s := range States {
+		if s.Region == r {
+			states = append(states, s)
+		}
+	}
+	return states
+}
+
+// Contains reports whether the state with the abbreviation uf is in the region r.
+func (r Region) Contains(uf string) bool {
+	s, ok := StateByUF(uf)
+	return ok && s.Region == r
+}
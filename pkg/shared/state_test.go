@@ -0,0 +1,125 @@
+package shared
+
+import (
+	"testing"
+)
+
+func TestStates(t *testing.T) {
+	if len(States) != 27 {
+		t.Errorf("len(States) = %v, want 27", len(States))
+	}
+	ufs := map[string]bool{}
+	codes := map[int]bool{}
+	for _, s := range States {
+		if ufs[s.UF] || codes[s.IBGE] {
+			t.Errorf("duplicated state %v", s)
+		}
+		ufs[s.UF], codes[s.IBGE] = true, true
+		if s.Name == "" || s.Capital == "" || s.Timezone == "" {
+			t.Errorf("incomplete state %v", s)
+		}
+		if !s.Region.Contains(s.UF) {
+			t.Errorf("region %v does not contain %v", s.Region, s.UF)
+		}
+		if got, ok := StateByIBGE(s.IBGE); !ok || got != s {
+			t.Errorf("StateByIBGE(%v) = %v, %v", s.IBGE, got, ok)
+		}
+	}
+
+	want := map[Region]int{Norte: 7, Nordeste: 9, CentroOeste: 4, Sudeste: 4, Sul: 3}
+	for _, r := range Regions {
+		if got := len(r.States()); got != want[r] {
+			t.Errorf("len(%v.States()) = %v, want %v", r, got, want[r])
+		}
+	}
+}
+
+func TestStateByUF(t *testing.T) {
+	tests := []struct {
+		name   string
+		uf     string
+		want   string
+		wantOk bool
+	}{
+		{name: "upper case", uf: "MG", want: "Minas Gerais", wantOk: true},
+		{name: "lower case", uf: " es ", want: "Espírito Santo", wantOk: true},
+		{name: "not found", uf: "MM", wantOk: false},
+		{name: "empty", uf: "", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := StateByUF(tt.uf)
+			if ok != tt.wantOk || got.Name != tt.want {
+				t.Errorf("StateByUF() = %v, %v, want %v, %v", got.Name, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestStateByName(t *testing.T) {
+	tests := []struct {
+		name   string
+		state  string
+		want   string
+		wantOk bool
+	}{
+		{name: "exact", state: "Espírito Santo", want: "ES", wantOk: true},
+		{name: "without accents", state: "Espirito Santo", want: "ES", wantOk: true},
+		{name: "upper case", state: "PIAUÍ", want: "PI", wantOk: true},
+		{name: "lower case without accents", state: " sao paulo ", want: "SP", wantOk: true},
+		{name: "paraiba", state: "Paraíba", want: "PB", wantOk: true},
+		{name: "para is not parana", state: "Para", want: "PA", wantOk: true},
+		{name: "partial", state: "Paraí", wantOk: false},
+		{name: "not found", state: "Minas", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := StateByName(tt.state)
+			if ok != tt.wantOk || got.UF != tt.want {
+				t.Errorf("StateByName() = %v, %v, want %v, %v", got.UF, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestParseRegion(t *testing.T) {
+	tests := []struct {
+		name   string
+		region string
+		want   Region
+		wantOk bool
+	}{
+		{name: "exact", region: "Centro-Oeste", want: CentroOeste, wantOk: true},
+		{name: "lower case", region: "nordeste", want: Nordeste, wantOk: true},
+		{name: "not found", region: "Sudoeste", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseRegion(tt.region)
+			if ok != tt.wantOk || got != tt.want {
+				t.Errorf("ParseRegion() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestRegion_Contains(t *testing.T) {
+	tests := []struct {
+		name   string
+		region Region
+		uf     string
+		want   bool
+	}{
+		{name: "contains", region: Sudeste, uf: "MG", want: true},
+		{name: "contains lower case", region: CentroOeste, uf: "df", want: true},
+		{name: "other region", region: Sul, uf: "MG", want: false},
+		{name: "invalid uf", region: Sul, uf: "MM", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.region.Contains(tt.uf); got != tt.want {
+				t.Errorf("Region.Contains() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+// Package validation collects the violations of the validation rules.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Rules of the violations.
+const (
+	RuleRequired  = "required"   // the field must not be empty
+	RuleFormat    = "format"     // the field does not have the expected format
+	RuleOneOf     = "one_of"     // the field must be one of a known set of values
+	RuleMatch     = "match"      // the field is not consistent with another field
+	RuleMinLength = "min_length" // the field is too short
+	RuleRange     = "range"      // the field is out of the accepted range
+)
+
+// Violation is a validation rule broken by a field.
+type Violation struct {
+	Field   string `json:"field" xml:"field"`
+	Rule    string `json:"rule" xml:"rule"`
+	Value   string `json:"value" xml:"value"`
+	Message string `json:"message" xml:"message"`
+}
+
+// Error returns the field, the message and the offending value of the violation.
+func (v Violation) Error() string {
+	return fmt.Sprintf("%s: %s (%s, value %q)", v.Field, v.Message, v.Rule, v.Value)
+}
+
+// Is reports whether target is a Violation of the same field and rule. Empty fields and
+// rules of target match anything, so errors.Is(err, Violation{Field: "uf"}) reports
+// whether err has any violation of the uf field.
+func (v Violation) Is(target error) bool {
+	t, ok := target.(Violation)
+	if !ok {
+		return false
+	}
+	return (t.Field == "" || t.Field == v.Field) && (t.Rule == "" || t.Rule == v.Rule)
+}
+
+// Errors collects the violations of a validation. Unlike a plain error, it does not stop
+// at the first failure, and it unwraps to its violations like errors.Join, so errors.Is
+// and errors.As look into each of them.
+type Errors []Violation
+
+// Add appends a violation of rule by field, whose value is value.
+func (e *Errors) Add(field, rule, value, message string) {
+	*e = append(*e, Violation{Field: field, Rule: rule, Value: value, Message: message})
+}
+
+// Err returns e as an error, or nil if there are no violations.
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Error returns the violations, one per line, like errors.Join.
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, v := range e {
+		msgs[i] = v.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the violations as errors.
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, v := range e {
+		errs[i] = v
+	}
+	return errs
+}
+
+// Violations returns all the violations found in err, including the ones of Errors
+// joined or wrapped in err. It returns nil if err has no violations.
+func Violations(err error) []Violation {
+	var found []Violation
+	var walk func(error)
+	walk = func(err error) {
+		switch e := err.(type) {
+		case nil:
+		case Errors:
+			found = append(found, e...)
+		case Violation:
+			found = append(found, e)
+		case interface{ Unwrap() []error }:
+			for _, inner := range e.Unwrap() {
+				walk(inner)
+			}
+		default:
+			walk(errors.Unwrap(err))
+		}
+	}
+	walk(err)
+	return found
+}
@@ -0,0 +1,76 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	var errs Errors
+	if errs.Err() != nil {
+		t.Fatalf("Errors.Err() = %v, want nil", errs.Err())
+	}
+	errs.Add("uf", RuleOneOf, "MM", "uf not found")
+	errs.Add("bairro", RuleRequired, "", "bairro must not be empty")
+	err := errs.Err()
+
+	want := "uf: uf not found (one_of, value \"MM\")\nbairro: bairro must not be empty (required, value \"\")"
+	if err.Error() != want {
+		t.Errorf("Errors.Error() = %q, want %q", err.Error(), want)
+	}
+
+	tests := []struct {
+		name   string
+		target error
+		want   bool
+	}{
+		{name: "field and rule", target: Violation{Field: "uf", Rule: RuleOneOf}, want: true},
+		{name: "field", target: Violation{Field: "bairro"}, want: true},
+		{name: "rule", target: Violation{Rule: RuleRequired}, want: true},
+		{name: "other rule", target: Violation{Field: "uf", Rule: RuleRequired}, want: false},
+		{name: "other field", target: Violation{Field: "cep"}, want: false},
+		{name: "other error", target: errors.New("uf not found"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapped := fmt.Errorf("validating: %w", err)
+			if got := errors.Is(wrapped, tt.target); got != tt.want {
+				t.Errorf("errors.Is() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	var v Violation
+	if !errors.As(err, &v) || v.Field != "uf" {
+		t.Errorf("errors.As() = %v, want the uf violation", v)
+	}
+}
+
+func TestViolations(t *testing.T) {
+	var a, b Errors
+	a.Add("cep", RuleFormat, "394", "invalid zipcode")
+	b.Add("uf", RuleOneOf, "MM", "uf not found")
+	b.Add("bairro", RuleRequired, "", "bairro must not be empty")
+
+	tests := []struct {
+		name string
+		err  error
+		want []Violation
+	}{
+		{name: "nil", err: nil, want: nil},
+		{name: "plain error", err: errors.New("boom"), want: nil},
+		{name: "errors", err: b, want: b},
+		{name: "wrapped", err: fmt.Errorf("lookup: %w", a), want: a},
+		{name: "joined", err: errors.Join(a, errors.New("boom"), b), want: append(append([]Violation{}, a...), b...)},
+		{name: "single violation", err: a[0], want: []Violation{a[0]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Violations(tt.err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Violations() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/openapi"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/validation"
+)
+
+func TestValidator_Handler(t *testing.T) {
+	doc, err := openapi.Load(Spec)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	var rejected error
+	v, err := openapi.NewValidator(doc, func(w http.ResponseWriter, r *http.Request, status int, err error) {
+		rejected = err
+		w.WriteHeader(status)
+	})
+	if err != nil {
+		t.Fatalf("NewValidator() error = %v", err)
+	}
+	var forwarded string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		forwarded = string(body)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		wantStatus     int
+		wantViolations validation.Errors
+	}{
+		{name: "valid", target: "/v2/weather?units=imperial", body: `{"cep":"39408-078"}`, wantStatus: http.StatusNoContent},
+		{name: "unversioned", target: "/cep", body: `{"cep":"39408078"}`, wantStatus: http.StatusNoContent},
+		{
+			name:       "cep with letters",
+			target:     "/v2/weather",
+			body:       `{"cep":"3940807A"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantViolations: validation.Errors{
+				{Field: "cep", Rule: validation.RuleFormat, Value: "3940807A", Message: "invalid zipcode"},
+			},
+		},
+		{
+			name:       "cep is not a string",
+			target:     "/cep",
+			body:       `{"cep":39408078}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantViolations: validation.Errors{
+				{Field: "cep", Rule: validation.RuleFormat, Value: "3.9408078e+07", Message: "invalid zipcode"},
+			},
+		},
+		{
+			name:       "missing cep",
+			target:     "/v2/address",
+			body:       `{}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantViolations: validation.Errors{
+				{Field: "cep", Rule: validation.RuleRequired, Message: "invalid zipcode"},
+			},
+		},
+		{
+			name:       "invalid units",
+			target:     "/v2/weather?units=kelvin",
+			body:       `{"cep":"39408078"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantViolations: validation.Errors{
+				{Field: "units", Rule: validation.RuleOneOf, Value: "kelvin", Message: `value is not one of the allowed values ["metric","imperial","si"]`},
+			},
+		},
+		{name: "not json", target: "/v2/weather", body: `cep=39408078`, wantStatus: http.StatusBadRequest},
+		{name: "get with cep in the path", method: http.MethodGet, target: "/cep/39408-078", wantStatus: http.StatusNoContent},
+		{name: "get with cep in the query", method: http.MethodGet, target: "/weather?cep=39408078&units=si", wantStatus: http.StatusNoContent},
+		{
+			name:       "get with invalid cep",
+			method:     http.MethodGet,
+			target:     "/cep/394080",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantViolations: validation.Errors{
+				{Field: "cep", Rule: validation.RuleFormat, Value: "394080", Message: "invalid zipcode"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rejected = nil
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			r := httptest.NewRequest(method, tt.target, strings.NewReader(tt.body))
+			if tt.body != "" {
+				r.Header.Set("Content-Type", "application/json")
+			}
+			w := httptest.NewRecorder()
+			v.Handler(next).ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (error %v)", w.Code, tt.wantStatus, rejected)
+			}
+			if rejected == nil {
+				if forwarded != tt.body {
+					t.Errorf("forwarded body = %q, want %q", forwarded, tt.body)
+				}
+				return
+			}
+			if got := openapi.Violations(rejected); !reflect.DeepEqual(got, tt.wantViolations) {
+				t.Errorf("Violations() = %#v, want %#v", got, tt.wantViolations)
+			}
+		})
+	}
+}
+
+func TestStatus_BodyTooLarge(t *testing.T) {
+	doc, err := openapi.Load(Spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status int
+	v, err := openapi.NewValidator(doc, func(w http.ResponseWriter, r *http.Request, s int, err error) {
+		status = s
+		w.WriteHeader(s)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/v2/weather", strings.NewReader(`{"cep":"39408078"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Body = http.MaxBytesReader(w, r.Body, 8)
+	v.Handler(http.NotFoundHandler()).ServeHTTP(w, r)
+	if status != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", status, http.StatusRequestEntityTooLarge)
+	}
+}
@@ -0,0 +1,110 @@
+// Package request reads the bodies of the requests: it bounds their size, checks
+// their media type and decodes them strictly.
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// MaxBodyBytes is the largest request body accepted. A cep request has a few bytes.
+const MaxBodyBytes int64 = 4 << 10
+
+// Error is an error reading the body of a request, with the status to answer it with.
+type Error struct {
+	Status  int
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Limit returns next with the request bodies limited to maxBytes. Larger bodies are
+// rejected with 413, at once if their Content-Length is known, or by the reads of the
+// body failing with *http.MaxBytesError otherwise.
+func Limit(maxBytes int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > maxBytes {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireJSON returns next with the requests that send a body rejected with 415 unless
+// their Content-Type is application/json.
+func RequireJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hasBody(r) && !isJSON(r.Header.Get("Content-Type")) {
+			w.Header().Set("Accept", "application/json")
+			http.Error(w, "unsupported media type, want application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func hasBody(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		return true
+	}
+	return r.ContentLength > 0
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/json"
+}
+
+// DecodeJSON decodes the json body of r into v, strictly: unknown fields and any data
+// after the json value are errors. The errors are *Error with status
+//   - 413 if the body is larger than the Limit,
+//   - 422 if a field has the wrong type, e.g. a number instead of a string,
+//   - 400 if the body is empty, is not json, has unknown fields or trailing data.
+func DecodeJSON(r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return decodeError(err)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		if err == nil {
+			err = errors.New("more than one json value")
+		}
+		if e := decodeError(err); e.Status != http.StatusBadRequest {
+			return e
+		}
+		return &Error{Status: http.StatusBadRequest, Message: "unexpected data after the json body", Err: err}
+	}
+	return nil
+}
+
+func decodeError(err error) *Error {
+	var maxBytes *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &maxBytes):
+		return &Error{Status: http.StatusRequestEntityTooLarge, Message: "request body too large", Err: err}
+	case errors.As(err, &typeErr):
+		return &Error{Status: http.StatusUnprocessableEntity, Message: "invalid field " + typeErr.Field, Err: err}
+	case errors.Is(err, io.EOF):
+		return &Error{Status: http.StatusBadRequest, Message: "empty body", Err: err}
+	default:
+		return &Error{Status: http.StatusBadRequest, Message: "malformed json body", Err: err}
+	}
+}
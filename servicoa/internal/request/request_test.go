@@ -0,0 +1,110 @@
+package request
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type cepRequest struct {
+	Cep string `json:"cep"`
+}
+
+// chunked hides the length of r, as a chunked request body does.
+type chunked struct{ io.Reader }
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		want       string
+		wantStatus int
+	}{
+		{name: "valid", body: `{"cep":"39408078"}`, want: "39408078"},
+		{name: "trailing white space", body: "{\"cep\":\"39408078\"}\n", want: "39408078"},
+		{name: "empty body", body: ``, wantStatus: http.StatusBadRequest},
+		{name: "not json", body: `cep=39408078`, wantStatus: http.StatusBadRequest},
+		{name: "truncated", body: `{"cep":"3940`, wantStatus: http.StatusBadRequest},
+		{name: "unknown field", body: `{"cep":"39408078","city":"Montes Claros"}`, wantStatus: http.StatusBadRequest},
+		{name: "trailing data", body: `{"cep":"39408078"} garbage`, wantStatus: http.StatusBadRequest},
+		{name: "two values", body: `{"cep":"39408078"}{"cep":"39400001"}`, wantStatus: http.StatusBadRequest},
+		{name: "wrong type", body: `{"cep":39408078}`, wantStatus: http.StatusUnprocessableEntity},
+		{name: "too large", body: `{"cep":"` + strings.Repeat("0", int(MaxBodyBytes)) + `"}`, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "too large trailing data", body: `{"cep":"39408078"}` + strings.Repeat(" ", int(MaxBodyBytes)) + "x", wantStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/v2/weather", chunked{strings.NewReader(tt.body)})
+			r.Body = http.MaxBytesReader(httptest.NewRecorder(), r.Body, MaxBodyBytes)
+
+			var got cepRequest
+			err := DecodeJSON(r, &got)
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("DecodeJSON() error = %v", err)
+				}
+				if got.Cep != tt.want {
+					t.Errorf("DecodeJSON() cep = %q, want %q", got.Cep, tt.want)
+				}
+				return
+			}
+			var rerr *Error
+			if !errors.As(err, &rerr) {
+				t.Fatalf("DecodeJSON() error = %v, want *Error", err)
+			}
+			if rerr.Status != tt.wantStatus {
+				t.Errorf("DecodeJSON() status = %d, want %d (%v)", rerr.Status, tt.wantStatus, err)
+			}
+		})
+	}
+}
+
+func TestLimitAndRequireJSON(t *testing.T) {
+	handler := Limit(MaxBodyBytes, RequireJSON(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body cepRequest
+		if err := DecodeJSON(r, &body); err != nil {
+			var rerr *Error
+			errors.As(err, &rerr)
+			http.Error(w, rerr.Message, rerr.Status)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        io.Reader
+		wantStatus  int
+	}{
+		{name: "valid", contentType: "application/json", body: strings.NewReader(`{"cep":"39408078"}`), wantStatus: http.StatusNoContent},
+		{name: "charset", contentType: "application/json; charset=utf-8", body: strings.NewReader(`{"cep":"39408078"}`), wantStatus: http.StatusNoContent},
+		{name: "no content type", body: strings.NewReader(`{"cep":"39408078"}`), wantStatus: http.StatusUnsupportedMediaType},
+		{name: "form", contentType: "application/x-www-form-urlencoded", body: strings.NewReader(`cep=39408078`), wantStatus: http.StatusUnsupportedMediaType},
+		{name: "malformed content type", contentType: "application/json;;", body: strings.NewReader(`{"cep":"39408078"}`), wantStatus: http.StatusUnsupportedMediaType},
+		{name: "get without body", method: http.MethodGet, wantStatus: http.StatusBadRequest},
+		{name: "too large content length", contentType: "application/json", body: strings.NewReader(strings.Repeat(" ", int(MaxBodyBytes)+1)), wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "too large chunked", contentType: "application/json", body: chunked{strings.NewReader(strings.Repeat(" ", int(MaxBodyBytes)+1))}, wantStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			r := httptest.NewRequest(method, "/v2/weather", tt.body)
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
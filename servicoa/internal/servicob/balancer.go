@@ -0,0 +1,332 @@
+package servicob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstanceKey is the base url of the servicob instance receiving a call.
+const InstanceKey = attribute.Key("servicob.instance")
+
+var ErrNoInstances = errors.New("no servicob instance")
+
+// Policy chooses the servicob instance of each call among the healthy ones.
+type Policy string
+
+const (
+	// RoundRobin takes the instances in turn.
+	RoundRobin Policy = "round_robin"
+	// LeastOutstanding takes the instance with the fewest calls in flight.
+	LeastOutstanding Policy = "least_outstanding"
+)
+
+// ParsePolicy parses the name of a Policy, RoundRobin if empty.
+func ParsePolicy(name string) (Policy, error) {
+	switch p := Policy(name); p {
+	case "":
+		return RoundRobin, nil
+	case RoundRobin, LeastOutstanding:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid servicob balancer %q", name)
+}
+
+// BalancerConfig configures the load balancing of the calls among the servicob instances.
+type BalancerConfig struct {
+	Policy Policy
+	// An instance failing FailureThreshold calls in a row is ejected for EjectionTime,
+	// unless a health probe succeeds first. 0 disables the ejection.
+	FailureThreshold int
+	EjectionTime     time.Duration
+	// Every ProbeInterval, ProbePath is requested from every instance: the instances not
+	// answering 200 within ProbeTimeout are unhealthy until they do. 0 disables the probes.
+	ProbeInterval time.Duration
+	ProbeTimeout  time.Duration
+	ProbePath     string
+	// The instances are resolved again every ResolveInterval. 0 disables it.
+	ResolveInterval time.Duration
+}
+
+// DefaultBalancerConfig returns the round robin balancing probing /healthz of servicob.
+func DefaultBalancerConfig() BalancerConfig {
+	return BalancerConfig{
+		Policy:           RoundRobin,
+		FailureThreshold: 5,
+		EjectionTime:     30 * time.Second,
+		ProbeInterval:    10 * time.Second,
+		ProbeTimeout:     2 * time.Second,
+		ProbePath:        "/healthz",
+		ResolveInterval:  30 * time.Second,
+	}
+}
+
+// Balanced is a ServiceBClient spreading the calls among the servicob instances of a
+// Resolver. The calls go to the healthy instances, or to all of them when none is. The
+// calls with a context of withTried go to the instances the context was not sent to
+// yet, failing with ErrNoInstances when there is none.
+type Balanced struct {
+	cfg       BalancerConfig
+	resolve   Resolver
+	newClient func(baseURL string) (*Client, error)
+	now       func() time.Time
+
+	mu       sync.RWMutex
+	backends []*backend
+	next     atomic.Uint64
+}
+
+// backend is a servicob instance.
+type backend struct {
+	url         string
+	client      *Client
+	outstanding atomic.Int64
+
+	mu           sync.Mutex
+	failures     int
+	ejectedUntil time.Time
+	probeFailed  bool
+}
+
+// NewBalanced returns the Balanced client of the instances of resolve, calling each one
+// with the client returned by newClient for its base url. It resolves the instances,
+// then resolves them again and probes them in background until ctx is done.
+func NewBalanced(ctx context.Context, resolve Resolver, cfg BalancerConfig, newClient func(baseURL string) (*Client, error)) (*Balanced, error) {
+	b := &Balanced{cfg: cfg, resolve: resolve, newClient: newClient, now: time.Now}
+	if err := b.refresh(ctx); err != nil {
+		return nil, err
+	}
+	go b.run(ctx)
+	return b, nil
+}
+
+func (b *Balanced) Get(ctx context.Context, req Request) (*Response, error) {
+	t, _ := ctx.Value(triedKey{}).(*tried)
+	be := b.pick(t)
+	if be == nil {
+		return nil, ErrNoInstances
+	}
+	// the span of the call, or of the attempt of a hedged call
+	trace.SpanFromContext(ctx).SetAttributes(InstanceKey.String(be.url))
+	be.outstanding.Add(1)
+	res, err := be.client.Get(ctx, req)
+	be.outstanding.Add(-1)
+	if ctx.Err() == nil {
+		be.observe(instanceFailed(res, err), b.cfg, b.now())
+	}
+	return res, err
+}
+
+// Instances returns the base urls of the instances and whether they are healthy.
+func (b *Balanced) Instances() map[string]bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	now := b.now()
+	instances := make(map[string]bool, len(b.backends))
+	for _, be := range b.backends {
+		instances[be.url] = be.healthy(now)
+	}
+	return instances
+}
+
+// pick returns the backend of the next call, among the ones not in t if set, or nil if
+// there is none. It adds the backend to t.
+func (b *Balanced) pick(t *tried) *backend {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	backends := b.backends
+	if t != nil {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		backends = slices.DeleteFunc(slices.Clone(backends), func(be *backend) bool {
+			return slices.Contains(t.urls, be.url)
+		})
+	}
+	now := b.now()
+	candidates := make([]*backend, 0, len(backends))
+	for _, be := range backends {
+		if be.healthy(now) {
+			candidates = append(candidates, be)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = backends
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	start := int(b.next.Add(1)-1) % len(candidates)
+	best := candidates[start]
+	if b.cfg.Policy == LeastOutstanding {
+		// starting at the next in turn spreads the ties
+		for i := 1; i < len(candidates); i++ {
+			be := candidates[(start+i)%len(candidates)]
+			if be.outstanding.Load() < best.outstanding.Load() {
+				best = be
+			}
+		}
+	}
+	if t != nil {
+		t.urls = append(t.urls, best.url)
+	}
+	return best
+}
+
+// triedKey is the context key of the tried instances.
+type triedKey struct{}
+
+// tried is the set of the instances the calls of a context were sent to.
+type tried struct {
+	mu   sync.Mutex
+	urls []string
+}
+
+// withTried returns ctx sending each of its calls to a Balanced client to another
+// instance, as the hedged requests.
+func withTried(ctx context.Context) context.Context {
+	return context.WithValue(ctx, triedKey{}, &tried{})
+}
+
+// run resolves and probes the instances until ctx is done.
+func (b *Balanced) run(ctx context.Context) {
+	var resolveC, probeC <-chan time.Time
+	if b.cfg.ResolveInterval > 0 {
+		t := time.NewTicker(b.cfg.ResolveInterval)
+		defer t.Stop()
+		resolveC = t.C
+	}
+	if b.cfg.ProbeInterval > 0 {
+		t := time.NewTicker(b.cfg.ProbeInterval)
+		defer t.Stop()
+		probeC = t.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-resolveC:
+			if err := b.refresh(ctx); err != nil {
+				slog.Warn("servicob instances not resolved, keeping the known ones", "error", err)
+			}
+		case <-probeC:
+			b.probe(ctx)
+		}
+	}
+}
+
+// refresh resolves the instances, keeping the state of the known ones.
+func (b *Balanced) refresh(ctx context.Context) error {
+	urls, err := b.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	if len(urls) == 0 {
+		return ErrNoInstances
+	}
+
+	b.mu.RLock()
+	known := make(map[string]*backend, len(b.backends))
+	for _, be := range b.backends {
+		known[be.url] = be
+	}
+	b.mu.RUnlock()
+
+	backends := make([]*backend, 0, len(urls))
+	for _, u := range slices.Compact(slices.Sorted(slices.Values(urls))) {
+		if be, ok := known[u]; ok {
+			backends = append(backends, be)
+			delete(known, u)
+			continue
+		}
+		client, err := b.newClient(u)
+		if err != nil {
+			return err
+		}
+		backends = append(backends, &backend{url: u, client: client})
+	}
+
+	b.mu.Lock()
+	b.backends = backends
+	b.mu.Unlock()
+	for _, gone := range known {
+		gone.client.close()
+	}
+	return nil
+}
+
+// probe requests the health of every instance.
+func (b *Balanced) probe(ctx context.Context) {
+	b.mu.RLock()
+	backends := slices.Clone(b.backends)
+	b.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, be := range backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, b.cfg.ProbeTimeout)
+			defer cancel()
+			err := be.client.Probe(ctx, b.cfg.ProbePath)
+			if err != nil {
+				slog.Warn("servicob instance unhealthy", "instance", be.url, "error", err)
+			}
+			be.probed(err == nil)
+		}()
+	}
+	wg.Wait()
+}
+
+func (be *backend) healthy(now time.Time) bool {
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	return !be.probeFailed && !now.Before(be.ejectedUntil)
+}
+
+// observe records the outcome of a call, ejecting the instance after
+// cfg.FailureThreshold failures in a row.
+func (be *backend) observe(failed bool, cfg BalancerConfig, now time.Time) {
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	if !failed {
+		be.failures = 0
+		return
+	}
+	be.failures++
+	if cfg.FailureThreshold > 0 && be.failures >= cfg.FailureThreshold {
+		be.failures = 0
+		be.ejectedUntil = now.Add(cfg.EjectionTime)
+		slog.Warn("servicob instance ejected", "instance", be.url, "until", be.ejectedUntil)
+	}
+}
+
+// probed records the outcome of a health probe. A successful probe ends the ejection.
+func (be *backend) probed(ok bool) {
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	be.probeFailed = !ok
+	if ok {
+		be.failures = 0
+		be.ejectedUntil = time.Time{}
+	}
+}
+
+// instanceFailed reports whether a call failed because of the instance rather than of
+// the request or of the providers of servicob: the calls with no response, and the 5xx
+// responses with no servicob error code, e.g. from a proxy.
+func instanceFailed(res *Response, err error) bool {
+	if err != nil || res == nil {
+		return true
+	}
+	return res.StatusCode >= http.StatusInternalServerError && res.Header.Get(ErrorCodeHeader) == ""
+}
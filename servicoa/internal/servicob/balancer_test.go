@@ -0,0 +1,268 @@
+package servicob
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeInstance is a servicob instance counting its weather calls.
+type fakeInstance struct {
+	*httptest.Server
+	hits    atomic.Int32
+	healthy atomic.Bool
+	release chan struct{}
+}
+
+// startInstances starts n servicob instances. The weather calls with units=slow block
+// until the release channel of the instance is closed.
+func startInstances(t *testing.T, n int) []*fakeInstance {
+	t.Helper()
+	instances := make([]*fakeInstance, n)
+	for i := range instances {
+		fi := &fakeInstance{release: make(chan struct{})}
+		fi.healthy.Store(true)
+		fi.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/healthz" {
+				if !fi.healthy.Load() {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+				return
+			}
+			fi.hits.Add(1)
+			if r.URL.Query().Get("units") == "slow" {
+				<-fi.release
+			}
+			w.Write([]byte(`{}`))
+		}))
+		t.Cleanup(fi.Close)
+		t.Cleanup(func() {
+			select {
+			case <-fi.release:
+			default:
+				close(fi.release)
+			}
+		})
+		instances[i] = fi
+	}
+	return instances
+}
+
+func newTestBalanced(t *testing.T, urls []string, cfg BalancerConfig) *Balanced {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	resolve, err := NewResolver(strings.Join(urls, ","))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewBalanced(ctx, resolve, cfg, func(baseURL string) (*Client, error) {
+		c := DefaultConfig()
+		c.BaseURL = baseURL
+		return New(c)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func urlsOf(instances []*fakeInstance) []string {
+	urls := make([]string, len(instances))
+	for i, fi := range instances {
+		urls[i] = fi.URL
+	}
+	return urls
+}
+
+var weatherRequest = Request{Path: WeatherV2, Cep: "39408078"}
+
+func TestBalanced_RoundRobin(t *testing.T) {
+	instances := startInstances(t, 3)
+	b := newTestBalanced(t, urlsOf(instances), BalancerConfig{Policy: RoundRobin})
+	for range 9 {
+		if _, err := b.Get(context.Background(), weatherRequest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, fi := range instances {
+		if n := fi.hits.Load(); n != 3 {
+			t.Errorf("%s got %d calls, want 3", fi.URL, n)
+		}
+	}
+}
+
+func TestBalanced_LeastOutstanding(t *testing.T) {
+	instances := startInstances(t, 2)
+	b := newTestBalanced(t, urlsOf(instances), BalancerConfig{Policy: LeastOutstanding})
+
+	done := make(chan error)
+	go func() {
+		_, err := b.Get(context.Background(), Request{Path: WeatherV2, Cep: "39408078", Query: map[string][]string{"units": {"slow"}}})
+		done <- err
+	}()
+	var slow, fast *fakeInstance
+	for deadline := time.Now().Add(time.Second); slow == nil && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		for i, fi := range instances {
+			if fi.hits.Load() == 1 {
+				slow, fast = fi, instances[1-i]
+			}
+		}
+	}
+	if slow == nil {
+		t.Fatal("the slow call did not arrive")
+	}
+
+	for range 4 {
+		if _, err := b.Get(context.Background(), weatherRequest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := fast.hits.Load(); n != 4 {
+		t.Errorf("the idle instance got %d calls, want 4", n)
+	}
+	close(slow.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBalanced_Tried(t *testing.T) {
+	instances := startInstances(t, 2)
+	b := newTestBalanced(t, urlsOf(instances), BalancerConfig{Policy: RoundRobin})
+	ctx := withTried(context.Background())
+	for range 2 {
+		if _, err := b.Get(ctx, weatherRequest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, fi := range instances {
+		if n := fi.hits.Load(); n != 1 {
+			t.Errorf("%s got %d calls, want 1", fi.URL, n)
+		}
+	}
+	if _, err := b.Get(ctx, weatherRequest); !errors.Is(err, ErrNoInstances) {
+		t.Errorf("Get() with every instance tried error = %v, want %v", err, ErrNoInstances)
+	}
+}
+
+func TestBalanced_PassiveEjection(t *testing.T) {
+	instances := startInstances(t, 1)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	b := newTestBalanced(t, []string{instances[0].URL, down.URL}, BalancerConfig{
+		Policy:           RoundRobin,
+		FailureThreshold: 2,
+		EjectionTime:     time.Minute,
+	})
+
+	var failures int
+	for range 10 {
+		if _, err := b.Get(context.Background(), weatherRequest); err != nil {
+			failures++
+		}
+	}
+	if failures != 2 {
+		t.Errorf("%d failed calls, want 2 before the ejection", failures)
+	}
+	if got := b.Instances(); got[down.URL] || !got[instances[0].URL] {
+		t.Errorf("Instances() = %v, want %s ejected", got, down.URL)
+	}
+
+	// the ejection ends after EjectionTime
+	b.now = func() time.Time { return time.Now().Add(time.Minute) }
+	if got := b.Instances(); !got[down.URL] {
+		t.Errorf("Instances() = %v, want %s back", got, down.URL)
+	}
+}
+
+func TestBalanced_Probes(t *testing.T) {
+	instances := startInstances(t, 2)
+	b := newTestBalanced(t, urlsOf(instances), BalancerConfig{
+		Policy:       RoundRobin,
+		ProbeTimeout: time.Second,
+		ProbePath:    "/healthz",
+	})
+
+	instances[0].healthy.Store(false)
+	b.probe(context.Background())
+	for range 4 {
+		if _, err := b.Get(context.Background(), weatherRequest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := instances[0].hits.Load(); n != 0 {
+		t.Errorf("the unhealthy instance got %d calls, want 0", n)
+	}
+
+	// with no healthy instance, all of them are called
+	instances[1].healthy.Store(false)
+	b.probe(context.Background())
+	for range 4 {
+		if _, err := b.Get(context.Background(), weatherRequest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := instances[0].hits.Load(); n != 2 {
+		t.Errorf("the unhealthy instance got %d calls, want 2", n)
+	}
+
+	instances[0].healthy.Store(true)
+	b.probe(context.Background())
+	if got := b.Instances(); !got[instances[0].URL] || got[instances[1].URL] {
+		t.Errorf("Instances() = %v, want only %s healthy", got, instances[0].URL)
+	}
+}
+
+func TestBalanced_Refresh(t *testing.T) {
+	instances := startInstances(t, 3)
+	urls := urlsOf(instances[:2])
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b, err := NewBalanced(ctx, func(context.Context) ([]string, error) {
+		return urls, nil
+	}, BalancerConfig{FailureThreshold: 1, EjectionTime: time.Minute}, func(baseURL string) (*Client, error) {
+		c := DefaultConfig()
+		c.BaseURL = baseURL
+		return New(c)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, be := range b.backends {
+		if be.url == instances[1].URL {
+			be.observe(true, b.cfg, time.Now())
+		}
+	}
+
+	// the known instances keep their state
+	urls = urlsOf(instances[1:])
+	if err := b.refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := b.Instances()
+	if len(got) != 2 || got[instances[1].URL] || !got[instances[2].URL] {
+		t.Errorf("Instances() = %v, want %s ejected and %s healthy", got, instances[1].URL, instances[2].URL)
+	}
+
+	urls = urlsOf(instances[:1])
+	if err := b.refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.Instances(); len(got) != 1 || !got[instances[0].URL] {
+		t.Errorf("Instances() = %v, want only %s", got, instances[0].URL)
+	}
+
+	urls = nil
+	if err := b.refresh(context.Background()); err == nil {
+		t.Error("refresh() error = nil with no instance")
+	}
+	if got := b.Instances(); len(got) != 1 {
+		t.Errorf("Instances() = %v, want the known instance kept", got)
+	}
+}
@@ -0,0 +1,332 @@
+// Package servicob is the http client servicoa uses to call servicob.
+package servicob
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Paths of the servicob routes.
+const (
+	WeatherV1 = "/v1/weather"
+	WeatherV2 = "/v2/weather"
+	AddressV2 = "/v2/address"
+	// WatchlistV2 is followed by the cep, e.g. /v2/watchlist/39408078.
+	WatchlistV2 = "/v2/watchlist"
+)
+
+var ErrResponseTooLarge = errors.New("servicob response too large")
+
+// ErrorCodeHeader carries the machine readable code of the servicob error responses,
+// e.g. unavailable or rate_limited.
+const ErrorCodeHeader = "X-Error-Code"
+
+// Attributes of the servicoa spans describing the servicob response.
+const (
+	StatusCodeKey = attribute.Key("servicob.status_code")
+	ErrorCodeKey  = attribute.Key("servicob.error_code")
+)
+
+// Request is a request of servicob for a cep.
+type Request struct {
+	Method string     // GET if empty; PUT and DELETE for WatchlistV2
+	Path   string     // e.g. WeatherV2
+	Cep    string     // sent as the cep query parameter
+	Query  url.Values // other query parameters, e.g. units and decimals
+	// Accept, IfNoneMatch and CacheControl are sent as the Accept, If-None-Match and
+	// Cache-Control headers, if set.
+	Accept       string
+	IfNoneMatch  string
+	CacheControl string
+}
+
+// Response is a response of servicob, with its whole body.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// ErrorCode returns the code of an error response: the ErrorCodeHeader, or the code of
+// a json body for the servicob versions that do not send the header.
+func (r *Response) ErrorCode() string {
+	if code := r.Header.Get(ErrorCodeHeader); code != "" {
+		return code
+	}
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/json" {
+		return ""
+	}
+	var body struct {
+		Code string `json:"code"`
+	}
+	if json.Unmarshal(r.Body, &body) != nil {
+		return ""
+	}
+	return body.Code
+}
+
+// ServiceBClient calls servicob. The handlers depend on it rather than on Client, so
+// their tests can replace servicob by a fake.
+type ServiceBClient interface {
+	// Get sends req and returns the response of servicob, whatever its status. It
+	// returns an error only if no complete response was received.
+	Get(ctx context.Context, req Request) (*Response, error)
+}
+
+// Config configures a Client.
+type Config struct {
+	// BaseURL is the base url of servicob, e.g. http://servicob:8081. For NewServiceBClient,
+	// it may list several instances, or their dns names, see NewResolver.
+	BaseURL string
+	// Timeout bounds the whole call, including reading the body. It is longer than the
+	// 10 seconds servicob gives its providers, so servicob can answer its own timeouts.
+	Timeout               time.Duration
+	DialTimeout           time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	MaxIdleConnsPerHost   int
+	MaxConnsPerHost       int // 0 is unlimited
+	// MaxBodyBytes caps the responses; larger ones fail with ErrResponseTooLarge.
+	MaxBodyBytes int64
+	// Coalesce sends a single request for identical concurrent requests, see Coalesced.
+	Coalesce bool
+	// Hedge configures the hedged requests, see Hedged.
+	Hedge HedgeConfig
+	// Balancer configures the load balancing among the instances, see Balanced.
+	Balancer BalancerConfig
+}
+
+// DefaultConfig returns the configuration of servicob in docker-compose.
+func DefaultConfig() Config {
+	return Config{
+		BaseURL:               "http://servicob:8081",
+		Timeout:               12 * time.Second,
+		DialTimeout:           2 * time.Second,
+		ResponseHeaderTimeout: 11 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   32,
+		MaxBodyBytes:          1 << 20,
+		Coalesce:              true,
+		Hedge:                 DefaultHedgeConfig(),
+		Balancer:              DefaultBalancerConfig(),
+	}
+}
+
+// ConfigFromEnv returns DefaultConfig with the base url and the timeout replaced by the
+// environment variables SERVICOB_URL and SERVICOB_TIMEOUT (a time.Duration, e.g. 5s),
+// if set. SERVICOB_COALESCE=false disables the coalescing of identical requests,
+// SERVICOB_HEDGE=true enables the hedged requests to another instance and
+// SERVICOB_BALANCER chooses the Policy of the load balancing.
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
+	if v := os.Getenv("SERVICOB_URL"); v != "" {
+		cfg.BaseURL = v
+	}
+	policy, err := ParsePolicy(os.Getenv("SERVICOB_BALANCER"))
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Balancer.Policy = policy
+	if v := os.Getenv("SERVICOB_COALESCE"); v != "" {
+		coalesce, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid SERVICOB_COALESCE %q", v)
+		}
+		cfg.Coalesce = coalesce
+	}
+	if v := os.Getenv("SERVICOB_HEDGE"); v != "" {
+		hedge, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid SERVICOB_HEDGE %q", v)
+		}
+		cfg.Hedge.Enabled = hedge
+	}
+	if v := os.Getenv("SERVICOB_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return Config{}, fmt.Errorf("invalid SERVICOB_TIMEOUT %q", v)
+		}
+		cfg.Timeout = d
+		if cfg.ResponseHeaderTimeout > d {
+			cfg.ResponseHeaderTimeout = d
+		}
+	}
+	return cfg, nil
+}
+
+// Client is the ServiceBClient of a servicob instance, with pooled connections.
+type Client struct {
+	baseURL      *url.URL
+	http         *http.Client
+	maxBodyBytes int64
+	// probes is the untraced client of the health probes.
+	probes *http.Client
+}
+
+// Option configures a Client.
+type Option func(*Client) error
+
+// WithRoundTripper wraps the transport of the client, e.g. in a zipkin transport.
+func WithRoundTripper(wrap func(http.RoundTripper) (http.RoundTripper, error)) Option {
+	return func(c *Client) error {
+		rt, err := wrap(c.http.Transport)
+		if err != nil {
+			return err
+		}
+		c.http.Transport = rt
+		return nil
+	}
+}
+
+// New returns the Client of the servicob at cfg.BaseURL.
+func New(cfg Config, opts ...Option) (*Client, error) {
+	base, err := url.Parse(cfg.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid servicob url: %w", err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" || base.Host == "" {
+		return nil, fmt.Errorf("invalid servicob url %q", cfg.BaseURL)
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: 30 * time.Second}).DialContext,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		MaxIdleConns:          cfg.MaxIdleConnsPerHost,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+	}
+	c := &Client{
+		baseURL:      base,
+		http:         &http.Client{Transport: transport, Timeout: cfg.Timeout},
+		maxBodyBytes: cfg.MaxBodyBytes,
+		probes:       &http.Client{Transport: transport},
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// NewServiceBClient returns the ServiceBClient configured by cfg: the Balanced client
+// of the instances of cfg.BaseURL, hedged among them if cfg.Hedge is enabled,
+// and Coalesced if cfg.Coalesce is set. The options apply to the Client of every
+// instance. The instances are resolved and probed until ctx is done.
+func NewServiceBClient(ctx context.Context, cfg Config, opts ...Option) (ServiceBClient, error) {
+	balanced, err := newBalanced(ctx, cfg, cfg.BaseURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	var client ServiceBClient = balanced
+	if cfg.Hedge.Enabled {
+		client = Hedged(client, cfg.Hedge)
+	}
+	if cfg.Coalesce {
+		client = Coalesced(client)
+	}
+	return client, nil
+}
+
+// newBalanced returns the Balanced client of the instances of spec.
+func newBalanced(ctx context.Context, cfg Config, spec string, opts []Option) (*Balanced, error) {
+	resolve, err := NewResolver(spec)
+	if err != nil {
+		return nil, err
+	}
+	return NewBalanced(ctx, resolve, cfg.Balancer, func(baseURL string) (*Client, error) {
+		instance := cfg
+		instance.BaseURL = baseURL
+		return New(instance, opts...)
+	})
+}
+
+// URL returns the url of req.
+func (c *Client) URL(req Request) *url.URL {
+	u := c.baseURL.JoinPath(req.Path)
+	u.RawQuery = req.values().Encode()
+	return u
+}
+
+// values returns the query parameters of req, with the cep.
+func (req Request) values() url.Values {
+	q := url.Values{}
+	for name, values := range req.Query {
+		q[name] = values
+	}
+	q.Set("cep", req.Cep)
+	return q
+}
+
+// Get sends req to servicob, with req.Method, propagating the otel context of ctx.
+func (c *Client) Get(ctx context.Context, req Request) (*Response, error) {
+	hreq, err := http.NewRequestWithContext(ctx, cmp.Or(req.Method, http.MethodGet), c.URL(req).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if req.Accept != "" {
+		hreq.Header.Set("Accept", req.Accept)
+	}
+	if req.IfNoneMatch != "" {
+		hreq.Header.Set("If-None-Match", req.IfNoneMatch)
+	}
+	if req.CacheControl != "" {
+		hreq.Header.Set("Cache-Control", req.CacheControl)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(hreq.Header))
+
+	res, err := c.http.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, c.maxBodyBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading servicob response: %w", err)
+	}
+	if int64(len(body)) > c.maxBodyBytes {
+		return nil, fmt.Errorf("%w: more than %s bytes", ErrResponseTooLarge, strconv.FormatInt(c.maxBodyBytes, 10))
+	}
+	return &Response{StatusCode: res.StatusCode, Header: res.Header, Body: body}, nil
+}
+
+// Probe gets path, e.g. /healthz, returning an error unless servicob answers 200.
+func (c *Client) Probe(ctx context.Context, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL.JoinPath(path).String(), nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.probes.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, c.maxBodyBytes))
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("servicob health: %s", res.Status)
+	}
+	return nil
+}
+
+// close closes the idle connections of c, once its instance is gone.
+func (c *Client) close() {
+	c.http.CloseIdleConnections()
+	c.probes.CloseIdleConnections()
+}
@@ -0,0 +1,197 @@
+package servicob
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc, cfg func(*Config)) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	config := DefaultConfig()
+	config.BaseURL = server.URL
+	if cfg != nil {
+		cfg(&config)
+	}
+	c, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestClient_URL(t *testing.T) {
+	c, err := New(Config{BaseURL: "http://servicob:8081"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := c.URL(Request{
+		Path:  WeatherV2,
+		Cep:   "39408078",
+		Query: url.Values{"units": {"celsius,kelvin"}, "cep": {"01001000"}, "city": {"São Paulo & Rio"}},
+	})
+	want := "http://servicob:8081/v2/weather?cep=39408078&city=S%C3%A3o+Paulo+%26+Rio&units=celsius%2Ckelvin"
+	if got.String() != want {
+		t.Errorf("URL() = %s, want %s", got, want)
+	}
+}
+
+func TestNew_InvalidURL(t *testing.T) {
+	for _, base := range []string{"", "servicob:8081", "ftp://servicob", "http://"} {
+		if _, err := New(Config{BaseURL: base}); err == nil {
+			t.Errorf("New(%q) error = nil, want error", base)
+		}
+	}
+}
+
+func TestClient_Get(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.Path == WatchlistV2+"/39408078" {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		if r.URL.Path != WeatherV2 || r.URL.Query().Get("cep") != "39408078" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Cache-Control") == "only-if-cached" {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `W/"1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", r.Header.Get("Accept"))
+		w.Write([]byte(`{"temp_C":31.1}`))
+	}, nil)
+
+	tests := []struct {
+		name       string
+		req        Request
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "ok", req: Request{Path: WeatherV2, Cep: "39408078", Accept: "application/json"}, wantStatus: 200, wantBody: `{"temp_C":31.1}`},
+		{name: "not modified", req: Request{Path: WeatherV2, Cep: "39408078", IfNoneMatch: `W/"1"`}, wantStatus: 304},
+		{name: "not found", req: Request{Path: WeatherV2, Cep: "39408077"}, wantStatus: 404, wantBody: "404 page not found\n"},
+		{name: "only if cached", req: Request{Path: WeatherV2, Cep: "39408078", CacheControl: "only-if-cached"}, wantStatus: 504},
+		{name: "method", req: Request{Method: http.MethodPut, Path: WatchlistV2 + "/39408078", Cep: "39408078"}, wantStatus: 201},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Get(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if got.StatusCode != tt.wantStatus {
+				t.Errorf("Get() status = %d, want %d", got.StatusCode, tt.wantStatus)
+			}
+			if string(got.Body) != tt.wantBody {
+				t.Errorf("Get() body = %q, want %q", got.Body, tt.wantBody)
+			}
+			if tt.req.Accept != "" && got.Header.Get("Content-Type") != tt.req.Accept {
+				t.Errorf("Get() Content-Type = %q, want %q", got.Header.Get("Content-Type"), tt.req.Accept)
+			}
+		})
+	}
+}
+
+func TestClient_Get_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		cfg     func(*Config)
+		check   func(error) bool
+	}{
+		{
+			name: "response too large",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(strings.Repeat("x", 65)))
+			},
+			cfg:   func(c *Config) { c.MaxBodyBytes = 64 },
+			check: func(err error) bool { return errors.Is(err, ErrResponseTooLarge) },
+		},
+		{
+			name: "timeout",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(time.Second):
+				}
+			},
+			cfg: func(c *Config) { c.Timeout = 50 * time.Millisecond },
+			check: func(err error) bool {
+				var terr interface{ Timeout() bool }
+				return errors.As(err, &terr) && terr.Timeout()
+			},
+		},
+		{
+			name:    "connection refused",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+			cfg:     func(c *Config) { c.BaseURL = "http://127.0.0.1:1" },
+			check:   func(err error) bool { return err != nil },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, tt.handler, tt.cfg)
+			got, err := c.Get(context.Background(), Request{Path: WeatherV2, Cep: "39408078"})
+			if got != nil {
+				t.Errorf("Get() = %+v, want nil", got)
+			}
+			if !tt.check(err) {
+				t.Errorf("Get() unexpected error = %v", err)
+			}
+		})
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("SERVICOB_URL", "http://localhost:8081")
+	t.Setenv("SERVICOB_TIMEOUT", "3s")
+	t.Setenv("SERVICOB_HEDGE", "true")
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BaseURL != "http://localhost:8081" || cfg.Timeout != 3*time.Second || cfg.ResponseHeaderTimeout != 3*time.Second || !cfg.Hedge.Enabled {
+		t.Errorf("ConfigFromEnv() = %+v", cfg)
+	}
+
+	t.Setenv("SERVICOB_TIMEOUT", "soon")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Error("ConfigFromEnv() error = nil, want error")
+	}
+}
+
+func TestResponse_ErrorCode(t *testing.T) {
+	tests := []struct {
+		name string
+		res  Response
+		want string
+	}{
+		{name: "header", res: Response{Header: http.Header{"X-Error-Code": {"rate_limited"}}}, want: "rate_limited"},
+		{
+			name: "json body",
+			res:  Response{Header: http.Header{"Content-Type": {"application/json"}}, Body: []byte(`{"code":"unavailable","message":"Service Unavailable"}`)},
+			want: "unavailable",
+		},
+		{name: "xml body", res: Response{Header: http.Header{"Content-Type": {"application/xml"}}, Body: []byte(`<error><code>unavailable</code></error>`)}},
+		{name: "invalid json", res: Response{Header: http.Header{"Content-Type": {"application/json"}}, Body: []byte(`internal error`)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.res.ErrorCode(); got != tt.want {
+				t.Errorf("ErrorCode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package servicob
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+// CoalescedKey is true on the spans of the calls that shared the servicob response of
+// an identical call in flight.
+const CoalescedKey = attribute.Key("servicob.coalesced")
+
+// coalesced is the ServiceBClient returned by Coalesced.
+type coalesced struct {
+	next  ServiceBClient
+	calls singleflight.Group
+}
+
+// Coalesced returns a ServiceBClient that sends a single request to next for identical
+// concurrent requests, e.g. for a popular cep, and gives its response to all of them.
+// The Response is shared, so its Header and Body must not be modified.
+//
+// The request in flight is not canceled when the caller that started it gives up; each
+// caller still returns as soon as its own context is done.
+func Coalesced(next ServiceBClient) ServiceBClient {
+	return &coalesced{next: next}
+}
+
+func (c *coalesced) Get(ctx context.Context, req Request) (*Response, error) {
+	ch := c.calls.DoChan(coalesceKey(req), func() (any, error) {
+		return c.next.Get(context.WithoutCancel(ctx), req)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-ch:
+		trace.SpanFromContext(ctx).SetAttributes(CoalescedKey.Bool(r.Shared))
+		res, _ := r.Val.(*Response)
+		return res, r.Err
+	}
+}
+
+// coalesceKey identifies the requests with the same response.
+func coalesceKey(req Request) string {
+	return strings.Join([]string{req.Method, req.Path, req.values().Encode(), req.Accept, req.IfNoneMatch, req.CacheControl}, "\x00")
+}
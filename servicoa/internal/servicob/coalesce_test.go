@@ -0,0 +1,115 @@
+package servicob
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// clientFunc is a ServiceBClient calling the function.
+type clientFunc func(ctx context.Context, req Request) (*Response, error)
+
+func (f clientFunc) Get(ctx context.Context, req Request) (*Response, error) {
+	return f(ctx, req)
+}
+
+func TestCoalesceKey(t *testing.T) {
+	base := Request{Path: WeatherV2, Cep: "39408078", Query: url.Values{"units": {"kelvin"}}, Accept: "application/json"}
+	same := Request{Path: WeatherV2, Cep: "39408078", Query: url.Values{"units": {"kelvin"}, "cep": {"01001000"}}, Accept: "application/json"}
+	if coalesceKey(base) != coalesceKey(same) {
+		t.Error("coalesceKey() differs for the same request")
+	}
+	others := []Request{
+		{Path: WeatherV1, Cep: "39408078", Query: url.Values{"units": {"kelvin"}}, Accept: "application/json"},
+		{Path: WeatherV2, Cep: "01001000", Query: url.Values{"units": {"kelvin"}}, Accept: "application/json"},
+		{Path: WeatherV2, Cep: "39408078", Query: url.Values{"units": {"celsius"}}, Accept: "application/json"},
+		{Path: WeatherV2, Cep: "39408078", Query: url.Values{"units": {"kelvin"}}, Accept: "text/csv"},
+		{Path: WeatherV2, Cep: "39408078", Query: url.Values{"units": {"kelvin"}}, Accept: "application/json", IfNoneMatch: `W/"1"`},
+		{Path: WeatherV2, Cep: "39408078", Query: url.Values{"units": {"kelvin"}}, Accept: "application/json", CacheControl: "only-if-cached"},
+		{Method: http.MethodPut, Path: WeatherV2, Cep: "39408078", Query: url.Values{"units": {"kelvin"}}, Accept: "application/json"},
+	}
+	for _, other := range others {
+		if coalesceKey(base) == coalesceKey(other) {
+			t.Errorf("coalesceKey(%+v) = coalesceKey(%+v)", other, base)
+		}
+	}
+}
+
+func TestCoalesced(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	want := &Response{StatusCode: 200, Body: []byte(`{"city":"Montes Claros"}`)}
+	c := Coalesced(clientFunc(func(ctx context.Context, req Request) (*Response, error) {
+		calls.Add(1)
+		<-release
+		return want, nil
+	}))
+
+	spans := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)).Tracer("test")
+
+	const callers = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, span := tracer.Start(context.Background(), "caller")
+			defer span.End()
+			got, err := c.Get(ctx, Request{Path: WeatherV2, Cep: "39408078"})
+			if err != nil || got != want {
+				errs <- errors.New("unexpected response")
+			}
+		}()
+	}
+	// a caller giving up does not cancel the others
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := c.Get(ctx, Request{Path: WeatherV2, Cep: "39408078"})
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Get() error = %v, want context.Canceled", err)
+	}
+
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("%d calls, want 1", n)
+	}
+	for _, span := range spans.Ended() {
+		var coalesced bool
+		for _, kv := range span.Attributes() {
+			if kv.Key == CoalescedKey {
+				coalesced = kv.Value.AsBool()
+			}
+		}
+		if !coalesced {
+			t.Errorf("span %s is not coalesced", span.Name())
+		}
+	}
+
+	// a later request is not coalesced with the finished one
+	if _, err := c.Get(context.Background(), Request{Path: WeatherV2, Cep: "39408078"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("%d calls, want 2", n)
+	}
+}
@@ -0,0 +1,205 @@
+package servicob
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attributes of the spans of the hedged calls.
+const (
+	HedgedKey     = attribute.Key("servicob.hedged")
+	HedgeDelayKey = attribute.Key("servicob.hedge_delay_ms")
+	WinnerKey     = attribute.Key("servicob.winner")
+	// AttemptKey is the attempt of the span of a hedged call: primary or hedge.
+	AttemptKey = attribute.Key("servicob.attempt")
+)
+
+// HedgeConfig configures the hedged requests.
+type HedgeConfig struct {
+	// Enabled enables the hedged requests.
+	Enabled bool
+	// The hedged request is sent when the first one has taken longer than Percentile of
+	// the latencies of the last Window successful calls, bounded by MinDelay and MaxDelay,
+	// or than InitialDelay while fewer than MinSamples were observed.
+	Percentile   float64
+	Window       int
+	MinSamples   int
+	InitialDelay time.Duration
+	MinDelay     time.Duration
+	MaxDelay     time.Duration
+}
+
+// DefaultHedgeConfig returns the disabled hedging configuration, hedging at the p95 of
+// the last 256 calls.
+func DefaultHedgeConfig() HedgeConfig {
+	return HedgeConfig{
+		Percentile:   0.95,
+		Window:       256,
+		MinSamples:   20,
+		InitialDelay: time.Second,
+		MinDelay:     20 * time.Millisecond,
+		MaxDelay:     5 * time.Second,
+	}
+}
+
+// hedged is the ServiceBClient returned by Hedged.
+type hedged struct {
+	client    ServiceBClient
+	cfg       HedgeConfig
+	latencies *latencies
+}
+
+// Hedged returns a ServiceBClient that sends the requests to client and, if the first
+// request has not been answered within the hedging delay of cfg, or has failed, sends
+// a second one, the hedge, returning the first successful response. The other request
+// is canceled. A Balanced client sends the hedge to another instance than the first
+// request, and fails it with ErrNoInstances if there is no other.
+//
+// Each request is sent in a child span of its own, servicob attempt, where a Balanced
+// client records the instance it picked.
+//
+// A response is successful if its status is below 500 and it is not a 408 or a 429.
+// If both requests fail, the response of the first is returned, or the error of the
+// first to fail when there is no response.
+func Hedged(client ServiceBClient, cfg HedgeConfig) ServiceBClient {
+	return &hedged{client: client, cfg: cfg, latencies: newLatencies(cfg.Window)}
+}
+
+type attempt struct {
+	name string
+	res  *Response
+	err  error
+}
+
+// preferredTo reports whether the failed attempt a is returned rather than the failed
+// attempt b: a response is preferred to an error, and the primary response to the hedge.
+func (a attempt) preferredTo(b attempt) bool {
+	return a.res != nil && (b.res == nil || a.name == "primary")
+}
+
+func (h *hedged) Get(ctx context.Context, req Request) (*Response, error) {
+	span := trace.SpanFromContext(ctx)
+	ctx, cancel := context.WithCancel(withTried(ctx))
+	defer cancel()
+
+	attempts := make(chan attempt, 2)
+	tracer := span.TracerProvider().Tracer("microservice-tracer")
+	send := func(name string) {
+		ctx, attemptSpan := tracer.Start(ctx, "servicob attempt", trace.WithAttributes(AttemptKey.String(name)))
+		defer attemptSpan.End()
+		start := time.Now()
+		res, err := h.client.Get(ctx, req)
+		if succeeded(res, err) {
+			h.latencies.add(time.Since(start))
+		}
+		switch {
+		case err != nil:
+			attemptSpan.RecordError(err)
+		case res != nil:
+			attemptSpan.SetAttributes(StatusCodeKey.Int(res.StatusCode))
+		}
+		attempts <- attempt{name: name, res: res, err: err}
+	}
+	go send("primary")
+
+	delay := h.delay()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	hedgeAfter := timer.C
+	sendHedge := func(reason string) {
+		hedgeAfter = nil
+		span.AddEvent("servicob.hedge", trace.WithAttributes(
+			HedgeDelayKey.Int64(delay.Milliseconds()),
+			attribute.String("reason", reason),
+		))
+		go send("hedge")
+	}
+
+	var failed *attempt
+	for pending := 1; pending > 0; {
+		select {
+		case <-hedgeAfter:
+			pending++
+			sendHedge("delay")
+		case a := <-attempts:
+			pending--
+			if succeeded(a.res, a.err) {
+				span.SetAttributes(HedgedKey.Bool(hedgeAfter == nil), WinnerKey.String(a.name))
+				return a.res, nil
+			}
+			if failed == nil || a.preferredTo(*failed) {
+				failed = &a
+			}
+			if hedgeAfter != nil {
+				pending++
+				sendHedge("failure")
+			}
+		}
+	}
+	span.SetAttributes(HedgedKey.Bool(true))
+	return failed.res, failed.err
+}
+
+// delay returns how long to wait for the primary before hedging.
+func (h *hedged) delay() time.Duration {
+	d, ok := h.latencies.percentile(h.cfg.Percentile, h.cfg.MinSamples)
+	if !ok {
+		return h.cfg.InitialDelay
+	}
+	return min(max(d, h.cfg.MinDelay), h.cfg.MaxDelay)
+}
+
+// succeeded reports whether a servicob call returned a response that is not worth
+// retrying on another instance.
+func succeeded(res *Response, err error) bool {
+	if err != nil || res == nil {
+		return false
+	}
+	switch res.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return res.StatusCode < http.StatusInternalServerError
+}
+
+// latencies keeps the last latencies observed.
+type latencies struct {
+	mu     sync.Mutex
+	values []time.Duration
+	next   int
+}
+
+func newLatencies(window int) *latencies {
+	return &latencies{values: make([]time.Duration, 0, max(window, 1))}
+}
+
+func (l *latencies) add(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.values) < cap(l.values) {
+		l.values = append(l.values, d)
+		return
+	}
+	l.values[l.next] = d
+	l.next = (l.next + 1) % len(l.values)
+}
+
+// percentile returns the p percentile of the latencies, or false if there are fewer
+// than minSamples of them.
+func (l *latencies) percentile(p float64, minSamples int) (time.Duration, bool) {
+	l.mu.Lock()
+	values := slices.Clone(l.values)
+	l.mu.Unlock()
+	if len(values) == 0 || len(values) < minSamples {
+		return 0, false
+	}
+	slices.Sort(values)
+	i := int(p*float64(len(values)) + 0.5)
+	return values[min(max(i-1, 0), len(values)-1)], true
+}
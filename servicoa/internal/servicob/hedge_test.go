@@ -0,0 +1,234 @@
+package servicob
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instance is a fake servicob instance answering with res or err after delay, unless
+// the request is canceled first.
+type instance struct {
+	delay time.Duration
+	res   *Response
+	err   error
+	calls atomic.Int32
+}
+
+func (i *instance) Get(ctx context.Context, req Request) (*Response, error) {
+	i.calls.Add(1)
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(i.delay):
+		return i.res, i.err
+	}
+}
+
+// pair is a ServiceBClient sending the first request of a hedged call to primary and
+// the hedge to hedge, as a Balanced client sends them to two instances.
+type pair struct {
+	primary, hedge *instance
+}
+
+func (p pair) Get(ctx context.Context, req Request) (*Response, error) {
+	t := ctx.Value(triedKey{}).(*tried)
+	t.mu.Lock()
+	first := len(t.urls) == 0
+	t.urls = append(t.urls, "")
+	t.mu.Unlock()
+	if first {
+		return p.primary.Get(ctx, req)
+	}
+	return p.hedge.Get(ctx, req)
+}
+
+func TestHedged(t *testing.T) {
+	primaryOK := &Response{StatusCode: http.StatusOK, Body: []byte("primary")}
+	hedgeOK := &Response{StatusCode: http.StatusOK, Body: []byte("hedge")}
+	unavailable := &Response{StatusCode: http.StatusServiceUnavailable, Body: []byte("primary unavailable")}
+	tests := []struct {
+		name       string
+		primary    *instance
+		hedge      *instance
+		want       string
+		wantErr    bool
+		wantHedged bool
+		wantWinner string
+	}{
+		{
+			name:       "primary in time",
+			primary:    &instance{delay: 5 * time.Millisecond, res: primaryOK},
+			hedge:      &instance{res: hedgeOK},
+			want:       "primary",
+			wantWinner: "primary",
+		},
+		{
+			name:       "primary slow",
+			primary:    &instance{delay: time.Second, res: primaryOK},
+			hedge:      &instance{delay: 5 * time.Millisecond, res: hedgeOK},
+			want:       "hedge",
+			wantHedged: true,
+			wantWinner: "hedge",
+		},
+		{
+			name:       "primary fails before the delay",
+			primary:    &instance{res: unavailable},
+			hedge:      &instance{res: hedgeOK},
+			want:       "hedge",
+			wantHedged: true,
+			wantWinner: "hedge",
+		},
+		{
+			name:       "both fail",
+			primary:    &instance{res: unavailable},
+			hedge:      &instance{err: errors.New("connection refused")},
+			want:       "primary unavailable",
+			wantHedged: true,
+		},
+		{
+			name:       "both unreachable",
+			primary:    &instance{err: errors.New("connection refused")},
+			hedge:      &instance{err: errors.New("connection refused")},
+			wantErr:    true,
+			wantHedged: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultHedgeConfig()
+			cfg.InitialDelay = 50 * time.Millisecond
+			c := Hedged(pair{primary: tt.primary, hedge: tt.hedge}, cfg)
+
+			spans := tracetest.NewSpanRecorder()
+			ctx, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)).Tracer("test").Start(context.Background(), "caller")
+			got, err := c.Get(ctx, Request{Path: WeatherV2, Cep: "39408078"})
+			span.End()
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != nil && string(got.Body) != tt.want {
+				t.Errorf("Get() body = %q, want %q", got.Body, tt.want)
+			}
+			attrs := map[attribute.Key]attribute.Value{}
+			for _, s := range spans.Ended() {
+				if s.Name() == "caller" {
+					for _, kv := range s.Attributes() {
+						attrs[kv.Key] = kv.Value
+					}
+				}
+			}
+			if attrs[HedgedKey].AsBool() != tt.wantHedged {
+				t.Errorf("%s = %v, want %v", HedgedKey, attrs[HedgedKey].AsBool(), tt.wantHedged)
+			}
+			if attrs[WinnerKey].AsString() != tt.wantWinner {
+				t.Errorf("%s = %q, want %q", WinnerKey, attrs[WinnerKey].AsString(), tt.wantWinner)
+			}
+			if calls := tt.hedge.calls.Load(); (calls > 0) != tt.wantHedged {
+				t.Errorf("%d hedged calls, want hedged %v", calls, tt.wantHedged)
+			}
+		})
+	}
+}
+
+func TestHedged_Delay(t *testing.T) {
+	cfg := DefaultHedgeConfig()
+	cfg.MinSamples = 10
+	h := Hedged(nil, cfg).(*hedged)
+	if got := h.delay(); got != cfg.InitialDelay {
+		t.Errorf("delay() = %v without samples, want %v", got, cfg.InitialDelay)
+	}
+	for i := 1; i <= 100; i++ {
+		h.latencies.add(time.Duration(i) * time.Millisecond)
+	}
+	if got := h.delay(); got != 95*time.Millisecond {
+		t.Errorf("delay() = %v, want the p95 95ms", got)
+	}
+	for range cfg.Window {
+		h.latencies.add(time.Millisecond)
+	}
+	if got := h.delay(); got != cfg.MinDelay {
+		t.Errorf("delay() = %v, want MinDelay %v", got, cfg.MinDelay)
+	}
+	for range cfg.Window {
+		h.latencies.add(time.Minute)
+	}
+	if got := h.delay(); got != cfg.MaxDelay {
+		t.Errorf("delay() = %v, want MaxDelay %v", got, cfg.MaxDelay)
+	}
+}
+
+func TestHedged_Balanced(t *testing.T) {
+	instances := startInstances(t, 2)
+	// only the second instance answers the slow requests
+	close(instances[1].release)
+	cfg := DefaultHedgeConfig()
+	cfg.InitialDelay = 20 * time.Millisecond
+	c := Hedged(newTestBalanced(t, urlsOf(instances), BalancerConfig{Policy: RoundRobin}), cfg)
+
+	spans := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)).Tracer("test")
+	slow := Request{Path: WeatherV2, Cep: "39408078", Query: map[string][]string{"units": {"slow"}}}
+	for range 4 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		ctx, span := tracer.Start(ctx, "caller")
+		_, err := c.Get(ctx, slow)
+		span.End()
+		cancel()
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+	}
+	if instances[0].hits.Load() == 0 {
+		t.Error("no request was sent first to the slow instance")
+	}
+
+	// each attempt records its instance in its own span, the caller span records none;
+	// the spans of the canceled attempts end after Get returns
+	attempts := map[trace.SpanID]map[string]string{}
+	for deadline := time.Now().Add(time.Second); len(spans.Ended()) < 4+int(instances[0].hits.Load()+instances[1].hits.Load()) && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	for _, s := range spans.Ended() {
+		attrs := map[attribute.Key]attribute.Value{}
+		for _, kv := range s.Attributes() {
+			attrs[kv.Key] = kv.Value
+		}
+		switch s.Name() {
+		case "caller":
+			if _, ok := attrs[InstanceKey]; ok {
+				t.Errorf("the caller span has the %s %s", InstanceKey, attrs[InstanceKey].AsString())
+			}
+		case "servicob attempt":
+			parent := s.Parent().SpanID()
+			if attempts[parent] == nil {
+				attempts[parent] = map[string]string{}
+			}
+			attempts[parent][attrs[AttemptKey].AsString()] = attrs[InstanceKey].AsString()
+		}
+	}
+	hedged := 0
+	for _, byAttempt := range attempts {
+		if byAttempt["primary"] == "" {
+			t.Errorf("attempts %v without the instance of the primary", byAttempt)
+		}
+		if instance, ok := byAttempt["hedge"]; ok {
+			hedged++
+			if instance == "" || instance == byAttempt["primary"] {
+				t.Errorf("the hedge went to %q, the primary to %q", instance, byAttempt["primary"])
+			}
+		}
+	}
+	if hedged == 0 {
+		t.Error("no hedge span")
+	}
+}
@@ -0,0 +1,103 @@
+package servicob
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Resolver returns the base urls of the servicob instances.
+type Resolver func(ctx context.Context) ([]string, error)
+
+// The dns lookups of the resolvers, replaced in tests.
+var (
+	lookupHost = net.DefaultResolver.LookupHost
+	lookupSRV  = net.DefaultResolver.LookupSRV
+)
+
+// NewResolver returns the Resolver of spec, a comma separated list of:
+//
+//   - base urls, e.g. http://servicob:8081
+//   - dns://host:port, resolved to the http urls of the A and AAAA records of host
+//   - dns+srv://name, e.g. dns+srv://_http._tcp.servicob, resolved to the http urls of the
+//     SRV records of name
+func NewResolver(spec string) (Resolver, error) {
+	var resolvers []Resolver
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		u, err := url.Parse(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid servicob url: %w", err)
+		}
+		switch u.Scheme {
+		case "dns":
+			host, port, err := net.SplitHostPort(u.Host)
+			if err != nil {
+				return nil, fmt.Errorf("invalid servicob url %q: %w", item, err)
+			}
+			resolvers = append(resolvers, hostResolver(host, port))
+		case "dns+srv":
+			if u.Host == "" {
+				return nil, fmt.Errorf("invalid servicob url %q", item)
+			}
+			resolvers = append(resolvers, srvResolver(u.Host))
+		case "http", "https":
+			if u.Host == "" {
+				return nil, fmt.Errorf("invalid servicob url %q", item)
+			}
+			resolvers = append(resolvers, func(context.Context) ([]string, error) {
+				return []string{item}, nil
+			})
+		default:
+			return nil, fmt.Errorf("invalid servicob url %q", item)
+		}
+	}
+	if len(resolvers) == 0 {
+		return nil, fmt.Errorf("no servicob url in %q", spec)
+	}
+	return func(ctx context.Context) ([]string, error) {
+		var urls []string
+		for _, resolve := range resolvers {
+			u, err := resolve(ctx)
+			if err != nil {
+				return nil, err
+			}
+			urls = append(urls, u...)
+		}
+		return urls, nil
+	}, nil
+}
+
+func hostResolver(host, port string) Resolver {
+	return func(ctx context.Context) ([]string, error) {
+		addrs, err := lookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		urls := make([]string, len(addrs))
+		for i, addr := range addrs {
+			urls[i] = "http://" + net.JoinHostPort(addr, port)
+		}
+		return urls, nil
+	}
+}
+
+func srvResolver(name string) Resolver {
+	return func(ctx context.Context) ([]string, error) {
+		_, srvs, err := lookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, err
+		}
+		urls := make([]string, len(srvs))
+		for i, srv := range srvs {
+			urls[i] = "http://" + net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port)))
+		}
+		return urls, nil
+	}
+}
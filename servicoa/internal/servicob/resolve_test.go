@@ -0,0 +1,52 @@
+package servicob
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+)
+
+func TestNewResolver(t *testing.T) {
+	oldHost, oldSRV := lookupHost, lookupSRV
+	t.Cleanup(func() { lookupHost, lookupSRV = oldHost, oldSRV })
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		return map[string][]string{"servicob": {"10.0.0.1", "fd00::2"}}[host], nil
+	}
+	lookupSRV = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		return "", []*net.SRV{{Target: "servicob-1.local.", Port: 8081}, {Target: "servicob-2.local.", Port: 8082}}, nil
+	}
+
+	tests := []struct {
+		name    string
+		spec    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "url", spec: "http://servicob:8081", want: []string{"http://servicob:8081"}},
+		{name: "list", spec: "http://servicob-1:8081, http://servicob-2:8081,", want: []string{"http://servicob-1:8081", "http://servicob-2:8081"}},
+		{name: "dns", spec: "dns://servicob:8081", want: []string{"http://10.0.0.1:8081", "http://[fd00::2]:8081"}},
+		{name: "dns srv", spec: "dns+srv://_http._tcp.servicob", want: []string{"http://servicob-1.local:8081", "http://servicob-2.local:8082"}},
+		{name: "dns without port", spec: "dns://servicob", wantErr: true},
+		{name: "no scheme", spec: "servicob:8081", wantErr: true},
+		{name: "empty", spec: " , ", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolve, err := NewResolver(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewResolver() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got, err := resolve(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
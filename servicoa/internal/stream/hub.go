@@ -0,0 +1,437 @@
+// Package stream pushes the weather of the ceps clients subscribe to, as Server-Sent
+// Events or over a WebSocket, whenever it changes.
+//
+// The weather changes when servicob observes it, so a Hub follows the watchlist
+// refresher of servicob rather than the weather api. Through a WatchFunc, it adds each
+// streamed cep to the watchlist, whose refresher keeps its weather fresh in the caches
+// of servicob, within the quota of the weather api however many clients stream it.
+// Through a FetchFunc, it looks the cep up once, then polls those caches only, every
+// Config.Interval: the polls never call ViaCEP or the weather api, and the interval
+// only bounds how late a change is pushed. The polls go through the client of the
+// requests, with its balancing, hedging and coalescing; a change feed from servicob
+// would need a connection to every instance, and their observations of cities mapped
+// back to ceps.
+//
+// Event ids grow across all the ceps, so a client reconnecting with the last id it
+// received only gets the weather of the ceps that changed since. They start at the
+// time the Hub was created, so they keep growing across restarts.
+//
+// The load on servicob is bounded: at most Config.MaxTopics ceps are polled, by at
+// most Config.MaxPolls concurrent requests.
+package stream
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/shared"
+)
+
+// The types of the events.
+const (
+	// EventWeather carries the TempResponse of the cep, as servicob encodes it in json.
+	EventWeather = "weather"
+	// EventError carries an ErrorData, when servicob does not know the cep.
+	EventError = "error"
+)
+
+// ErrTooManyCeps is returned when a subscription would exceed Config.MaxCeps.
+var ErrTooManyCeps = errors.New("too many ceps")
+
+// ErrTooManyTopics is returned when a subscription would make the Hub poll more than
+// Config.MaxTopics ceps.
+var ErrTooManyTopics = errors.New("too many ceps streamed")
+
+// Event is an update of the weather of Cep. Data is json.
+type Event struct {
+	ID   uint64
+	Cep  string
+	Type string
+	Data []byte
+}
+
+// ErrorData is the data of the EventError events.
+type ErrorData struct {
+	Cep     string `json:"cep"`
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// FetchFunc gets the current weather of cep from servicob, as json, sending etag as
+// If-None-Match. If cached, servicob only reads its caches, answering 504 if the weather
+// is not there. It returns the status of the response, 304 if the weather did not
+// change, and its ETag. err is set when servicob could not be reached.
+type FetchFunc func(ctx context.Context, cep, etag string, cached bool) (data []byte, newEtag string, status int, err error)
+
+// WatchFunc adds cep to the watchlist of servicob, so its weather is kept fresh in the
+// cache. It returns the function removing it, called when the cep is no longer
+// streamed, or nil if it was already watched. unwatch must not use ctx, which may be
+// done by then.
+type WatchFunc func(ctx context.Context, cep string) (unwatch func(), err error)
+
+// Config configures a Hub.
+type Config struct {
+	// Interval is the period of the polls of the weather of each cep.
+	Interval time.Duration
+	// Heartbeat is the period of the heartbeats sent to idle connections, so proxies
+	// do not close them and clients notice dead ones.
+	Heartbeat time.Duration
+	// MaxCeps bounds the ceps of each subscription.
+	MaxCeps int
+	// MaxTopics bounds the ceps polled for all the subscriptions.
+	MaxTopics int
+	// MaxPolls bounds the concurrent polls.
+	MaxPolls int
+	// Buffer is how many events a subscription may lag behind before it is dropped;
+	// its client reconnects with Last-Event-ID.
+	Buffer int
+	// Retry is the reconnection delay advised to the SSE clients.
+	Retry time.Duration
+}
+
+// DefaultConfig polls every 30 seconds, at most 100 ceps with 4 concurrent polls, and
+// allows 10 ceps per subscription.
+func DefaultConfig() Config {
+	return Config{
+		Interval:  30 * time.Second,
+		Heartbeat: 15 * time.Second,
+		MaxCeps:   10,
+		MaxTopics: 100,
+		MaxPolls:  4,
+		Buffer:    16,
+		Retry:     5 * time.Second,
+	}
+}
+
+// ConfigFromEnv returns the DefaultConfig with the STREAM_INTERVAL, STREAM_HEARTBEAT,
+// STREAM_MAX_CEPS, STREAM_MAX_TOPICS and STREAM_MAX_POLLS environment variables, if
+// set.
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
+	for name, d := range map[string]*time.Duration{"STREAM_INTERVAL": &cfg.Interval, "STREAM_HEARTBEAT": &cfg.Heartbeat} {
+		if v := os.Getenv(name); v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil || parsed <= 0 {
+				return Config{}, fmt.Errorf("invalid %s %q", name, v)
+			}
+			*d = parsed
+		}
+	}
+	for name, n := range map[string]*int{"STREAM_MAX_CEPS": &cfg.MaxCeps, "STREAM_MAX_TOPICS": &cfg.MaxTopics, "STREAM_MAX_POLLS": &cfg.MaxPolls} {
+		if v := os.Getenv(name); v != "" {
+			parsed, err := strconv.Atoi(v)
+			if err != nil || parsed <= 0 {
+				return Config{}, fmt.Errorf("invalid %s %q", name, v)
+			}
+			*n = parsed
+		}
+	}
+	return cfg, nil
+}
+
+// Hub polls the weather of the ceps with subscribers and publishes its changes. It is
+// safe for concurrent use.
+type Hub struct {
+	cfg   Config
+	fetch FetchFunc
+	watch WatchFunc
+	ctx   context.Context
+	// polling holds a token for each poll in progress.
+	polling chan struct{}
+
+	mu sync.Mutex
+	// lastID starts before the time the Hub was created, in microseconds, so the ids
+	// are above the ones of the Hubs created before.
+	lastID uint64
+	topics map[string]*topic
+	// polls tracks the pollers, so tests can wait for them.
+	polls sync.WaitGroup
+}
+
+// topic is a cep with subscribers, and its last event.
+type topic struct {
+	subs   map[*Subscription]bool
+	latest *Event
+	// observedAt is the observed_at of the latest weather, so the older weather still
+	// cached by another servicob instance is not published after it.
+	observedAt time.Time
+	cancel     context.CancelFunc
+}
+
+// NewHub returns a Hub polling with fetch until ctx is done. It watches the ceps polled
+// with watch, unless it is nil.
+func NewHub(ctx context.Context, cfg Config, fetch FetchFunc, watch WatchFunc) *Hub {
+	return &Hub{
+		cfg:     cfg,
+		fetch:   fetch,
+		watch:   watch,
+		ctx:     ctx,
+		polling: make(chan struct{}, cfg.MaxPolls),
+		lastID:  uint64(time.Now().UnixMicro()),
+		topics:  map[string]*topic{},
+	}
+}
+
+// Subscription receives the events of its ceps on Events, until it is closed.
+type Subscription struct {
+	hub    *Hub
+	events chan Event
+	ceps   []string
+	closed bool
+}
+
+// Subscribe returns a subscription to ceps, which first receives the last event of
+// each cep newer than lastEventID, if known; 0 gets them all, as does an id this Hub
+// did not issue, from a Hub with a clock ahead of it. It returns shared.ErrInvalidCep,
+// ErrTooManyCeps if there are more than Config.MaxCeps ceps, or ErrTooManyTopics if
+// the Hub would poll more than Config.MaxTopics ceps.
+func (h *Hub) Subscribe(ceps []string, lastEventID uint64) (*Subscription, error) {
+	s := &Subscription{hub: h, events: make(chan Event, h.cfg.MaxCeps+h.cfg.Buffer)}
+	if err := s.add(ceps, lastEventID); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Events returns the channel of the events of s. It is closed when s is closed, or
+// when s lags more than Config.Buffer events behind.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Ceps returns the canonical ceps of s.
+func (s *Subscription) Ceps() []string {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return slices.Clone(s.ceps)
+}
+
+// Add subscribes s to ceps too, sending their last events.
+func (s *Subscription) Add(ceps ...string) error {
+	return s.add(ceps, 0)
+}
+
+func (s *Subscription) add(ceps []string, lastEventID uint64) error {
+	var canonical []string
+	for _, c := range ceps {
+		cep, err := shared.ParseCep(c)
+		if err != nil {
+			return fmt.Errorf("%w: %q", shared.ErrInvalidCep, c)
+		}
+		canonical = append(canonical, cep.Canonical())
+	}
+
+	h := s.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var added []string
+	for _, cep := range canonical {
+		if !slices.Contains(s.ceps, cep) && !slices.Contains(added, cep) {
+			added = append(added, cep)
+		}
+	}
+	if len(s.ceps)+len(added) > h.cfg.MaxCeps {
+		return fmt.Errorf("%w: at most %d per subscription", ErrTooManyCeps, h.cfg.MaxCeps)
+	}
+	if s.closed {
+		return nil
+	}
+	topics := len(h.topics)
+	for _, cep := range added {
+		if _, ok := h.topics[cep]; !ok {
+			topics++
+		}
+	}
+	if topics > h.cfg.MaxTopics {
+		return fmt.Errorf("%w: at most %d", ErrTooManyTopics, h.cfg.MaxTopics)
+	}
+	if lastEventID > h.lastID {
+		lastEventID = 0
+	}
+
+	var latest []Event
+	for _, cep := range added {
+		t, ok := h.topics[cep]
+		if !ok {
+			t = &topic{subs: map[*Subscription]bool{}}
+			var ctx context.Context
+			ctx, t.cancel = context.WithCancel(h.ctx)
+			h.topics[cep] = t
+			h.polls.Add(1)
+			go h.poll(ctx, cep)
+		}
+		t.subs[s] = true
+		if t.latest != nil && t.latest.ID > lastEventID {
+			latest = append(latest, *t.latest)
+		}
+	}
+	s.ceps = append(s.ceps, added...)
+	slices.SortFunc(latest, func(a, b Event) int { return cmp.Compare(a.ID, b.ID) })
+	for _, e := range latest {
+		s.send(e)
+	}
+	return nil
+}
+
+// Remove unsubscribes s from ceps.
+func (s *Subscription) Remove(ceps ...string) {
+	h := s.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, c := range ceps {
+		cep, err := shared.ParseCep(c)
+		if err != nil {
+			continue
+		}
+		if i := slices.Index(s.ceps, cep.Canonical()); i >= 0 {
+			s.ceps = slices.Delete(s.ceps, i, i+1)
+			h.unsubscribe(s, cep.Canonical())
+		}
+	}
+}
+
+// Close unsubscribes s from all its ceps and closes Events.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.close()
+}
+
+// close is Close with the hub locked.
+func (s *Subscription) close() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	for _, cep := range s.ceps {
+		s.hub.unsubscribe(s, cep)
+	}
+	close(s.events)
+}
+
+// send sends e to s with the hub locked, closing s if it lags too far behind.
+func (s *Subscription) send(e Event) {
+	if s.closed {
+		return
+	}
+	select {
+	case s.events <- e:
+	default:
+		slog.Warn("stream subscription dropped: too slow", "ceps", s.ceps)
+		s.close()
+	}
+}
+
+// unsubscribe removes s from the topic of cep with the hub locked, and stops polling
+// cep if it has no subscribers left.
+func (h *Hub) unsubscribe(s *Subscription, cep string) {
+	t, ok := h.topics[cep]
+	if !ok {
+		return
+	}
+	delete(t.subs, s)
+	if len(t.subs) == 0 {
+		t.cancel()
+		delete(h.topics, cep)
+	}
+}
+
+// poll publishes the changes of the weather of cep until ctx is done. The first fetch
+// looks the cep up; once servicob knows it, the cep is watched and the next fetches
+// read the caches of servicob only. When the weather is not cached, e.g. servicob
+// restarted or the poll reached an instance not watching the cep, the next fetch looks
+// it up again and watches it again. A cep servicob does not know is not polled again.
+func (h *Hub) poll(ctx context.Context, cep string) {
+	defer h.polls.Done()
+	var unwatch func()
+	defer func() {
+		if unwatch != nil {
+			unwatch()
+		}
+	}()
+	ticker := time.NewTicker(h.cfg.Interval)
+	defer ticker.Stop()
+	etag := ""
+	cached, watched := false, h.watch == nil
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case h.polling <- struct{}{}:
+		}
+		data, newEtag, status, err := h.fetch(ctx, cep, etag, cached)
+		if err == nil && (status == http.StatusOK || status == http.StatusNotModified) && !watched {
+			u, werr := h.watch(ctx, cep)
+			if werr != nil {
+				slog.Warn("stream watch failed", "cep", cep, "error", werr)
+			} else {
+				watched = true
+				if unwatch == nil {
+					unwatch = u
+				}
+			}
+		}
+		<-h.polling
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			slog.Warn("stream poll failed", "cep", cep, "error", err)
+		case status == http.StatusOK:
+			etag, cached = newEtag, true
+			h.publish(cep, EventWeather, data)
+		case status == http.StatusNotModified:
+			cached = true
+		case status == http.StatusGatewayTimeout && cached:
+			cached, watched = false, h.watch == nil
+		case status == http.StatusNotFound || status == http.StatusUnprocessableEntity:
+			data, _ := json.Marshal(ErrorData{Cep: cep, Status: status, Message: http.StatusText(status)})
+			h.publish(cep, EventError, data)
+			return
+		default:
+			slog.Warn("stream poll failed", "cep", cep, "status", status)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publish sends an event of cep to its subscribers, unless it is the same as the last
+// or its weather was observed before the last.
+func (h *Hub) publish(cep, typ string, data []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, ok := h.topics[cep]
+	if !ok || (t.latest != nil && t.latest.Type == typ && bytes.Equal(t.latest.Data, data)) {
+		return
+	}
+	var observed struct {
+		ObservedAt time.Time `json:"observed_at"`
+	}
+	if typ == EventWeather && json.Unmarshal(data, &observed) == nil {
+		if observed.ObservedAt.Before(t.observedAt) {
+			return
+		}
+		t.observedAt = observed.ObservedAt
+	}
+	h.lastID++
+	e := Event{ID: h.lastID, Cep: cep, Type: typ, Data: data}
+	t.latest = &e
+	for s := range t.subs {
+		s.send(e)
+	}
+}
@@ -0,0 +1,366 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/shared"
+)
+
+// fakeWeather is a FetchFunc serving the weather set by the tests, with its data as
+// ETag, and 404 for the unknown ceps, and a WatchFunc. Like servicob, it answers the
+// cached fetches with 504 until the cep was looked up.
+type fakeWeather struct {
+	mu      sync.Mutex
+	weather map[string]string
+	fetches map[string]int
+	// lookups counts the fetches that were not cached, cached the ceps looked up and
+	// watched the ceps watched.
+	lookups map[string]int
+	cached  map[string]bool
+	watched map[string]bool
+}
+
+func newFakeWeather(weather map[string]string) *fakeWeather {
+	return &fakeWeather{weather: weather, fetches: map[string]int{}, lookups: map[string]int{}, cached: map[string]bool{}, watched: map[string]bool{}}
+}
+
+func (f *fakeWeather) set(cep, data string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.weather[cep] = data
+}
+
+// forget drops cep from the cache and the watchlist, as a restart of servicob does.
+func (f *fakeWeather) forget(cep string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.cached, cep)
+	delete(f.watched, cep)
+}
+
+func (f *fakeWeather) fetch(ctx context.Context, cep, etag string, cached bool) ([]byte, string, int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fetches[cep]++
+	if !cached {
+		f.lookups[cep]++
+	}
+	data, ok := f.weather[cep]
+	switch {
+	case !ok:
+		return nil, "", http.StatusNotFound, nil
+	case cached && !f.cached[cep]:
+		return nil, "", http.StatusGatewayTimeout, nil
+	}
+	f.cached[cep] = true
+	if data == etag {
+		return nil, etag, http.StatusNotModified, nil
+	}
+	return []byte(data), data, http.StatusOK, nil
+}
+
+func (f *fakeWeather) watch(ctx context.Context, cep string) (func(), error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.watched[cep] {
+		return nil, nil
+	}
+	f.watched[cep] = true
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		delete(f.watched, cep)
+	}, nil
+}
+
+func testConfig() Config {
+	cfg := DefaultConfig()
+	cfg.Interval = 5 * time.Millisecond
+	cfg.Heartbeat = 20 * time.Millisecond
+	cfg.MaxCeps = 3
+	cfg.MaxTopics = 4
+	cfg.Buffer = 4
+	return cfg
+}
+
+// next returns the next event of sub, failing the test after a second.
+func next(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+	select {
+	case e, ok := <-sub.Events():
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+	return Event{}
+}
+
+func TestHubPublishesChanges(t *testing.T) {
+	weather := newFakeWeather(map[string]string{"39408078": `{"temp_C":28}`})
+	hub := NewHub(context.Background(), testConfig(), weather.fetch, weather.watch)
+	sub, err := hub.Subscribe([]string{"39408-078", "01001000"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	if got := sub.Ceps(); !reflect.DeepEqual(got, []string{"39408078", "01001000"}) {
+		t.Errorf("Ceps() = %v", got)
+	}
+
+	got := map[string]Event{}
+	for range 2 {
+		e := next(t, sub)
+		got[e.Cep] = e
+	}
+	if e := got["39408078"]; e.Type != EventWeather || string(e.Data) != `{"temp_C":28}` {
+		t.Errorf("event of 39408078 = %+v", e)
+	}
+	if e := got["01001000"]; e.Type != EventError || string(e.Data) != `{"cep":"01001000","status":404,"message":"Not Found"}` {
+		t.Errorf("event of 01001000 = %+v", e)
+	}
+
+	// the polls of the unchanged weather publish nothing
+	time.Sleep(4 * testConfig().Interval)
+	weather.set("39408078", `{"temp_C":29}`)
+	if e := next(t, sub); e.Cep != "39408078" || string(e.Data) != `{"temp_C":29}` {
+		t.Errorf("event after the change = %+v", e)
+	}
+}
+
+func TestHubLastEventID(t *testing.T) {
+	weather := newFakeWeather(map[string]string{"39408078": `{"temp_C":28}`, "01001000": `{"temp_C":20}`})
+	hub := NewHub(context.Background(), testConfig(), weather.fetch, weather.watch)
+	first, _ := hub.Subscribe([]string{"39408078", "01001000"}, 0)
+	defer first.Close()
+	a, b := next(t, first), next(t, first)
+	weather.set(a.Cep, `{"temp_C":30}`)
+	changed := next(t, first)
+
+	tests := []struct {
+		name        string
+		lastEventID uint64
+		want        []uint64
+	}{
+		{name: "new client", lastEventID: 0, want: []uint64{b.ID, changed.ID}},
+		{name: "reconnecting", lastEventID: b.ID, want: []uint64{changed.ID}},
+		{name: "up to date", lastEventID: changed.ID},
+		{name: "id of a hub started before", lastEventID: 1, want: []uint64{b.ID, changed.ID}},
+		{name: "id not issued", lastEventID: changed.ID + 1000, want: []uint64{b.ID, changed.ID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, err := hub.Subscribe([]string{"39408078", "01001000"}, tt.lastEventID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sub.Close()
+			var got []uint64
+			for len(sub.Events()) > 0 {
+				got = append(got, (<-sub.Events()).ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("replayed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHubSubscribeInvalid(t *testing.T) {
+	hub := NewHub(context.Background(), testConfig(), newFakeWeather(map[string]string{}).fetch, nil)
+	tests := []struct {
+		name string
+		ceps []string
+		want error
+	}{
+		{name: "invalid cep", ceps: []string{"39408078", "3940807"}, want: shared.ErrInvalidCep},
+		{name: "too many ceps", ceps: []string{"39408078", "01001000", "20040002", "70040010"}, want: ErrTooManyCeps},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := hub.Subscribe(tt.ceps, 0); !errors.Is(err, tt.want) {
+				t.Errorf("Subscribe() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// repeated ceps count once
+	sub, err := hub.Subscribe([]string{"39408078", "39408-078", "01001000", "20040002"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	if err := sub.Add("70040010"); !errors.Is(err, ErrTooManyCeps) {
+		t.Errorf("Add() over the limit error = %v", err)
+	}
+}
+
+func TestHubMaxTopics(t *testing.T) {
+	hub := NewHub(context.Background(), testConfig(), newFakeWeather(map[string]string{}).fetch, nil)
+	a, err := hub.Subscribe([]string{"39408078", "01001000", "20040002"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	// the ceps already polled do not count
+	b, err := hub.Subscribe([]string{"39408078", "01001000", "70040010"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if _, err := hub.Subscribe([]string{"39408078", "30130010"}, 0); !errors.Is(err, ErrTooManyTopics) {
+		t.Errorf("Subscribe() over the limit error = %v", err)
+	}
+	b.Remove("70040010")
+	if err := b.Add("30130010"); err != nil {
+		t.Errorf("Add() after a cep is no longer polled error = %v", err)
+	}
+}
+
+func TestHubMaxPolls(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxPolls = 1
+	var mu sync.Mutex
+	var polling, most, polls int
+	fetch := func(ctx context.Context, cep, etag string, cached bool) ([]byte, string, int, error) {
+		mu.Lock()
+		polling++
+		most = max(most, polling)
+		polls++
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		polling--
+		mu.Unlock()
+		return nil, "", http.StatusNotModified, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	hub := NewHub(ctx, cfg, fetch, nil)
+	sub, _ := hub.Subscribe([]string{"39408078", "01001000", "20040002"}, 0)
+	defer sub.Close()
+	time.Sleep(10 * cfg.Interval)
+	cancel()
+	hub.polls.Wait()
+
+	if polls < 3 {
+		t.Errorf("%d polls, want at least one per cep", polls)
+	}
+	if most != 1 {
+		t.Errorf("%d concurrent polls, want 1", most)
+	}
+}
+
+func TestHubStopsPolling(t *testing.T) {
+	weather := newFakeWeather(map[string]string{"39408078": `{"temp_C":28}`})
+	hub := NewHub(context.Background(), testConfig(), weather.fetch, weather.watch)
+	a, _ := hub.Subscribe([]string{"39408078"}, 0)
+	b, _ := hub.Subscribe([]string{"39408078"}, 0)
+	next(t, a)
+
+	a.Close()
+	b.Remove("39408-078")
+	hub.polls.Wait()
+	weather.mu.Lock()
+	fetches := weather.fetches["39408078"]
+	weather.mu.Unlock()
+	time.Sleep(4 * testConfig().Interval)
+	weather.mu.Lock()
+	defer weather.mu.Unlock()
+	if weather.fetches["39408078"] != fetches {
+		t.Error("the cep is still polled without subscribers")
+	}
+	if _, ok := <-a.Events(); ok {
+		t.Error("Events() not closed by Close()")
+	}
+}
+
+func TestHubDropsLaggingSubscriptions(t *testing.T) {
+	hub := NewHub(context.Background(), testConfig(), newFakeWeather(map[string]string{}).fetch, nil)
+	hub.topics["39408078"] = &topic{subs: map[*Subscription]bool{}, cancel: func() {}}
+	sub := &Subscription{hub: hub, events: make(chan Event, 2), ceps: []string{"39408078"}}
+	hub.topics["39408078"].subs[sub] = true
+
+	for temp := range 3 {
+		hub.publish("39408078", EventWeather, []byte{byte('0' + temp)})
+	}
+	var got int
+	for range sub.Events() {
+		got++
+	}
+	if got != 2 {
+		t.Errorf("received %d events before the drop, want 2", got)
+	}
+	if _, ok := hub.topics["39408078"]; ok {
+		t.Error("the dropped subscription is still subscribed")
+	}
+}
+
+func TestHubReadsTheCache(t *testing.T) {
+	weather := newFakeWeather(map[string]string{"39408078": `{"temp_C":28}`})
+	hub := NewHub(context.Background(), testConfig(), weather.fetch, weather.watch)
+	sub, err := hub.Subscribe([]string{"39408078", "01001000"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next(t, sub)
+	next(t, sub)
+	state := func() (lookups, unknown, fetches int, watched bool) {
+		weather.mu.Lock()
+		defer weather.mu.Unlock()
+		return weather.lookups["39408078"], weather.fetches["01001000"], weather.fetches["39408078"], weather.watched["39408078"]
+	}
+
+	// one lookup, then the polls read the cache of the watched cep
+	time.Sleep(6 * testConfig().Interval)
+	if lookups, unknown, fetches, watched := state(); lookups != 1 || unknown != 1 || fetches < 3 || !watched {
+		t.Errorf("lookups = %d, fetches of the unknown cep = %d, fetches = %d, watched = %v; want 1 lookup, 1 fetch of the unknown cep, polls and the cep watched", lookups, unknown, fetches, watched)
+	}
+
+	// servicob lost the weather: it is looked up and watched again
+	weather.forget("39408078")
+	weather.set("39408078", `{"temp_C":29}`)
+	if e := next(t, sub); string(e.Data) != `{"temp_C":29}` {
+		t.Errorf("event after the lookup = %+v", e)
+	}
+	if lookups, _, _, watched := state(); lookups != 2 || !watched {
+		t.Errorf("lookups = %d, watched = %v; want 2 and the cep watched again", lookups, watched)
+	}
+
+	sub.Close()
+	hub.polls.Wait()
+	if _, _, _, watched := state(); watched {
+		t.Error("the cep is still watched without subscribers")
+	}
+}
+
+func TestHubSkipsOlderObservations(t *testing.T) {
+	hub := NewHub(context.Background(), testConfig(), newFakeWeather(map[string]string{}).fetch, nil)
+	hub.topics["39408078"] = &topic{subs: map[*Subscription]bool{}, cancel: func() {}}
+	sub := &Subscription{hub: hub, events: make(chan Event, 4), ceps: []string{"39408078"}}
+	hub.topics["39408078"].subs[sub] = true
+
+	// the second weather is still cached by an instance that does not watch the cep
+	for _, data := range []string{
+		`{"temp_C":28,"observed_at":"2026-10-19T12:15:00Z"}`,
+		`{"temp_C":27,"observed_at":"2026-10-19T12:00:00Z"}`,
+		`{"temp_C":29,"observed_at":"2026-10-19T12:30:00Z"}`,
+	} {
+		hub.publish("39408078", EventWeather, []byte(data))
+	}
+	var got []string
+	for len(sub.Events()) > 0 {
+		got = append(got, string((<-sub.Events()).Data))
+	}
+	want := []string{`{"temp_C":28,"observed_at":"2026-10-19T12:15:00Z"}`, `{"temp_C":29,"observed_at":"2026-10-19T12:30:00Z"}`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,119 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/shared"
+)
+
+// errNoCeps rejects the streams without ceps.
+var errNoCeps = errors.New("cep is required")
+
+// ServeSSE streams the events of the ceps of the cep query parameters, repeated or
+// separated by commas, as Server-Sent Events: the id, the type (weather or error) and
+// the json data of each event. A comment is sent every Config.Heartbeat.
+//
+// Clients reconnecting with the Last-Event-ID header, as EventSource does, only get
+// the ceps whose weather changed since that event. The invalid ceps, the missing ones
+// and more than Config.MaxCeps ceps are rejected with 422; more ceps than the Hub
+// polls, with 503.
+func (h *Hub) ServeSSE(w http.ResponseWriter, r *http.Request) {
+	ceps := QueryCeps(r)
+	if len(ceps) == 0 {
+		h.writeSubscribeError(w, errNoCeps)
+		return
+	}
+	sub, err := h.Subscribe(ceps, LastEventID(r))
+	if err != nil {
+		h.writeSubscribeError(w, err)
+		return
+	}
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	// disables the buffering of nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", h.cfg.Retry.Milliseconds())
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(h.cfg.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			writeEvent(w, e)
+		case <-heartbeat.C:
+			io.WriteString(w, ": heartbeat\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes e in the text/event-stream format, one data line per line of its
+// data.
+func writeEvent(w io.Writer, e Event) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\n", e.ID, e.Type)
+	for _, line := range bytes.Split(bytes.TrimRight(e.Data, "\n"), []byte("\n")) {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	io.WriteString(w, "\n")
+}
+
+// QueryCeps returns the ceps of the cep query parameters of r, which may be repeated or
+// separated by commas.
+func QueryCeps(r *http.Request) []string {
+	var ceps []string
+	for _, v := range r.URL.Query()["cep"] {
+		for _, cep := range strings.Split(v, ",") {
+			if cep = strings.TrimSpace(cep); cep != "" {
+				ceps = append(ceps, cep)
+			}
+		}
+	}
+	return ceps
+}
+
+// LastEventID returns the id of the Last-Event-ID header of r, or of its last_event_id
+// query parameter for the clients that can not set headers; 0 if there is none.
+func LastEventID(r *http.Request) uint64 {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("last_event_id")
+	}
+	id, _ := strconv.ParseUint(v, 10, 64)
+	return id
+}
+
+// writeSubscribeError writes the plain text error of a subscription rejected by
+// Subscribe. The subscriptions over Config.MaxTopics are retried after a poll
+// interval.
+func (h *Hub) writeSubscribeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, shared.ErrInvalidCep), errors.Is(err, ErrTooManyCeps), errors.Is(err, errNoCeps):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, ErrTooManyTopics):
+		w.Header().Set("Retry-After", strconv.Itoa(max(1, int(h.cfg.Interval.Seconds()))))
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,208 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func newTestServer(t *testing.T, weather *fakeWeather) (*httptest.Server, *Hub) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	hub := NewHub(ctx, testConfig(), weather.fetch, weather.watch)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stream", hub.ServeSSE)
+	mux.HandleFunc("GET /stream/ws", hub.ServeWebSocket)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		srv.CloseClientConnections()
+		srv.Close()
+		cancel()
+	})
+	return srv, hub
+}
+
+// readSSE reads the lines of the stream of res until it read n events.
+func readSSE(t *testing.T, res *http.Response, n int) []string {
+	t.Helper()
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	var got []string
+	for n > 0 {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("stream ended after %q", got)
+			}
+			got = append(got, line)
+			if strings.HasPrefix(line, "data: ") {
+				n--
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("stream stalled after %q", got)
+		}
+	}
+	return got
+}
+
+func TestServeSSE(t *testing.T) {
+	weather := newFakeWeather(map[string]string{"39408078": `{"temp_C":28}`})
+	srv, _ := newTestServer(t, weather)
+
+	res, err := http.Get(srv.URL + "/stream?cep=39408-078")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status %d, content type %q", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	got := readSSE(t, res, 1)
+	id := strings.TrimPrefix(got[2], "id: ")
+	want := []string{"retry: 5000", "", "id: " + id, "event: weather", `data: {"temp_C":28}`}
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("stream = %q, want %q", got, want)
+	}
+
+	// a reconnecting client only gets the newer events
+	weather.set("39408078", `{"temp_C":29}`)
+	time.Sleep(4 * testConfig().Interval)
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/stream?cep=39408078", nil)
+	req.Header.Set("Last-Event-ID", id)
+	again, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Body.Close()
+	if got := readSSE(t, again, 1); got[len(got)-1] != `data: {"temp_C":29}` {
+		t.Errorf("stream after Last-Event-ID = %q", got)
+	}
+}
+
+func TestServeSSEHeartbeat(t *testing.T) {
+	srv, _ := newTestServer(t, newFakeWeather(map[string]string{"39408078": `{"temp_C":28}`}))
+	res, err := http.Get(srv.URL + "/stream?cep=39408078")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		if scanner.Text() == ": heartbeat" {
+			return
+		}
+	}
+	t.Error("no heartbeat")
+}
+
+func TestServeSSERejected(t *testing.T) {
+	srv, _ := newTestServer(t, newFakeWeather(map[string]string{}))
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "no cep", query: ""},
+		{name: "invalid cep", query: "?cep=3940807"},
+		{name: "too many ceps", query: "?cep=39408078,01001000&cep=20040002&cep=70040010"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := http.Get(srv.URL + "/stream" + tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if res.StatusCode != http.StatusUnprocessableEntity {
+				t.Errorf("status = %d, want 422", res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestServeSSETooManyTopics(t *testing.T) {
+	srv, hub := newTestServer(t, newFakeWeather(map[string]string{}))
+	sub, err := hub.Subscribe([]string{"39408078", "01001000", "20040002"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	res, err := http.Get(srv.URL + "/stream?cep=70040010,30130010")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable || res.Header.Get("Retry-After") != "1" {
+		t.Errorf("status = %d, Retry-After %q, want 503 and 1", res.StatusCode, res.Header.Get("Retry-After"))
+	}
+}
+
+func TestServeWebSocket(t *testing.T) {
+	weather := newFakeWeather(map[string]string{"39408078": `{"temp_C":28}`, "01001000": `{"temp_C":20}`})
+	srv, _ := newTestServer(t, weather)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/stream/ws?cep=39408078", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	read := func() Message {
+		t.Helper()
+		var msg Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	if msg := read(); msg.Event != EventWeather || msg.Cep != "39408078" || string(msg.Data) != `{"temp_C":28}` {
+		t.Errorf("first message = %+v", msg)
+	}
+
+	tests := []struct {
+		name string
+		cmd  any
+		want Message
+	}{
+		{name: "subscribe", cmd: Command{Action: "subscribe", Ceps: []string{"01001-000"}}, want: Message{Event: EventSubscribed, Ceps: []string{"39408078", "01001000"}}},
+		{name: "unsubscribe", cmd: Command{Action: "unsubscribe", Ceps: []string{"39408078"}}, want: Message{Event: EventSubscribed, Ceps: []string{"01001000"}}},
+		{name: "invalid cep", cmd: Command{Action: "subscribe", Ceps: []string{"0100100"}}, want: Message{Event: EventRejected, Message: `invalid zipcode: "0100100"`}},
+		{name: "unknown action", cmd: map[string]any{"action": "list"}, want: Message{Event: EventRejected, Message: "unknown action, use subscribe or unsubscribe"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := conn.WriteJSON(tt.cmd); err != nil {
+				t.Fatal(err)
+			}
+			msg := read()
+			// the weather of the new cep may come before the answer
+			if msg.Event == EventWeather {
+				msg = read()
+			}
+			if !reflect.DeepEqual(msg, tt.want) {
+				t.Errorf("answer = %+v, want %+v", msg, tt.want)
+			}
+		})
+	}
+
+	weather.set("01001000", `{"temp_C":21}`)
+	for {
+		msg := read()
+		if msg.Event == EventWeather && string(msg.Data) == `{"temp_C":21}` {
+			break
+		}
+	}
+}
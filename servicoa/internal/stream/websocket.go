@@ -0,0 +1,157 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxCommandBytes bounds the messages of the websocket clients.
+const maxCommandBytes = 4 << 10
+
+// Command is a message of a websocket client: subscribe or unsubscribe Ceps.
+type Command struct {
+	Action string   `json:"action"`
+	Ceps   []string `json:"ceps"`
+}
+
+// Message is a message to a websocket client: an event, with its id, cep and data; or
+// the answer to a Command: subscribed, with all the ceps of the connection, or
+// rejected, with the reason.
+type Message struct {
+	ID      uint64          `json:"id,omitempty"`
+	Event   string          `json:"event"`
+	Cep     string          `json:"cep,omitempty"`
+	Ceps    []string        `json:"ceps,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Message string          `json:"message,omitempty"`
+}
+
+// The events of the answers to the commands.
+const (
+	EventSubscribed = "subscribed"
+	EventRejected   = "rejected"
+)
+
+var upgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 4096}
+
+// ServeWebSocket streams the events of a subscription over a websocket, as json
+// Messages. The subscription starts with the cep query parameters, like ServeSSE, and
+// the last_event_id query parameter; then the client changes it with Commands, such as
+// {"action": "subscribe", "ceps": ["01001000"]}, answered by a subscribed or rejected
+// Message.
+//
+// The connection is pinged every Config.Heartbeat, and closed if the client does not
+// answer within two heartbeats. As the websocket defaults, only the pages of the same
+// origin can connect from a browser.
+func (h *Hub) ServeWebSocket(w http.ResponseWriter, r *http.Request) {
+	sub, err := h.Subscribe(QueryCeps(r), LastEventID(r))
+	if err != nil {
+		h.writeSubscribeError(w, err)
+		return
+	}
+	defer sub.Close()
+
+	conn, err := upgrader.Upgrade(hijacker{w}, r, nil)
+	if err != nil {
+		// the upgrader already answered
+		return
+	}
+	defer conn.Close()
+
+	// done stops readCommands before conn is closed, so it does not block sending a
+	// command nobody receives
+	done := make(chan struct{})
+	defer close(done)
+	commands := make(chan Command)
+	go readCommands(conn, h.cfg.Heartbeat, commands, done)
+
+	heartbeat := time.NewTicker(h.cfg.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		var msg Message
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"), time.Now().Add(time.Second))
+				return
+			}
+			msg = Message{ID: e.ID, Event: e.Type, Cep: e.Cep, Data: e.Data}
+		case cmd, ok := <-commands:
+			if !ok {
+				return
+			}
+			msg = h.run(sub, cmd)
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(h.cfg.Heartbeat)); err != nil {
+				return
+			}
+			continue
+		}
+		conn.SetWriteDeadline(time.Now().Add(h.cfg.Heartbeat))
+		if err := conn.WriteJSON(msg); err != nil {
+			return
+		}
+	}
+}
+
+// run runs the command of the client of sub, returning the answer.
+func (h *Hub) run(sub *Subscription, cmd Command) Message {
+	switch cmd.Action {
+	case "subscribe":
+		if err := sub.Add(cmd.Ceps...); err != nil {
+			return Message{Event: EventRejected, Message: err.Error()}
+		}
+	case "unsubscribe":
+		sub.Remove(cmd.Ceps...)
+	default:
+		return Message{Event: EventRejected, Message: "unknown action, use subscribe or unsubscribe"}
+	}
+	return Message{Event: EventSubscribed, Ceps: sub.Ceps()}
+}
+
+// readCommands reads the commands of the client of conn until it fails or done is
+// closed, closing commands. The client must answer the pings of the heartbeat.
+func readCommands(conn *websocket.Conn, heartbeat time.Duration, commands chan<- Command, done <-chan struct{}) {
+	defer close(commands)
+	conn.SetReadLimit(maxCommandBytes)
+	conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+	})
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				slog.Info("websocket closed", "error", err)
+			}
+			return
+		}
+		var cmd Command
+		if err := json.Unmarshal(msg, &cmd); err != nil {
+			// rejected as an unknown action
+			cmd = Command{}
+		}
+		select {
+		case commands <- cmd:
+		case <-done:
+			return
+		}
+	}
+}
+
+// hijacker exposes the Hijack of the ResponseWriters wrapping the one of the server,
+// such as the one of apiversion, to the websocket upgrader.
+type hijacker struct {
+	http.ResponseWriter
+}
+
+func (h hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(h.ResponseWriter).Hijack()
+}
@@ -2,14 +2,16 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"io"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
-	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,18 +19,28 @@ import (
 	"google.golang.org/grpc/credentials/insecure"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"go.opentelemetry.io/otel/trace"
 
 	"log"
-	"net"
 
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2-servicoa/internal/api"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2-servicoa/internal/request"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2-servicoa/internal/servicob"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2-servicoa/internal/stream"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/apiversion"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/endpoint"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/openapi"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/render"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/shared"
 	"github.com/openzipkin/zipkin-go"
-	"github.com/openzipkin/zipkin-go/model"
 
 	zipkinhttp "github.com/openzipkin/zipkin-go/middleware/http"
 	httpreporter "github.com/openzipkin/zipkin-go/reporter/http"
@@ -38,17 +50,33 @@ type ceprequest struct {
 	Cep string `json:"cep"`
 }
 
-func (c ceprequest) validate() error {
-	r, _ := regexp.Compile("^[0-9]{8}$")
-	if !r.MatchString(c.Cep) {
-		return errors.New("invalid zipcode")
+// validate checks the cep with shared.ParseCep, which also accepts dashes, dots and
+// spaces as servicob does, and replaces it by its canonical 8 digit form.
+func (c *ceprequest) validate() error {
+	cep, err := shared.ParseCep(c.Cep)
+	if err != nil {
+		return err
 	}
+	c.Cep = cep.Canonical()
 
 	return nil
 }
 
 var OtelTracer trace.Tracer
-var zipkinClient *zipkinhttp.Client
+
+// servicobClient calls servicob. It is built by servicob.NewServiceBClient, and replaced
+// by fakes in tests.
+var servicobClient servicob.ServiceBClient
+
+// The api versions, as in servicob. v1, and the unversioned routes of the first
+// releases, are deprecated in favour of v2.
+var (
+	v1            = apiversion.Version{Name: "v1"}.Deprecate(apiDeprecated, apiSunset)
+	v2            = apiversion.Version{Name: "v2"}
+	unversioned   = v2.Deprecate(apiDeprecated, apiSunset)
+	apiDeprecated = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	apiSunset     = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+)
 
 func initOtel(ctx context.Context) {
 
@@ -85,6 +113,16 @@ func initOtel(ctx context.Context) {
 	otel.SetTextMapPropagator(propagation.TraceContext{})
 
 	OtelTracer = otel.Tracer("microservice-tracer")
+
+	metricExporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithGRPCConn(conn))
+	if err != nil {
+		slog.Error("Metric Exporter", "failed to create metric exporter: %w", err)
+	}
+	meterProvider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
+	)
+	otel.SetMeterProvider(meterProvider)
 }
 
 func main() {
@@ -99,7 +137,7 @@ func main() {
 
 	// init zipkin
 	reporter := httpreporter.NewReporter("http://zipkin-all-in-one:9411/api/v2/spans")
-	localEndpoint := &model.Endpoint{ServiceName: "servicoa", IPv4: getOutboundIP(), Port: 8080}
+	localEndpoint := endpoint.Local("servicoa", 8080)
 	sampler, err := zipkin.NewCountingSampler(1)
 	if err != nil {
 		log.Fatal(err)
@@ -114,23 +152,57 @@ func main() {
 	}
 	// end of initzipkin
 
-	ctx = context.Background()
-	ctx, span := OtelTracer.Start(ctx, "iniciando Servico A")
+	startCtx, span := OtelTracer.Start(context.Background(), "iniciando Servico A")
 	defer span.End()
 
-	zipkinClient, err = zipkinhttp.NewClient(tracer, zipkinhttp.ClientTrace(true))
+	servicobConfig, err := servicob.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	servicobClient, err = servicob.NewServiceBClient(startCtx, servicobConfig, servicob.WithRoundTripper(func(rt http.RoundTripper) (http.RoundTripper, error) {
+		return zipkinhttp.NewTransport(tracer, zipkinhttp.RoundTripper(rt), zipkinhttp.TransportTrace(true))
+	}))
 	if err != nil {
 		log.Fatalf("unable to create client: %+v\n", err)
 	}
 
+	doc, err := openapi.Load(api.Spec)
+	if err != nil {
+		log.Fatalf("invalid openapi spec: %v", err)
+	}
+	validator, err := openapi.NewValidator(doc, rejectRequest)
+	if err != nil {
+		log.Fatal(err)
+	}
+	validator.ValidateResponses = os.Getenv("OPENAPI_VALIDATE_RESPONSES") == "true"
+
+	streamConfig, err := stream.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// the polls stop on the interrupt signal, removing the ceps they added to the
+	// watchlist of servicob
+	hub := stream.NewHub(ctx, streamConfig, fetchStreamWeather, watchStreamCep)
+
 	router := http.NewServeMux()
 	serverMiddleware := zipkinhttp.NewServerMiddleware(
 		tracer, zipkinhttp.TagResponseSize(true),
 	)
 	http.Handle("/", serverMiddleware(router))
-	router.HandleFunc("POST /cep", cepHandler)
-
-	http.ListenAndServe(":8080", router)
+	router.HandleFunc("POST /v1/weather", v1.Handle("/v1/weather", "/v2/weather", weatherV1Handler))
+	router.HandleFunc("POST /v2/weather", v2.Handle("/v2/weather", "", weatherHandler))
+	router.HandleFunc("POST /v2/address", v2.Handle("/v2/address", "", addressHandler))
+	router.HandleFunc("GET /cep/{cep}", v2.Handle("/cep/{cep}", "", weatherPathHandler))
+	router.HandleFunc("GET /weather", v2.Handle("/weather", "", weatherQueryHandler))
+	router.HandleFunc("GET /v2/stream", v2.Handle("/v2/stream", "", hub.ServeSSE))
+	router.HandleFunc("GET /v2/stream/ws", v2.Handle("/v2/stream/ws", "", hub.ServeWebSocket))
+	router.HandleFunc("GET /openapi.json", openapi.SpecHandler(api.Spec))
+	router.HandleFunc("GET /docs", openapi.DocsHandler)
+	// unversioned routes of the first releases
+	router.HandleFunc("POST /cep", v1.Handle("/cep", "/v2/weather", weatherV1Handler))
+	router.HandleFunc("POST /address", unversioned.Handle("/address", "/v2/address", addressHandler))
+
+	http.ListenAndServe(":8080", request.Limit(request.MaxBodyBytes, request.RequireJSON(validator.Handler(router))))
 
 	slog.Info("Servico A")
 	select {
@@ -141,12 +213,96 @@ func main() {
 	}
 }
 
-func cepHandler(w http.ResponseWriter, r *http.Request) {
+// rejectRequest writes the plain text error of a request rejected by the openapi
+// validation: the messages of the violations, e.g. "invalid zipcode", with 422,
+// "request body too large" with 413, or "bad request" with 400.
+func rejectRequest(w http.ResponseWriter, r *http.Request, status int, err error) {
+	switch status {
+	case http.StatusUnprocessableEntity:
+		var messages []string
+		for _, v := range openapi.Violations(err) {
+			if !slices.Contains(messages, v.Message) {
+				messages = append(messages, v.Message)
+			}
+		}
+		http.Error(w, strings.Join(messages, "; "), status)
+	case http.StatusRequestEntityTooLarge:
+		http.Error(w, "request body too large", status)
+	default:
+		http.Error(w, "bad request", status)
+	}
+}
+
+func weatherV1Handler(w http.ResponseWriter, r *http.Request) {
+	forwardCep(w, r, "servicoa", servicob.WeatherV1, postedCep)
+}
+
+func weatherHandler(w http.ResponseWriter, r *http.Request) {
+	forwardCep(w, r, "servicoa", servicob.WeatherV2, postedCep)
+}
+
+func addressHandler(w http.ResponseWriter, r *http.Request) {
+	forwardCep(w, r, "servicoa address", servicob.AddressV2, postedCep)
+}
+
+// weatherPathHandler serves GET /cep/{cep}.
+func weatherPathHandler(w http.ResponseWriter, r *http.Request) {
+	forwardCep(w, r, "servicoa", servicob.WeatherV2, pathCep)
+}
+
+// weatherQueryHandler serves GET /weather?cep=.
+func weatherQueryHandler(w http.ResponseWriter, r *http.Request) {
+	forwardCep(w, r, "servicoa", servicob.WeatherV2, queryCep)
+}
+
+// postedCep reads the cep of the json body of r with request.DecodeJSON, returning
+// shared.ErrInvalidCep if the cep is not a string, and a *request.Error if the body
+// is too large or is not a cep request.
+func postedCep(r *http.Request) (string, error) {
+	defer r.Body.Close()
+
+	var cep ceprequest
+	if err := request.DecodeJSON(r, &cep); err != nil {
+		var rerr *request.Error
+		if errors.As(err, &rerr) && rerr.Status == http.StatusUnprocessableEntity {
+			return "", shared.ErrInvalidCep
+		}
+		return "", err
+	}
+	return cep.Cep, nil
+}
+
+// pathCep reads the cep of the path of r, as in /cep/{cep}.
+func pathCep(r *http.Request) (string, error) {
+	return r.PathValue("cep"), nil
+}
+
+// queryCep reads the cep of the query string of r, as in /weather?cep=.
+func queryCep(r *http.Request) (string, error) {
+	return r.URL.Query().Get("cep"), nil
+}
+
+// cacheHeaders are the headers of the servicob weather responses relayed to the GET
+// requests, so browsers and caches can reuse and revalidate them.
+var cacheHeaders = []string{"Age", "Cache-Control", "ETag", "Last-Modified"}
+
+// forwardCep reads the cep of r with readCep and validates it, then relays the
+// servicob response for the path, e.g. servicob.WeatherV2, and the validated cep. The
+// query parameters of r, such as units and decimals, are forwarded too.
+//
+// For GET requests, the If-None-Match header is forwarded, and the cache headers and
+// the 304 Not Modified responses of servicob are relayed.
+//
+// The servicob errors are mapped to plain text errors: 404 and 422 are relayed, 408 becomes
+// 504 Gateway Timeout, 429 and 503 are relayed with a Retry-After header, and the others
+// become 500. The code of the servicob error is relayed in the X-Error-Code header, and
+// the servicob status and error code are recorded on the spans.
+func forwardCep(w http.ResponseWriter, r *http.Request, spanName string, path string, readCep func(*http.Request) (string, error)) {
 	//otel
 	carrier := propagation.HeaderCarrier(r.Header)
 	ctx := r.Context()
 	ctx = otel.GetTextMapPropagator().Extract(ctx, carrier)
-	ctx, span := OtelTracer.Start(ctx, "servicoa")
+	ctx, span := OtelTracer.Start(ctx, spanName, trace.WithAttributes(apiversion.Attributes(r.Context())...))
 	defer span.End()
 
 	//zipkin
@@ -154,68 +310,189 @@ func cepHandler(w http.ResponseWriter, r *http.Request) {
 	ctx = zipkin.NewContext(ctx, zspan)
 
 	//handler
-	body, error := io.ReadAll(r.Body)
-	if error != nil {
-		http.Error(w, error.Error(), http.StatusInternalServerError)
+	mediaType, err := render.NegotiateType(r.Header.Get("Accept"))
+	if err != nil {
+		w.Header().Set("Vary", "Accept")
+		http.Error(w, "not acceptable, supported media types: "+strings.Join(render.MediaTypes(), ", "), http.StatusNotAcceptable)
 		return
 	}
-	defer r.Body.Close()
 
-	var cep ceprequest
-	if error := json.Unmarshal(body, &cep); error != nil {
+	rawCep, err := readCep(r)
+	var rerr *request.Error
+	switch {
+	case errors.Is(err, shared.ErrInvalidCep):
 		http.Error(w, "invalid zipcode", http.StatusUnprocessableEntity)
 		return
+	case errors.As(err, &rerr):
+		http.Error(w, rerr.Message, rerr.Status)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	cep := ceprequest{Cep: rawCep}
 	if error := cep.validate(); error != nil {
 		http.Error(w, error.Error(), http.StatusUnprocessableEntity)
 		return
 	}
-	url := "http://servicob:8081/?cep={{cep}}"
-	url = strings.Replace(url, "{{cep}}", cep.Cep, 1)
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
 
-	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header)) // IMPORTANT
-
-	res, err := zipkinClient.Do(req)
+	req := servicob.Request{Path: path, Cep: cep.Cep, Query: url.Values{}, Accept: mediaType}
+	for name, values := range r.URL.Query() {
+		if name != "cep" {
+			req.Query[name] = values
+		}
+	}
+	cacheable := r.Method == http.MethodGet
+	if cacheable {
+		req.IfNoneMatch = r.Header.Get("If-None-Match")
+	}
 
+	res, err := servicobClient.Get(ctx, req)
 	if err != nil {
-		slog.Error(err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		slog.Error("servicob request failed", "error", err)
+		span.RecordError(err)
+		status, message := upstreamError(err)
+		http.Error(w, message, status)
+		return
 	}
 	slog.Info("status", "code", res.StatusCode)
+	span.SetAttributes(servicob.StatusCodeKey.Int(res.StatusCode))
+	tagSpan(zspan, servicob.StatusCodeKey, strconv.Itoa(res.StatusCode))
+	if res.StatusCode >= http.StatusBadRequest {
+		if code := res.ErrorCode(); code != "" {
+			span.SetAttributes(servicob.ErrorCodeKey.String(code))
+			tagSpan(zspan, servicob.ErrorCodeKey, code)
+			w.Header().Set(servicob.ErrorCodeHeader, code)
+		}
+	}
+	if cacheable {
+		for _, name := range cacheHeaders {
+			if v := res.Header.Get(name); v != "" {
+				w.Header().Set(name, v)
+			}
+		}
+	}
 	switch res.StatusCode {
+	case http.StatusNotModified:
+		w.Header().Set("Vary", "Accept")
+		w.WriteHeader(http.StatusNotModified)
 	case http.StatusOK:
-		body, err := io.ReadAll(res.Body)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		contentType := res.Header.Get("Content-Type")
+		if contentType == "" {
+			contentType = mediaType
 		}
-		defer res.Body.Close()
-		sbody := string(body)
-		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Vary", "Accept")
 		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(sbody))
+		w.Write(res.Body)
 	case http.StatusNotFound:
 		http.Error(w, "not found", http.StatusNotFound)
 	case http.StatusUnprocessableEntity:
 		http.Error(w, "invalid zipcode", http.StatusUnprocessableEntity)
+	case http.StatusRequestTimeout:
+		http.Error(w, "servicob timeout", http.StatusGatewayTimeout)
+	case http.StatusTooManyRequests:
+		w.Header().Set("Retry-After", retryAfter(res))
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+	case http.StatusServiceUnavailable:
+		w.Header().Set("Retry-After", retryAfter(res))
+		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
 	default:
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 	}
 }
 
-// Get preferred outbound ip of this machine
-func getOutboundIP() net.IP {
-	conn, err := net.Dial("udp", "8.8.8.8:80")
+// fetchStreamWeather is the stream.FetchFunc of the hub: it gets the v2 weather of cep
+// from servicob, as json, revalidating it with etag. If cached, it sends
+// Cache-Control: only-if-cached, so servicob only reads its caches.
+func fetchStreamWeather(ctx context.Context, cep, etag string, cached bool) ([]byte, string, int, error) {
+	ctx, span := OtelTracer.Start(ctx, "servicoa stream poll", trace.WithAttributes(attribute.String("cep", cep), attribute.Bool("cached", cached)))
+	defer span.End()
+
+	req := servicob.Request{Path: servicob.WeatherV2, Cep: cep, Query: url.Values{}, Accept: "application/json", IfNoneMatch: etag}
+	if cached {
+		req.CacheControl = "only-if-cached"
+	}
+	res, err := servicobClient.Get(ctx, req)
 	if err != nil {
-		log.Fatal(err)
+		span.RecordError(err)
+		return nil, "", 0, err
 	}
-	defer conn.Close()
+	span.SetAttributes(servicob.StatusCodeKey.Int(res.StatusCode))
+	return res.Body, res.Header.Get("ETag"), res.StatusCode, nil
+}
+
+// unwatchTimeout bounds the removal of a cep from the watchlist of servicob, which is
+// also made on shutdown.
+var unwatchTimeout = 5 * time.Second
+
+// watchStreamCep is the stream.WatchFunc of the hub: it adds cep to the watchlist of
+// servicob and, if it was not watched yet, returns the function removing it.
+func watchStreamCep(ctx context.Context, cep string) (func(), error) {
+	ctx, span := OtelTracer.Start(ctx, "servicoa stream watch", trace.WithAttributes(attribute.String("cep", cep)))
+	defer span.End()
+
+	path := servicob.WatchlistV2 + "/" + cep
+	res, err := servicobClient.Get(ctx, servicob.Request{Method: http.MethodPut, Path: path, Cep: cep, Accept: "application/json"})
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttributes(servicob.StatusCodeKey.Int(res.StatusCode))
+	switch res.StatusCode {
+	case http.StatusOK:
+		return nil, nil
+	case http.StatusCreated:
+	default:
+		return nil, fmt.Errorf("servicob watchlist: status %d", res.StatusCode)
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), unwatchTimeout)
+		defer cancel()
+		ctx, span := OtelTracer.Start(ctx, "servicoa stream unwatch", trace.WithAttributes(attribute.String("cep", cep)))
+		defer span.End()
+		res, err := servicobClient.Get(ctx, servicob.Request{Method: http.MethodDelete, Path: path, Cep: cep, Accept: "application/json"})
+		if err != nil {
+			span.RecordError(err)
+			slog.Warn("stream unwatch failed", "cep", cep, "error", err)
+			return
+		}
+		span.SetAttributes(servicob.StatusCodeKey.Int(res.StatusCode))
+		if res.StatusCode != http.StatusNoContent {
+			slog.Warn("stream unwatch failed", "cep", cep, "status", res.StatusCode)
+		}
+	}, nil
+}
+
+// tagSpan tags the zipkin span, if any, with key and value.
+func tagSpan(zspan zipkin.Span, key attribute.Key, value string) {
+	if zspan != nil {
+		zspan.Tag(string(key), value)
+	}
+}
+
+// defaultRetryAfter is the Retry-After, in seconds, of the 429 and 503 responses
+// relayed from servicob when servicob does not send one.
+var defaultRetryAfter = 30
 
-	localAddr := conn.LocalAddr().(*net.UDPAddr)
+// retryAfter returns the Retry-After header of res, or defaultRetryAfter.
+func retryAfter(res *servicob.Response) string {
+	if v := res.Header.Get("Retry-After"); v != "" {
+		return v
+	}
+	return strconv.Itoa(defaultRetryAfter)
+}
 
-	return localAddr.IP
+// upstreamError returns the status and the message of a failed servicob call:
+// 504 if it timed out, 502 if servicob could not be reached or its response was
+// too large.
+func upstreamError(err error) (int, string) {
+	var nerr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &nerr) && nerr.Timeout():
+		return http.StatusGatewayTimeout, "servicob timeout"
+	default:
+		return http.StatusBadGateway, "servicob unavailable"
+	}
 }
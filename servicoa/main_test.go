@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2-servicoa/internal/servicob"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// fakeServicob is a servicob.ServiceBClient answering with res or err, recording the
+// last request.
+type fakeServicob struct {
+	res  *servicob.Response
+	err  error
+	last servicob.Request
+}
+
+func (f *fakeServicob) Get(ctx context.Context, req servicob.Request) (*servicob.Response, error) {
+	f.last = req
+	return f.res, f.err
+}
+
+func useServicob(t *testing.T, f *fakeServicob) {
+	t.Helper()
+	oldClient, oldTracer := servicobClient, OtelTracer
+	servicobClient, OtelTracer = f, otel.Tracer("test")
+	t.Cleanup(func() { servicobClient, OtelTracer = oldClient, oldTracer })
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestWeatherHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		fake       fakeServicob
+		wantStatus int
+		wantBody   string
+		wantHeader http.Header
+	}{
+		{
+			name: "ok",
+			body: `{"cep":"39408-078"}`,
+			fake: fakeServicob{res: &servicob.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       []byte(`{"city":"Montes Claros"}`),
+			}},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"city":"Montes Claros"}`,
+		},
+		{
+			name:       "not found",
+			body:       `{"cep":"39408077"}`,
+			fake:       fakeServicob{res: &servicob.Response{StatusCode: 404, Header: http.Header{}}},
+			wantStatus: http.StatusNotFound,
+			wantBody:   "not found\n",
+		},
+		{
+			name: "servicob timeout status",
+			body: `{"cep":"39408078"}`,
+			fake: fakeServicob{res: &servicob.Response{
+				StatusCode: http.StatusRequestTimeout,
+				Header:     http.Header{"X-Error-Code": {"timeout"}},
+			}},
+			wantStatus: http.StatusGatewayTimeout,
+			wantBody:   "servicob timeout\n",
+			wantHeader: http.Header{"X-Error-Code": {"timeout"}},
+		},
+		{
+			name: "weather api unavailable",
+			body: `{"cep":"39408078"}`,
+			fake: fakeServicob{res: &servicob.Response{
+				StatusCode: http.StatusServiceUnavailable,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       []byte(`{"code":"unavailable","message":"Service Unavailable"}`),
+			}},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "service unavailable\n",
+			wantHeader: http.Header{"X-Error-Code": {"unavailable"}, "Retry-After": {"30"}},
+		},
+		{
+			name: "rate limited",
+			body: `{"cep":"39408078"}`,
+			fake: fakeServicob{res: &servicob.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Header:     http.Header{"X-Error-Code": {"rate_limited"}, "Retry-After": {"5"}},
+			}},
+			wantStatus: http.StatusTooManyRequests,
+			wantBody:   "too many requests\n",
+			wantHeader: http.Header{"X-Error-Code": {"rate_limited"}, "Retry-After": {"5"}},
+		},
+		{
+			name: "other error",
+			body: `{"cep":"39408078"}`,
+			fake: fakeServicob{res: &servicob.Response{
+				StatusCode: http.StatusBadRequest,
+				Header:     http.Header{"X-Error-Code": {"bad_request"}},
+			}},
+			wantStatus: http.StatusInternalServerError,
+			wantHeader: http.Header{"X-Error-Code": {"bad_request"}},
+		},
+		{
+			name:       "invalid zipcode",
+			body:       `{"cep":"3940807"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "servicob unreachable",
+			body:       `{"cep":"39408078"}`,
+			fake:       fakeServicob{err: errors.New("connection refused")},
+			wantStatus: http.StatusBadGateway,
+			wantBody:   "servicob unavailable\n",
+		},
+		{
+			name:       "servicob timeout",
+			body:       `{"cep":"39408078"}`,
+			fake:       fakeServicob{err: timeoutError{}},
+			wantStatus: http.StatusGatewayTimeout,
+			wantBody:   "servicob timeout\n",
+		},
+		{
+			name:       "servicob response too large",
+			body:       `{"cep":"39408078"}`,
+			fake:       fakeServicob{err: servicob.ErrResponseTooLarge},
+			wantStatus: http.StatusBadGateway,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := tt.fake
+			useServicob(t, &fake)
+
+			r := httptest.NewRequest(http.MethodPost, "/v2/weather?units=kelvin", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			weatherHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body, tt.wantBody)
+			}
+			for name := range tt.wantHeader {
+				if got := w.Header().Get(name); got != tt.wantHeader.Get(name) {
+					t.Errorf("%s = %q, want %q", name, got, tt.wantHeader.Get(name))
+				}
+			}
+			if fake.res != nil || fake.err != nil {
+				if fake.last.Path != servicob.WeatherV2 || fake.last.Query.Get("units") != "kelvin" {
+					t.Errorf("servicob request = %+v", fake.last)
+				}
+			}
+		})
+	}
+}
+
+func TestWeatherPathHandler_NotModified(t *testing.T) {
+	fake := fakeServicob{res: &servicob.Response{
+		StatusCode: http.StatusNotModified,
+		Header:     http.Header{"Etag": {`W/"1"`}, "Cache-Control": {"public, max-age=60"}},
+	}}
+	useServicob(t, &fake)
+
+	r := httptest.NewRequest(http.MethodGet, "/cep/39408078", nil)
+	r.SetPathValue("cep", "39408078")
+	r.Header.Set("If-None-Match", `W/"1"`)
+	w := httptest.NewRecorder()
+	weatherPathHandler(w, r)
+
+	if w.Code != http.StatusNotModified {
+		t.Errorf("status = %d, want 304", w.Code)
+	}
+	if fake.last.Cep != "39408078" || fake.last.IfNoneMatch != `W/"1"` {
+		t.Errorf("servicob request = %+v", fake.last)
+	}
+	if w.Header().Get("ETag") != `W/"1"` {
+		t.Errorf("ETag = %q, want %q", w.Header().Get("ETag"), `W/"1"`)
+	}
+}
+
+func TestForwardCep_SpanAttributes(t *testing.T) {
+	fake := fakeServicob{res: &servicob.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Header:     http.Header{"X-Error-Code": {"unavailable"}},
+	}}
+	useServicob(t, &fake)
+	spans := tracetest.NewSpanRecorder()
+	OtelTracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)).Tracer("test")
+
+	r := httptest.NewRequest(http.MethodGet, "/weather?cep=39408078", nil)
+	weatherQueryHandler(httptest.NewRecorder(), r)
+
+	ended := spans.Ended()
+	if len(ended) != 1 {
+		t.Fatalf("%d spans ended, want 1", len(ended))
+	}
+	want := map[attribute.Key]attribute.Value{
+		servicob.StatusCodeKey: attribute.IntValue(http.StatusServiceUnavailable),
+		servicob.ErrorCodeKey:  attribute.StringValue("unavailable"),
+	}
+	for _, kv := range ended[0].Attributes() {
+		if v, ok := want[kv.Key]; ok {
+			if v != kv.Value {
+				t.Errorf("%s = %v, want %v", kv.Key, kv.Value.Emit(), v.Emit())
+			}
+			delete(want, kv.Key)
+		}
+	}
+	for k := range want {
+		t.Errorf("span has no %s attribute", k)
+	}
+}
+
+func TestFetchStreamWeather(t *testing.T) {
+	fake := fakeServicob{res: &servicob.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Etag": {`W/"2"`}},
+		Body:       []byte(`{"city":"Montes Claros"}`),
+	}}
+	useServicob(t, &fake)
+
+	for _, cached := range []bool{false, true} {
+		data, etag, status, err := fetchStreamWeather(context.Background(), "39408078", `W/"1"`, cached)
+		if err != nil || status != http.StatusOK || etag != `W/"2"` || string(data) != `{"city":"Montes Claros"}` {
+			t.Errorf("fetchStreamWeather(cached %v) = %s, %q, %d, %v", cached, data, etag, status, err)
+		}
+		if fake.last.Path != servicob.WeatherV2 || fake.last.Cep != "39408078" || fake.last.IfNoneMatch != `W/"1"` || fake.last.Accept != "application/json" {
+			t.Errorf("servicob request = %+v", fake.last)
+		}
+		if got := fake.last.CacheControl == "only-if-cached"; got != cached {
+			t.Errorf("servicob request with cached %v = %+v", cached, fake.last)
+		}
+	}
+}
+
+func TestWatchStreamCep(t *testing.T) {
+	tests := []struct {
+		name        string
+		res         *servicob.Response
+		err         error
+		wantUnwatch bool
+		wantErr     bool
+	}{
+		{name: "added", res: &servicob.Response{StatusCode: http.StatusCreated}, wantUnwatch: true},
+		{name: "already watched", res: &servicob.Response{StatusCode: http.StatusOK}},
+		{name: "watchlist full", res: &servicob.Response{StatusCode: http.StatusUnprocessableEntity}, wantErr: true},
+		{name: "servicob unreachable", err: errors.New("connection refused"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := fakeServicob{res: tt.res, err: tt.err}
+			useServicob(t, &fake)
+
+			unwatch, err := watchStreamCep(context.Background(), "39408078")
+			if (err != nil) != tt.wantErr || (unwatch != nil) != tt.wantUnwatch {
+				t.Fatalf("watchStreamCep() = unwatch %v, error %v", unwatch != nil, err)
+			}
+			if fake.last.Method != http.MethodPut || fake.last.Path != servicob.WatchlistV2+"/39408078" {
+				t.Errorf("servicob request = %+v", fake.last)
+			}
+			if unwatch == nil {
+				return
+			}
+			fake.res = &servicob.Response{StatusCode: http.StatusNoContent}
+			unwatch()
+			if fake.last.Method != http.MethodDelete || fake.last.Path != servicob.WatchlistV2+"/39408078" {
+				t.Errorf("servicob request of unwatch = %+v", fake.last)
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+// Command cepweather queries the weather of ceps from the command line: from servicoa,
+// from servicob, or calling the servicob usecase in process.
+//
+// Usage:
+//
+//	cepweather [flags] [cep ...]
+//
+// The ceps come from the arguments, from the -file csv file, or from the standard input
+// when there are neither ("-" reads it too). Csv files and the standard input have a cep
+// per line, or a cep column when their first line is a header naming one.
+//
+// Each run is a trace: its id is printed to the standard error and propagated to the
+// services. When its spans are exported with -otlp, its Jaeger link is printed too. The
+// exit status is 1 when the weather of a cep could
+// not be got, 2 when the flags are invalid.
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/units"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The targets of the queries.
+const (
+	targetServicoa = "servicoa"
+	targetServicob = "servicob"
+	targetLocal    = "local"
+)
+
+// defaultURLs are the base urls of the services published by docker-compose.
+var defaultURLs = map[string]string{
+	targetServicoa: "http://localhost:8080",
+	targetServicob: "http://localhost:8081",
+}
+
+// options are the flags of a run.
+type options struct {
+	target   string
+	url      string
+	file     string
+	format   string
+	system   units.System
+	decimals int
+	timeout  time.Duration
+	parallel int
+	otlp     string
+	jaeger   string
+	verbose  bool
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command with args, returning its exit status.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	opts, ceps, err := parseFlags(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "cepweather:", err)
+		return 2
+	}
+
+	level := slog.LevelWarn
+	if opts.verbose {
+		level = slog.LevelInfo
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: level})))
+
+	ceps, err = readAllCeps(ceps, opts.file, stdin)
+	if err != nil {
+		fmt.Fprintln(stderr, "cepweather:", err)
+		return 2
+	}
+	if len(ceps) == 0 {
+		fmt.Fprintln(stderr, "cepweather: no ceps")
+		return 2
+	}
+
+	tp, err := newTracerProvider(ctx, opts.otlp)
+	if err != nil {
+		fmt.Fprintln(stderr, "cepweather:", err)
+		return 1
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			slog.Warn("spans not exported", "error", err)
+		}
+	}()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	get, err := newWeatherFunc(opts)
+	if err != nil {
+		fmt.Fprintln(stderr, "cepweather:", err)
+		return 1
+	}
+
+	ctx, span := otel.Tracer("microservice-tracer").Start(ctx, "cepweather")
+	span.SetAttributes(attribute.String("cepweather.target", opts.target), attribute.Int("cepweather.ceps", len(ceps)))
+	traceID := span.SpanContext().TraceID().String()
+	fmt.Fprintf(stderr, "trace id: %s\n", traceID)
+	// without -otlp the root span is not exported, so Jaeger would not find the trace
+	if opts.otlp != "" && opts.jaeger != "" {
+		fmt.Fprintf(stderr, "jaeger: %s/trace/%s\n", strings.TrimSuffix(opts.jaeger, "/"), traceID)
+	}
+
+	results := query(ctx, get, ceps, opts.parallel, opts.timeout)
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		span.SetStatus(codes.Error, fmt.Sprintf("%d of %d ceps failed", failed, len(ceps)))
+	}
+	span.End()
+
+	if err := writeResults(stdout, opts.format, results); err != nil {
+		fmt.Fprintln(stderr, "cepweather:", err)
+		return 1
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// parseFlags parses the flags of args, returning the options and the ceps of the
+// remaining arguments.
+func parseFlags(args []string, stderr io.Writer) (opts options, ceps []string, err error) {
+	fs := flag.NewFlagSet("cepweather", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: cepweather [flags] [cep ...]")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&opts.target, "target", targetServicoa, "where to get the weather: servicoa, servicob or local (the usecase of servicob, in process, with the API_KEY of the WeatherAPI)")
+	fs.StringVar(&opts.url, "url", "", "base url of the target (default http://localhost:8080 for servicoa, http://localhost:8081 for servicob)")
+	fs.StringVar(&opts.file, "file", "", "csv file of ceps")
+	fs.StringVar(&opts.format, "o", formatTable, "output format: table, json or csv")
+	unitsFlag := fs.String("units", "metric", "units of the temperature: metric, imperial or si")
+	decimalsFlag := fs.String("decimals", "", "decimal places of the temperatures, 0 to 6 (default 2)")
+	fs.DurationVar(&opts.timeout, "timeout", 15*time.Second, "timeout of each cep")
+	fs.IntVar(&opts.parallel, "parallel", 4, "ceps queried at the same time")
+	fs.StringVar(&opts.otlp, "otlp", "", "otlp grpc endpoint, e.g. localhost:4317, to export the spans of the command")
+	fs.StringVar(&opts.jaeger, "jaeger", "http://localhost:16686", "jaeger ui url for the trace link printed with -otlp, empty for none")
+	fs.BoolVar(&opts.verbose, "v", false, "log the requests")
+	if err := fs.Parse(args); err != nil {
+		return options{}, nil, err
+	}
+
+	if !slices.Contains([]string{targetServicoa, targetServicob, targetLocal}, opts.target) {
+		return options{}, nil, fmt.Errorf("unknown target %q, want servicoa, servicob or local", opts.target)
+	}
+	if !slices.Contains(formats, opts.format) {
+		return options{}, nil, fmt.Errorf("unknown output format %q, want %s", opts.format, strings.Join(formats, ", "))
+	}
+	if opts.system, err = units.ParseSystem(*unitsFlag); err != nil {
+		return options{}, nil, err
+	}
+	if opts.decimals, err = units.ParseDecimals(*decimalsFlag); err != nil {
+		return options{}, nil, err
+	}
+	if opts.parallel < 1 || opts.timeout <= 0 {
+		return options{}, nil, errors.New("parallel and timeout must be positive")
+	}
+	if opts.url == "" {
+		opts.url = defaultURLs[opts.target]
+	}
+	return opts, fs.Args(), nil
+}
+
+// readAllCeps returns the ceps of args, then the ones of file, if any. The standard
+// input is read for a "-" argument, or when there are no arguments nor file.
+func readAllCeps(args []string, file string, stdin io.Reader) ([]string, error) {
+	var ceps []string
+	readStdin := len(args) == 0 && file == ""
+	for _, arg := range args {
+		if arg == "-" {
+			readStdin = true
+			continue
+		}
+		ceps = append(ceps, arg)
+	}
+	if readStdin {
+		read, err := readCeps(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("standard input: %w", err)
+		}
+		ceps = append(ceps, read...)
+	}
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		read, err := readCeps(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		ceps = append(ceps, read...)
+	}
+	return ceps, nil
+}
+
+// readCeps reads the ceps of csv: the first column, or the cep column when the first
+// line is a header naming it. Blank lines and lines starting with # are skipped.
+func readCeps(r io.Reader) ([]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.Comment = '#'
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	column := 0
+	if len(records) > 0 {
+		if i := slices.IndexFunc(records[0], func(name string) bool { return strings.EqualFold(strings.TrimSpace(name), "cep") }); i >= 0 {
+			column = i
+			records = records[1:]
+		}
+	}
+	var ceps []string
+	for _, record := range records {
+		if column < len(record) {
+			if cep := strings.TrimSpace(record[column]); cep != "" {
+				ceps = append(ceps, cep)
+			}
+		}
+	}
+	return ceps, nil
+}
+
+// query gets the weather of ceps with get, parallel at a time, each within timeout. The
+// results are in the order of ceps.
+func query(ctx context.Context, get weatherFunc, ceps []string, parallel int, timeout time.Duration) []result {
+	results := make([]result, len(ceps))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, cep := range ceps {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = queryCep(ctx, get, cep, timeout)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// queryCep gets the weather of cep with get, in a span.
+func queryCep(ctx context.Context, get weatherFunc, cep string, timeout time.Duration) result {
+	ctx, span := otel.Tracer("microservice-tracer").Start(ctx, "cepweather cep", trace.WithAttributes(attribute.String("cep", cep)))
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	temps, status, err := get(ctx, cep)
+	span.SetAttributes(attribute.Int("cepweather.status", status))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return result{Cep: cep, Status: status, Error: err.Error()}
+	}
+	return result{Cep: cep, Status: status, Weather: &temps}
+}
+
+// newTracerProvider returns the provider of the spans of the command, exporting them to
+// the otlp grpc endpoint, if any. Otherwise the spans are only propagated.
+func newTracerProvider(ctx context.Context, endpoint string) (*sdktrace.TracerProvider, error) {
+	res, err := resource.New(ctx, resource.WithAttributes(semconv.ServiceName("cepweather")))
+	if err != nil {
+		return nil, err
+	}
+	opts := []sdktrace.TracerProviderOption{sdktrace.WithSampler(sdktrace.AlwaysSample()), sdktrace.WithResource(res)}
+	if endpoint != "" {
+		exporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpoint(endpoint), otlptracegrpc.WithInsecure())
+		if err != nil {
+			return nil, fmt.Errorf("otlp exporter: %w", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+	return sdktrace.NewTracerProvider(opts...), nil
+}
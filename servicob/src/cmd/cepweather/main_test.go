@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/dto"
+)
+
+func TestReadCeps(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{name: "lines", input: "39408078\n\n01001-000\n", want: []string{"39408078", "01001-000"}},
+		{name: "first column", input: "39408078,Montes Claros\n01001000,São Paulo\n", want: []string{"39408078", "01001000"}},
+		{name: "cep column", input: "name,CEP\nhome, 39408078\nwork,\n# old\noffice,01001000\n", want: []string{"39408078", "01001000"}},
+		{name: "empty", input: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readCeps(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readCeps() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadAllCeps(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ceps.csv")
+	if err := os.WriteFile(file, []byte("cep\n20040002\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stdin := "01001000\n"
+	tests := []struct {
+		name string
+		args []string
+		file string
+		want []string
+	}{
+		{name: "args", args: []string{"39408078"}, want: []string{"39408078"}},
+		{name: "stdin without args", want: []string{"01001000"}},
+		{name: "args and stdin", args: []string{"39408078", "-"}, want: []string{"39408078", "01001000"}},
+		{name: "file", file: file, want: []string{"20040002"}},
+		{name: "args and file", args: []string{"39408078"}, file: file, want: []string{"39408078", "20040002"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readAllCeps(tt.args, tt.file, strings.NewReader(stdin))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readAllCeps() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeService is a servicob answering the weather of 39408078 and 404 for the other
+// ceps, recording the requests.
+type fakeService struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func newFakeService(t *testing.T) *fakeService {
+	f := &fakeService{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.requests = append(f.requests, r)
+		f.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("cep") != "39408078" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(dto.ErrorResponse{Code: "not_found", Message: "Not Found"})
+			return
+		}
+		temp := 77.18
+		json.NewEncoder(w).Encode(dto.TempResponse{City: "Montes Claros", Temp_C: 25.1, Temp_F: 77.18, Temp_K: 298.25, Temp: &temp, Unit: "F", Units: "imperial"})
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func TestRun(t *testing.T) {
+	service := newFakeService(t)
+	tests := []struct {
+		name       string
+		format     string
+		wantStdout string
+	}{
+		{
+			name:   "table",
+			format: "table",
+			wantStdout: "CEP       CITY           TEMP     °C    °F     K       OBSERVED AT  ERROR\n" +
+				"39408078  Montes Claros  77.18 F  25.1  77.18  298.25               \n" +
+				"01001000  -              -        -     -      -       -            404: not found\n",
+		},
+		{
+			name:   "csv",
+			format: "csv",
+			wantStdout: "cep,status,city,temp,unit,temp_C,temp_F,temp_K,observed_at,stale,error\n" +
+				"39408078,200,Montes Claros,77.18,F,25.1,77.18,298.25,,false,\n" +
+				"01001000,404,,,,,,,,,not found\n",
+		},
+		{
+			name:   "json",
+			format: "json",
+			wantStdout: `[
+  {
+    "cep": "39408078",
+    "status": 200,
+    "weather": {
+      "city": "Montes Claros",
+      "temp_C": 25.1,
+      "temp_F": 77.18,
+      "temp_K": 298.25,
+      "temp": 77.18,
+      "unit": "F",
+      "units": "imperial"
+    }
+  },
+  {
+    "cep": "01001000",
+    "status": 404,
+    "error": "not found"
+  }
+]
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			args := []string{"-target", "servicob", "-url", service.URL, "-units", "imperial", "-o", tt.format, "39408078", "01001000"}
+			if code := run(context.Background(), args, strings.NewReader(""), &stdout, &stderr); code != 1 {
+				t.Errorf("run() = %d, want 1 as a cep failed", code)
+			}
+			if stdout.String() != tt.wantStdout {
+				t.Errorf("stdout =\n%s\nwant\n%s", stdout.String(), tt.wantStdout)
+			}
+			if !strings.HasPrefix(stderr.String(), "trace id: ") {
+				t.Errorf("stderr = %q, want the trace id", stderr.String())
+			}
+		})
+	}
+
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	r := service.requests[0]
+	if r.URL.Path != "/v2/weather" || r.URL.Query().Get("units") != "imperial" || r.URL.Query().Get("decimals") != "2" {
+		t.Errorf("request = %s", r.URL)
+	}
+	if r.Header.Get("traceparent") == "" {
+		t.Error("the trace is not propagated")
+	}
+}
+
+func TestRunTraceID(t *testing.T) {
+	service := newFakeService(t)
+	var stdout, stderr bytes.Buffer
+	if code := run(context.Background(), []string{"-url", service.URL, "39408078"}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("run() = %d, stderr %q", code, stderr.String())
+	}
+	// the jaeger link is only printed with -otlp, when the spans of the run are exported
+	if strings.Contains(stderr.String(), "jaeger") {
+		t.Errorf("stderr = %q, want no jaeger link without -otlp", stderr.String())
+	}
+	traceID := strings.TrimSpace(strings.TrimPrefix(stderr.String(), "trace id: "))
+	traceparent := service.requests[0].Header.Get("traceparent")
+	if len(traceID) != 32 || !strings.Contains(traceparent, "-"+traceID+"-") {
+		t.Errorf("trace id %q is not the one of traceparent %q", traceID, traceparent)
+	}
+	if service.requests[0].URL.Path != "/weather" {
+		t.Errorf("servicoa path = %s, want /weather", service.requests[0].URL.Path)
+	}
+}
+
+func TestRunInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "unknown target", args: []string{"-target", "servicoc", "39408078"}},
+		{name: "unknown format", args: []string{"-o", "xml", "39408078"}},
+		{name: "unknown units", args: []string{"-units", "rankine", "39408078"}},
+		{name: "invalid decimals", args: []string{"-decimals", "7", "39408078"}},
+		{name: "no ceps", args: []string{"-"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := run(context.Background(), tt.args, strings.NewReader(""), &stdout, &stderr); code != 2 {
+				t.Errorf("run() = %d, want 2 (stderr %q)", code, stderr.String())
+			}
+		})
+	}
+}
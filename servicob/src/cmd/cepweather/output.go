@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/dto"
+)
+
+// The output formats.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+var formats = []string{formatTable, formatJSON, formatCSV}
+
+// result is the weather of a cep, or why it could not be got.
+type result struct {
+	Cep     string            `json:"cep"`
+	Status  int               `json:"status"`
+	Weather *dto.TempResponse `json:"weather,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// csvHeader is the header of the csv output; the temperatures are empty for the failed
+// ceps.
+var csvHeader = []string{"cep", "status", "city", "temp", "unit", "temp_C", "temp_F", "temp_K", "observed_at", "stale", "error"}
+
+// writeResults writes results to w in format.
+func writeResults(w io.Writer, format string, results []result) error {
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(csvHeader)
+		for _, r := range results {
+			record := []string{r.Cep, strconv.Itoa(r.Status), "", "", "", "", "", "", "", "", r.Error}
+			if t := r.Weather; t != nil {
+				record = []string{r.Cep, strconv.Itoa(r.Status), t.City, formatTemp(t.Temp), string(t.Unit),
+					formatFloat(t.Temp_C), formatFloat(t.Temp_F), formatFloat(t.Temp_K),
+					formatTime(t.ObservedAt, time.RFC3339), strconv.FormatBool(t.Stale), ""}
+			}
+			cw.Write(record)
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "CEP\tCITY\tTEMP\t°C\t°F\tK\tOBSERVED AT\tERROR")
+		for _, r := range results {
+			if t := r.Weather; t != nil {
+				temp := formatTemp(t.Temp) + " " + string(t.Unit)
+				if t.Stale {
+					temp += " (stale)"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n", r.Cep, t.City, temp,
+					formatFloat(t.Temp_C), formatFloat(t.Temp_F), formatFloat(t.Temp_K), formatTime(t.ObservedAt, time.DateTime))
+				continue
+			}
+			message := r.Error
+			if r.Status != 0 {
+				message = strconv.Itoa(r.Status) + ": " + message
+			}
+			fmt.Fprintf(tw, "%s\t-\t-\t-\t-\t-\t-\t%s\n", r.Cep, message)
+		}
+		return tw.Flush()
+	}
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func formatTemp(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return formatFloat(*v)
+}
+
+// formatTime formats t in layout, in local time; "" if it is unknown.
+func formatTime(t time.Time, layout string) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format(layout)
+}
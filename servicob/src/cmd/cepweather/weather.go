@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/dto"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/secret"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/usecase"
+	"github.com/openzipkin/zipkin-go"
+	zipkinhttp "github.com/openzipkin/zipkin-go/middleware/http"
+	"github.com/openzipkin/zipkin-go/reporter"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// maxBodyBytes bounds the responses of the services.
+const maxBodyBytes = 1 << 20
+
+// weatherFunc gets the weather of cep, formatted in the units of the options. It
+// returns the status of the answer, 0 if the target could not be reached.
+type weatherFunc func(ctx context.Context, cep string) (temps dto.TempResponse, status int, err error)
+
+// newWeatherFunc returns the weatherFunc of the target of opts.
+func newWeatherFunc(opts options) (weatherFunc, error) {
+	switch opts.target {
+	case targetServicoa:
+		return serviceWeather(opts, "/weather")
+	case targetServicob:
+		return serviceWeather(opts, "/v2/weather")
+	default:
+		return localWeather(opts)
+	}
+}
+
+// serviceWeather gets the weather from the GET route path of the service at opts.url,
+// /weather of servicoa or /v2/weather of servicob, propagating the trace.
+func serviceWeather(opts options, path string) (weatherFunc, error) {
+	base, err := url.Parse(opts.url)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, fmt.Errorf("invalid url %q", opts.url)
+	}
+	endpoint := base.JoinPath(path)
+	client := &http.Client{}
+	return func(ctx context.Context, cep string) (dto.TempResponse, int, error) {
+		q := url.Values{"cep": {cep}, "units": {string(opts.system)}, "decimals": {strconv.Itoa(opts.decimals)}}
+		u := *endpoint
+		u.RawQuery = q.Encode()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return dto.TempResponse{}, 0, err
+		}
+		req.Header.Set("Accept", "application/json")
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+		res, err := client.Do(req)
+		if err != nil {
+			return dto.TempResponse{}, 0, err
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(io.LimitReader(res.Body, maxBodyBytes))
+		if err != nil {
+			return dto.TempResponse{}, res.StatusCode, err
+		}
+		if res.StatusCode != http.StatusOK {
+			return dto.TempResponse{}, res.StatusCode, responseError(res, body)
+		}
+		var temps dto.TempResponse
+		if err := json.Unmarshal(body, &temps); err != nil {
+			return dto.TempResponse{}, res.StatusCode, fmt.Errorf("invalid response: %w", err)
+		}
+		return temps, res.StatusCode, nil
+	}, nil
+}
+
+// responseError returns the error of an error response: the violations or the message
+// of the json errors of servicob, the text of the errors of servicoa.
+func responseError(res *http.Response, body []byte) error {
+	if mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mediaType == "application/json" {
+		var e dto.ErrorResponse
+		if err := json.Unmarshal(body, &e); err == nil && e.Message != "" {
+			var messages []string
+			for _, v := range e.Violations {
+				messages = append(messages, v.Message)
+			}
+			if len(messages) > 0 {
+				return errors.New(strings.Join(messages, "; "))
+			}
+			return errors.New(strings.ToLower(e.Message))
+		}
+	}
+	if text := strings.TrimSpace(string(body)); text != "" {
+		return errors.New(text)
+	}
+	return errors.New(strings.ToLower(http.StatusText(res.StatusCode)))
+}
+
+// localWeather gets the weather with usecase.GetWeather, in process, as servicob does:
+// the WeatherAPI key is read once by secret.Load("API_KEY").
+func localWeather(opts options) (weatherFunc, error) {
+	apiKey, err := secret.Load("API_KEY")
+	if err != nil {
+		return nil, err
+	}
+	// the zipkin spans are not reported, the otel ones carry the trace
+	tracer, err := zipkin.NewTracer(reporter.NewNoopReporter())
+	if err != nil {
+		return nil, err
+	}
+	client, err := zipkinhttp.NewClient(tracer,
+		zipkinhttp.TransportOptions(zipkinhttp.TransportErrHandler(secret.ZipkinErrHandler(apiKey))),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, cep string) (dto.TempResponse, int, error) {
+		temps, status, _, err := usecase.GetWeather(ctx, cep, client, apiKey)
+		if err != nil {
+			return dto.TempResponse{}, status, err
+		}
+		return temps.Format(opts.system, opts.decimals), status, nil
+	}, nil
+}
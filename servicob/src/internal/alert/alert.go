@@ -0,0 +1,284 @@
+// Package alert evaluates temperature threshold rules on the observations of the
+// weather and notifies webhooks when they fire and when they resolve.
+package alert
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/dto"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/history"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/secret"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/shared"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/validation"
+)
+
+// ErrNotFound is returned for the ids of rules that do not exist.
+var ErrNotFound = errors.New("alert: rule not found")
+
+// Locator looks a cep up, as usecase.GetAddress does, for the city of the rules.
+type Locator func(ctx context.Context, cep string) (address dto.Cep, status int, message string, err error)
+
+// LocateError is returned when the city of the cep of a rule can not be located, with
+// the status and message of the Locator.
+type LocateError struct {
+	Status  int
+	Message string
+	Err     error
+}
+
+func (e *LocateError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *LocateError) Unwrap() error {
+	return e.Err
+}
+
+// MaxRules bounds the number of rules of an Engine.
+var MaxRules = 1000
+
+// Engine keeps the alert rules and their state, evaluates them on each observation of
+// the city of their cep and notifies their webhooks of the changes of state. The rules
+// live in memory. It is safe for concurrent use.
+type Engine struct {
+	notifier *Notifier
+	locate   Locator
+	now      func() time.Time
+
+	mu    sync.Mutex
+	rules map[string]*dto.AlertRule
+}
+
+// NewEngine returns an Engine without rules, locating the city of their ceps with locate
+// and notifying with notifier.
+func NewEngine(notifier *Notifier, locate Locator) *Engine {
+	return &Engine{notifier: notifier, locate: locate, now: time.Now, rules: map[string]*dto.AlertRule{}}
+}
+
+// Create adds the rule in, in state ok. It returns validation.Errors if in is invalid,
+// and a *LocateError if the city of its cep can not be located.
+func (e *Engine) Create(ctx context.Context, in dto.AlertRuleInput) (dto.AlertRule, error) {
+	address, err := e.validate(ctx, in)
+	if err != nil {
+		return dto.AlertRule{}, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.rules) >= MaxRules {
+		var errs validation.Errors
+		errs.Add("cep", validation.RuleRange, in.Cep, fmt.Sprintf("too many alert rules: at most %d", MaxRules))
+		return dto.AlertRule{}, errs
+	}
+	t := e.now().UTC()
+	r := &dto.AlertRule{ID: newID(), State: dto.AlertOK, CreatedAt: t}
+	apply(r, address, in, t)
+	e.rules[r.ID] = r
+	return clone(r), nil
+}
+
+// Update replaces the rule id by in. The rule keeps its state, evaluated against the
+// new threshold on the next observation, unless its cep changes: then it starts over
+// in state ok. It returns ErrNotFound if there is no rule id, validation.Errors if in
+// is invalid, and a *LocateError if the city of its cep can not be located.
+func (e *Engine) Update(ctx context.Context, id string, in dto.AlertRuleInput) (dto.AlertRule, error) {
+	if _, err := e.Get(id); err != nil {
+		return dto.AlertRule{}, err
+	}
+	address, err := e.validate(ctx, in)
+	if err != nil {
+		return dto.AlertRule{}, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	r, ok := e.rules[id]
+	if !ok {
+		return dto.AlertRule{}, ErrNotFound
+	}
+	if r.Cep != address.Cep {
+		*r = dto.AlertRule{ID: r.ID, State: dto.AlertOK, CreatedAt: r.CreatedAt}
+	}
+	apply(r, address, in, e.now().UTC())
+	return clone(r), nil
+}
+
+// Delete removes the rule id, without notifying its webhooks. It returns ErrNotFound
+// if there is no rule id.
+func (e *Engine) Delete(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.rules[id]; !ok {
+		return ErrNotFound
+	}
+	delete(e.rules, id)
+	return nil
+}
+
+// Get returns the rule id, or ErrNotFound.
+func (e *Engine) Get(id string) (dto.AlertRule, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	r, ok := e.rules[id]
+	if !ok {
+		return dto.AlertRule{}, ErrNotFound
+	}
+	return clone(r), nil
+}
+
+// List returns the rules of cep, or all the rules if cep is empty, in the order they
+// were created.
+func (e *Engine) List(cep string) dto.AlertRules {
+	if parsed, err := shared.ParseCep(cep); err == nil {
+		cep = parsed.Canonical()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rules := dto.AlertRules{Rules: []dto.AlertRule{}}
+	for _, r := range e.rules {
+		if cep == "" || r.Cep == cep {
+			rules.Rules = append(rules.Rules, clone(r))
+		}
+	}
+	slices.SortFunc(rules.Rules, func(a, b dto.AlertRule) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return rules
+}
+
+// Observe evaluates the rules of the ceps of the city of o, whichever cep o was fetched
+// for, and notifies the webhooks of the ones firing or resolving. Observations older
+// than the last one evaluated by a rule, such as the same observation served again from
+// the cache, are ignored.
+func (e *Engine) Observe(ctx context.Context, o history.Observation) {
+	type notification struct {
+		webhooks []string
+		body     dto.AlertNotification
+	}
+	var notifications []notification
+
+	city := shared.CacheKey(o.City, o.State)
+	e.mu.Lock()
+	for _, r := range e.rules {
+		if shared.CacheKey(r.City, r.UF) != city || (r.ObservedAt != nil && !o.ObservedAt.After(*r.ObservedAt)) {
+			continue
+		}
+		temp, observedAt := o.TempC, o.ObservedAt.UTC()
+		r.Temp_C, r.ObservedAt = &temp, &observedAt
+		state := transition(*r, temp)
+		if state == r.State {
+			continue
+		}
+		r.State, r.Since = state, &observedAt
+		event := dto.AlertFiring
+		if state == dto.AlertOK {
+			event = dto.AlertResolved
+		}
+		notifications = append(notifications, notification{
+			webhooks: slices.Clone(r.Webhooks),
+			body: dto.AlertNotification{
+				ID:         newID(),
+				Event:      event,
+				Rule:       clone(r),
+				City:       o.City,
+				State:      o.State,
+				Temp_C:     temp,
+				ObservedAt: observedAt,
+			},
+		})
+	}
+	e.mu.Unlock()
+
+	for _, n := range notifications {
+		e.notifier.Notify(ctx, n.webhooks, n.body)
+	}
+}
+
+// transition returns the state of r after the temperature temp: it fires past the
+// threshold, and resolves once temp is back the hysteresis past it.
+func transition(r dto.AlertRule, temp float64) string {
+	firing := r.State == dto.AlertFiring
+	switch r.Comparison {
+	case dto.AlertAbove:
+		firing = temp > r.Threshold_C || firing && temp > r.Threshold_C-r.Hysteresis_C
+	case dto.AlertBelow:
+		firing = temp < r.Threshold_C || firing && temp < r.Threshold_C+r.Hysteresis_C
+	}
+	if firing {
+		return dto.AlertFiring
+	}
+	return dto.AlertOK
+}
+
+// validate returns the address of the cep of in, with its canonical cep, or the
+// validation.Errors of in, or a *LocateError.
+func (e *Engine) validate(ctx context.Context, in dto.AlertRuleInput) (address dto.Cep, err error) {
+	var errs validation.Errors
+	parsed, cerr := shared.ParseCep(in.Cep)
+	if cerr != nil {
+		errs.Add("cep", validation.RuleFormat, in.Cep, "invalid zipcode")
+	}
+	if in.Comparison != dto.AlertAbove && in.Comparison != dto.AlertBelow {
+		errs.Add("comparison", validation.RuleOneOf, in.Comparison, "comparison must be above or below")
+	}
+	if in.Threshold_C == nil {
+		errs.Add("threshold_C", validation.RuleRequired, "", "threshold_C is required")
+	}
+	if in.Hysteresis_C < 0 {
+		errs.Add("hysteresis_C", validation.RuleRange, fmt.Sprint(in.Hysteresis_C), "hysteresis_C must not be negative")
+	}
+	for _, webhook := range in.Webhooks {
+		u, err := url.Parse(webhook)
+		switch {
+		case err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+			errs.Add("webhooks", validation.RuleFormat, webhook, "webhooks must be http or https urls")
+		case !e.notifier.cfg.Allows(webhook):
+			errs.Add("webhooks", validation.RuleOneOf, secret.SanitizeURL(webhook), "webhooks must be default webhooks or allowed webhook urls")
+		}
+	}
+	if len(in.Webhooks) == 0 && len(e.notifier.cfg.URLs) == 0 {
+		errs.Add("webhooks", validation.RuleRequired, "", "webhooks are required without default webhooks")
+	}
+	if err := errs.Err(); err != nil {
+		return dto.Cep{}, err
+	}
+	address, status, message, err := e.locate(ctx, parsed.Canonical())
+	if err != nil {
+		return dto.Cep{}, &LocateError{Status: status, Message: message, Err: err}
+	}
+	address.Cep = parsed.Canonical()
+	return address, nil
+}
+
+// apply sets the fields of in, of the cep of address, to r, updated at t.
+func apply(r *dto.AlertRule, address dto.Cep, in dto.AlertRuleInput, t time.Time) {
+	r.Cep = address.Cep
+	r.City, r.UF = address.City, address.State
+	r.Comparison = in.Comparison
+	r.Threshold_C = *in.Threshold_C
+	r.Hysteresis_C = in.Hysteresis_C
+	r.Webhooks = slices.Clone(in.Webhooks)
+	r.UpdatedAt = t
+}
+
+// clone returns a copy of r not sharing its webhooks; the pointers of r are replaced,
+// never written through.
+func clone(r *dto.AlertRule) dto.AlertRule {
+	c := *r
+	c.Webhooks = slices.Clone(r.Webhooks)
+	return c
+}
+
+// newID returns a random id of 16 hex digits.
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,270 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/dto"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/secret"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The headers of the notifications posted to the webhooks.
+const (
+	// SignatureHeader is the Sign of the notification, absent without a secret.
+	SignatureHeader = "X-Alert-Signature"
+	// TimestampHeader is the unix time of the delivery attempt, part of the signature
+	// so receivers can reject replays.
+	TimestampHeader = "X-Alert-Timestamp"
+	// EventHeader is the event of the notification: firing or resolved.
+	EventHeader = "X-Alert-Event"
+	// DeliveryHeader is the id of the notification, the same across the retries.
+	DeliveryHeader = "X-Alert-Delivery"
+)
+
+// WebhookConfig configures the delivery of the notifications.
+type WebhookConfig struct {
+	// URLs are the default webhooks, notified for the rules without webhooks.
+	URLs []string
+	// Allowed are the urls under which the rules may have webhooks of their own, see
+	// Allows. Without them, the rules may only name default webhooks.
+	Allowed []string
+	// Secret signs the notifications. Without it they are not signed.
+	Secret secret.Secret
+	// Timeout bounds each delivery attempt.
+	Timeout time.Duration
+	// MaxAttempts bounds the attempts of each delivery.
+	MaxAttempts int
+	// Backoff is the wait before the first retry; it doubles at each retry, up to
+	// MaxBackoff, which also bounds the Retry-After of the webhooks.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultWebhookConfig tries each delivery 5 times in about 15 seconds.
+func DefaultWebhookConfig() WebhookConfig {
+	return WebhookConfig{
+		Timeout:     5 * time.Second,
+		MaxAttempts: 5,
+		Backoff:     time.Second,
+		MaxBackoff:  time.Minute,
+	}
+}
+
+// Allows reports whether a rule may notify webhook: it is one of the URLs, or it has
+// the scheme and host of one of the Allowed urls and its path is under the path of that
+// url. Webhooks with credentials or dot segments are never allowed, so the secret only
+// signs notifications for the configured receivers.
+func (c WebhookConfig) Allows(webhook string) bool {
+	if slices.Contains(c.URLs, webhook) {
+		return true
+	}
+	u, err := url.Parse(webhook)
+	if err != nil || u.User != nil || u.Host == "" || slices.Contains(strings.Split(u.Path, "/"), "..") {
+		return false
+	}
+	for _, allowed := range c.Allowed {
+		a, err := url.Parse(allowed)
+		if err != nil || a.Host == "" {
+			continue
+		}
+		prefix := strings.TrimSuffix(a.Path, "/")
+		if strings.EqualFold(u.Scheme, a.Scheme) && strings.EqualFold(u.Host, a.Host) &&
+			(u.Path == prefix || strings.HasPrefix(u.Path, prefix+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the signature of the notification body delivered at timestamp: sha256=
+// and the hex HMAC-SHA256, keyed by key, of the timestamp, a dot and the body.
+func Sign(key, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the Sign of body delivered at timestamp, in
+// constant time.
+func Verify(key, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(signature), []byte(Sign(key, timestamp, body)))
+}
+
+// Notifier posts the notifications to the webhooks in background, signed, retrying
+// the failed deliveries. Each webhook receives its notifications one at a time, in
+// order, so a rule never resolves before it fires.
+type Notifier struct {
+	cfg    WebhookConfig
+	client *http.Client
+	// ctx bounds the deliveries, until Close.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu sync.Mutex
+	// queues are the pending deliveries by webhook, the first one being delivered.
+	queues map[string][]delivery
+	// deliveries tracks the deliveries in background, see Wait.
+	deliveries sync.WaitGroup
+}
+
+type delivery struct {
+	ctx          context.Context
+	notification dto.AlertNotification
+	body         []byte
+}
+
+// NewNotifier returns a Notifier delivering with a client bounded by cfg.Timeout.
+func NewNotifier(cfg WebhookConfig) *Notifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Notifier{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}, ctx: ctx, cancel: cancel, queues: map[string][]delivery{}}
+}
+
+// Notify posts notification to each of webhooks, or to the default webhooks if there
+// are none, in background. The deliveries outlive ctx, but are traced in it; they
+// stop at Close.
+func (n *Notifier) Notify(ctx context.Context, webhooks []string, notification dto.AlertNotification) {
+	if len(webhooks) == 0 {
+		webhooks = n.cfg.URLs
+	}
+	body, err := json.Marshal(notification)
+	if err != nil {
+		slog.Error("alert notification not encoded", "rule", notification.Rule.ID, "error", err)
+		return
+	}
+	d := delivery{ctx: trace.ContextWithSpanContext(n.ctx, trace.SpanContextFromContext(ctx)), notification: notification, body: body}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, webhook := range webhooks {
+		n.queues[webhook] = append(n.queues[webhook], d)
+		if len(n.queues[webhook]) == 1 {
+			n.deliveries.Add(1)
+			go n.drain(webhook)
+		}
+	}
+}
+
+// drain delivers the queue of webhook until it is empty.
+func (n *Notifier) drain(webhook string) {
+	defer n.deliveries.Done()
+	n.mu.Lock()
+	for len(n.queues[webhook]) > 0 {
+		d := n.queues[webhook][0]
+		n.mu.Unlock()
+		n.deliver(d.ctx, webhook, d.notification, d.body)
+		n.mu.Lock()
+		n.queues[webhook] = n.queues[webhook][1:]
+	}
+	delete(n.queues, webhook)
+	n.mu.Unlock()
+}
+
+// Wait waits for the deliveries in background.
+func (n *Notifier) Wait() {
+	n.deliveries.Wait()
+}
+
+// Close cancels the deliveries in background, without waiting for their retries, and
+// waits for them to stop.
+func (n *Notifier) Close() {
+	n.cancel()
+	n.deliveries.Wait()
+}
+
+// deliver posts body to webhook until it answers 2xx, a status not worth retrying, the
+// attempts run out, or ctx is done.
+func (n *Notifier) deliver(ctx context.Context, webhook string, notification dto.AlertNotification, body []byte) {
+	ctx, span := otel.Tracer("microservice-tracer").Start(ctx, "alert webhook")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("alert.rule", notification.Rule.ID),
+		attribute.String("alert.event", notification.Event),
+		attribute.String("alert.webhook", secret.SanitizeURL(webhook)),
+	)
+
+	backoff := n.cfg.Backoff
+	for attempt := 1; ; attempt++ {
+		wait, err := n.post(ctx, webhook, notification, body)
+		if err == nil {
+			span.SetAttributes(attribute.Int("alert.attempts", attempt))
+			return
+		}
+		// the *url.Error of a failed post carries the raw webhook, tokens included
+		err = secret.SanitizeError(err, n.cfg.Secret)
+		if wait < 0 || attempt >= n.cfg.MaxAttempts {
+			span.SetStatus(codes.Error, err.Error())
+			slog.Error("alert notification not delivered", "rule", notification.Rule.ID,
+				"webhook", secret.SanitizeURL(webhook), "attempts", attempt, "error", err)
+			return
+		}
+		if wait == 0 {
+			wait = backoff
+			backoff = min(2*backoff, n.cfg.MaxBackoff)
+		}
+		span.AddEvent("retry", trace.WithAttributes(attribute.String("error", err.Error())))
+		timer := time.NewTimer(min(wait, n.cfg.MaxBackoff))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			span.SetStatus(codes.Error, ctx.Err().Error())
+			slog.Warn("alert notification abandoned", "rule", notification.Rule.ID,
+				"webhook", secret.SanitizeURL(webhook), "attempts", attempt, "error", err)
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// post makes a delivery attempt. When it fails, wait is the Retry-After of the webhook,
+// 0 to back off, or -1 if retrying is pointless.
+func (n *Notifier) post(ctx context.Context, webhook string, notification dto.AlertNotification, body []byte) (wait time.Duration, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, notification.Event)
+	req.Header.Set(DeliveryHeader, notification.ID)
+	req.Header.Set(TimestampHeader, timestamp)
+	if key := n.cfg.Secret.Reveal(); key != "" {
+		req.Header.Set(SignatureHeader, Sign(key, timestamp, body))
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return 0, nil
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable:
+		seconds, _ := strconv.Atoi(res.Header.Get("Retry-After"))
+		return time.Duration(max(seconds, 0)) * time.Second, fmt.Errorf("webhook answered %d", res.StatusCode)
+	case res.StatusCode >= 500 || res.StatusCode == http.StatusRequestTimeout:
+		return 0, fmt.Errorf("webhook answered %d", res.StatusCode)
+	default:
+		return -1, fmt.Errorf("webhook answered %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,10 @@
+// Package api holds the OpenAPI specification of the service, served and enforced
+// by the openapi package.
+package api
+
+import _ "embed"
+
+// Spec is the json OpenAPI specification of the service.
+//
+//go:embed openapi.json
+var Spec []byte
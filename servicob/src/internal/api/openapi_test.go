@@ -0,0 +1,148 @@
+package api
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/openapi"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/validation"
+)
+
+func newTestValidator(t *testing.T) (*openapi.Validator, *error) {
+	t.Helper()
+	doc, err := openapi.Load(Spec)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	var rejected error
+	v, err := openapi.NewValidator(doc, func(w http.ResponseWriter, r *http.Request, status int, err error) {
+		rejected = err
+		w.WriteHeader(status)
+	})
+	if err != nil {
+		t.Fatalf("NewValidator() error = %v", err)
+	}
+	return v, &rejected
+}
+
+func TestValidator_Handler(t *testing.T) {
+	v, rejected := newTestValidator(t)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+
+	tests := []struct {
+		name           string
+		target         string
+		wantStatus     int
+		wantViolations validation.Errors
+	}{
+		{name: "valid", target: "/v2/weather?cep=39408-078&units=si&decimals=1", wantStatus: http.StatusNoContent},
+		{name: "empty optional parameters", target: "/v2/weather?cep=39408078&units=&decimals=", wantStatus: http.StatusNoContent},
+		{name: "unversioned", target: "/?cep=39408078", wantStatus: http.StatusNoContent},
+		{name: "unknown route", target: "/favicon.ico", wantStatus: http.StatusNoContent},
+		{name: "v2 history", target: "/v2/history?cep=39408078&interval=1h", wantStatus: http.StatusNoContent},
+		{name: "unversioned watchlist", target: "/watchlist", wantStatus: http.StatusNoContent},
+		{
+			name:       "unversioned history",
+			target:     "/history?cep=3940807A",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantViolations: validation.Errors{
+				{Field: "cep", Rule: validation.RuleFormat, Value: "3940807A", Message: "invalid zipcode"},
+			},
+		},
+		{
+			name:       "invalid cep",
+			target:     "/v2/weather?cep=3940807A",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantViolations: validation.Errors{
+				{Field: "cep", Rule: validation.RuleFormat, Value: "3940807A", Message: "invalid zipcode"},
+			},
+		},
+		{
+			name:       "missing cep",
+			target:     "/v1/weather",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantViolations: validation.Errors{
+				{Field: "cep", Rule: validation.RuleRequired, Message: "cep is required"},
+			},
+		},
+		{
+			name:       "every violation",
+			target:     "/v2/search?uf=M&city=Mo&street=Santos&page=abc&page_size=99",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantViolations: validation.Errors{
+				{Field: "uf", Rule: validation.RuleFormat, Value: "M", Message: "invalid state"},
+				{Field: "city", Rule: validation.RuleMinLength, Value: "Mo", Message: "minimum string length is 3"},
+				{Field: "page", Rule: validation.RuleFormat, Value: "abc", Message: "page is an invalid integer"},
+				{Field: "page_size", Rule: validation.RuleRange, Value: "99", Message: "number must be at most 50"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*rejected = nil
+			w := httptest.NewRecorder()
+			v.Handler(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (error %v)", w.Code, tt.wantStatus, *rejected)
+			}
+			if *rejected == nil {
+				return
+			}
+			if got := openapi.Status(*rejected); got != tt.wantStatus {
+				t.Errorf("Status() = %d, want %d", got, tt.wantStatus)
+			}
+			if got := openapi.Violations(*rejected); !reflect.DeepEqual(got, tt.wantViolations) {
+				t.Errorf("Violations() = %#v, want %#v", got, tt.wantViolations)
+			}
+		})
+	}
+}
+
+func TestValidator_ValidateResponses(t *testing.T) {
+	v, _ := newTestValidator(t)
+	v.ValidateResponses = true
+
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	tests := []struct {
+		name     string
+		body     string
+		wantWarn bool
+	}{
+		{name: "matching", body: `{"city":"Montes Claros","temp_C":25.1,"temp_F":77.18,"temp_K":298.25}`},
+		{name: "missing field", body: `{"city":"Montes Claros"}`, wantWarn: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(tt.body))
+			})
+			w := httptest.NewRecorder()
+			v.Handler(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/weather?cep=39408078", nil))
+			if w.Code != http.StatusOK || w.Body.String() != tt.body || w.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("response = %d %q %q, want it unchanged", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+			}
+			if got := strings.Contains(logs.String(), "does not match"); got != tt.wantWarn {
+				t.Errorf("warned = %v, want %v; logs: %s", got, tt.wantWarn, logs.String())
+			}
+		})
+	}
+}
+
+func TestSpecHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	openapi.SpecHandler(Spec)(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" || !bytes.Equal(w.Body.Bytes(), Spec) {
+		t.Errorf("SpecHandler() = %d %q, want the spec", w.Code, w.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,70 @@
+package dto
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// The comparisons of the alert rules.
+const (
+	AlertAbove = "above" // the rule fires when the temperature exceeds the threshold
+	AlertBelow = "below" // the rule fires when the temperature drops below the threshold
+)
+
+// The states of the alert rules, and the events of their notifications.
+const (
+	AlertOK       = "ok"
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// AlertRuleInput is the body of the creation and of the update of an alert rule.
+// Threshold_C is a pointer to tell a missing threshold from 0 °C.
+type AlertRuleInput struct {
+	Cep          string   `json:"cep"`
+	Comparison   string   `json:"comparison"`
+	Threshold_C  *float64 `json:"threshold_C"`
+	Hysteresis_C float64  `json:"hysteresis_C"`
+	Webhooks     []string `json:"webhooks,omitempty"`
+}
+
+// AlertRule fires when the temperature observed in the city of Cep, City of UF, is above,
+// or below, Threshold_C, and resolves once it is back Hysteresis_C past the threshold.
+// Webhooks are notified of both; without them, the default webhooks are. Temp_C and
+// ObservedAt are the last observation evaluated, and Since when the rule entered its
+// State.
+type AlertRule struct {
+	XMLName      xml.Name   `json:"-" xml:"alert_rule"`
+	ID           string     `json:"id" xml:"id"`
+	Cep          string     `json:"cep" xml:"cep"`
+	City         string     `json:"city" xml:"city"`
+	UF           string     `json:"uf" xml:"uf"`
+	Comparison   string     `json:"comparison" xml:"comparison"`
+	Threshold_C  float64    `json:"threshold_C" xml:"threshold_C"`
+	Hysteresis_C float64    `json:"hysteresis_C" xml:"hysteresis_C"`
+	Webhooks     []string   `json:"webhooks,omitempty" xml:"webhooks>webhook,omitempty"`
+	State        string     `json:"state" xml:"state"`
+	Since        *time.Time `json:"since,omitempty" xml:"since,omitempty"`
+	Temp_C       *float64   `json:"temp_C,omitempty" xml:"temp_C,omitempty"`
+	ObservedAt   *time.Time `json:"observed_at,omitempty" xml:"observed_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at" xml:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at" xml:"updated_at"`
+}
+
+// AlertRules is the response of the list of the alert rules.
+type AlertRules struct {
+	XMLName xml.Name    `json:"-" xml:"alert_rules"`
+	Rules   []AlertRule `json:"rules" xml:"alert_rule"`
+}
+
+// AlertNotification is the body posted to the webhooks when a rule fires or resolves.
+// ID identifies the notification across the retries of its delivery.
+type AlertNotification struct {
+	ID         string    `json:"id"`
+	Event      string    `json:"event"`
+	Rule       AlertRule `json:"rule"`
+	City       string    `json:"city"`
+	State      string    `json:"state"`
+	Temp_C     float64   `json:"temp_C"`
+	ObservedAt time.Time `json:"observed_at"`
+}
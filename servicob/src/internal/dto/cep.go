@@ -2,18 +2,26 @@ package dto
 
 import (
 	"encoding/json"
-	"errors"
+	"encoding/xml"
 	"log/slog"
 
-	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/shared"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/shared"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/validation"
 )
 
 type Cep struct {
-	Cep          string `json:"cep"`
-	State        string `json:"state"`
-	City         string `json:"city"`
-	Neighborhood string `json:"neighborhood"`
-	Street       string `json:"street"`
+	XMLName      xml.Name `json:"-" xml:"cep"`
+	Cep          string   `json:"cep" xml:"cep"`
+	State        string   `json:"state" xml:"state"`
+	City         string   `json:"city" xml:"city"`
+	Neighborhood string   `json:"neighborhood" xml:"neighborhood"`
+	Street       string   `json:"street" xml:"street"`
+	Ibge         string   `json:"ibge" xml:"ibge"`
+	Ddd          string   `json:"ddd" xml:"ddd"`
+	Region       string   `json:"region" xml:"region"`
+	// Partial is true when the provider response was accepted with validation
+	// warnings, e.g. a general cep without street or neighborhood.
+	Partial bool `json:"partial,omitempty" xml:"partial,omitempty"`
 }
 
 // NewCep creates a new Cep instance with the provided details and validates it.
@@ -47,21 +55,29 @@ func (c *Cep) ToJson() (string, error) {
 // Validate validates the Cep fields and returns an error if any of them are invalid.
 // It checks if the cep is valid, uf is a valid short state name,
 // city, neighborhood and street are not empty.
+// The error is a validation.Errors with every violation found.
 func (c *Cep) Validate() error {
+	var errs validation.Errors
 	if _, err := shared.ValidateCep(c.Cep); err != nil {
-		return err
+		errs.Add("cep", validation.RuleFormat, c.Cep, err.Error())
 	}
 	if !shared.ValidateStateShort(c.State) {
-		return errors.New("state not found")
+		errs.Add("state", validation.RuleOneOf, c.State, "state not found")
 	}
-	if c.City == "" || c.Neighborhood == "" || c.Street == "" {
-		return errors.New("city, neighborhood and street must not be empty")
+	if c.City == "" {
+		errs.Add("city", validation.RuleRequired, c.City, "city must not be empty")
 	}
-	return nil
+	if c.Neighborhood == "" {
+		errs.Add("neighborhood", validation.RuleRequired, c.Neighborhood, "neighborhood must not be empty")
+	}
+	if c.Street == "" {
+		errs.Add("street", validation.RuleRequired, c.Street, "street must not be empty")
+	}
+	return errs.Err()
 }
 
 // LogValue returns a slog.Value representing the Cep instance.
-// It includes fields such as cep, street, neighborhood, city, and state
+// It includes fields such as cep, street, neighborhood, city, state, ibge, ddd and region
 // in a grouped format for logging purposes.
 func (c *Cep) LogValue() slog.Value {
 	return slog.GroupValue(
@@ -70,5 +86,8 @@ func (c *Cep) LogValue() slog.Value {
 		slog.String("neighborhood", c.Neighborhood),
 		slog.String("city", c.City),
 		slog.String("state", c.State),
+		slog.String("ibge", c.Ibge),
+		slog.String("ddd", c.Ddd),
+		slog.String("region", c.Region),
 	)
 }
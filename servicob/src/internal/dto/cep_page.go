@@ -0,0 +1,31 @@
+package dto
+
+import "encoding/xml"
+
+// CepPage is a page of Cep results of an address search.
+type CepPage struct {
+	XMLName  xml.Name `json:"-" xml:"cep_page"`
+	Items    []Cep    `json:"items" xml:"items>cep"`
+	Page     int      `json:"page" xml:"page"`
+	PageSize int      `json:"page_size" xml:"page_size"`
+	Total    int      `json:"total" xml:"total"`
+}
+
+// NewCepPage returns the page-th page (starting at 1) of items, with pageSize items per page.
+// A page past the end of items is returned empty.
+func NewCepPage(items []Cep, page, pageSize int) CepPage {
+	start := (page - 1) * pageSize
+	if start > len(items) {
+		start = len(items)
+	}
+	end := start + pageSize
+	if end > len(items) {
+		end = len(items)
+	}
+	return CepPage{
+		Items:    append([]Cep{}, items[start:end]...),
+		Page:     page,
+		PageSize: pageSize,
+		Total:    len(items),
+	}
+}
@@ -0,0 +1,204 @@
+package dto
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/validation"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The csv and protobuf encodings of the responses. The protobuf messages are
+// described in api/weather.proto; keep the field numbers in sync with it.
+
+// MarshalCSV returns the header and the row of the response.
+func (t TempResponse) MarshalCSV() [][]string {
+	temp := ""
+	if t.Temp != nil {
+		temp = formatFloat(*t.Temp)
+	}
+	observedAt := ""
+	if !t.ObservedAt.IsZero() {
+		observedAt = t.ObservedAt.UTC().Format(time.RFC3339)
+	}
+	return [][]string{
+		{"city", "temp_C", "temp_F", "temp_K", "temp", "unit", "units", "partial", "observed_at", "stale"},
+		{t.City, formatFloat(t.Temp_C), formatFloat(t.Temp_F), formatFloat(t.Temp_K), temp,
+			string(t.Unit), string(t.Units), strconv.FormatBool(t.Partial), observedAt, strconv.FormatBool(t.Stale)},
+	}
+}
+
+// MarshalProto returns the TempResponse message of the response.
+func (t TempResponse) MarshalProto() ([]byte, error) {
+	var b []byte
+	b = appendString(b, 1, t.City)
+	b = appendDouble(b, 2, t.Temp_C)
+	b = appendDouble(b, 3, t.Temp_F)
+	b = appendDouble(b, 4, t.Temp_K)
+	if t.Temp != nil {
+		b = protowire.AppendTag(b, 5, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(*t.Temp))
+	}
+	b = appendString(b, 6, string(t.Unit))
+	b = appendString(b, 7, string(t.Units))
+	b = appendBool(b, 8, t.Partial)
+	if !t.ObservedAt.IsZero() {
+		b = appendInt(b, 9, int(t.ObservedAt.Unix()))
+	}
+	b = appendBool(b, 10, t.Stale)
+	return b, nil
+}
+
+// MarshalCSV returns the header and the row of the response.
+func (t TempResponseV1) MarshalCSV() [][]string {
+	return [][]string{
+		{"city", "temp_C", "temp_F", "temp_K"},
+		{t.City, formatFloat(t.Temp_C), formatFloat(t.Temp_F), formatFloat(t.Temp_K)},
+	}
+}
+
+// MarshalProto returns the TempResponse message of the response, without the fields
+// added after v1.
+func (t TempResponseV1) MarshalProto() ([]byte, error) {
+	var b []byte
+	b = appendString(b, 1, t.City)
+	b = appendDouble(b, 2, t.Temp_C)
+	b = appendDouble(b, 3, t.Temp_F)
+	b = appendDouble(b, 4, t.Temp_K)
+	return b, nil
+}
+
+// MarshalCSV returns the header and one row per observation of the history.
+func (h History) MarshalCSV() [][]string {
+	records := [][]string{{"cep", "observed_at", "temp_C", "provider"}}
+	for _, p := range h.Points {
+		records = append(records, []string{h.Cep, p.ObservedAt.UTC().Format(time.RFC3339), formatFloat(p.Temp_C), p.Provider})
+	}
+	return records
+}
+
+var cepCSVHeader = []string{"cep", "state", "city", "neighborhood", "street", "ibge", "ddd", "region", "partial"}
+
+func (c Cep) csvRecord() []string {
+	return []string{c.Cep, c.State, c.City, c.Neighborhood, c.Street, c.Ibge, c.Ddd, c.Region, strconv.FormatBool(c.Partial)}
+}
+
+// MarshalCSV returns the header and the row of the address.
+func (c Cep) MarshalCSV() [][]string {
+	return [][]string{cepCSVHeader, c.csvRecord()}
+}
+
+// MarshalProto returns the Cep message of the address.
+func (c Cep) MarshalProto() ([]byte, error) {
+	var b []byte
+	b = appendString(b, 1, c.Cep)
+	b = appendString(b, 2, c.State)
+	b = appendString(b, 3, c.City)
+	b = appendString(b, 4, c.Neighborhood)
+	b = appendString(b, 5, c.Street)
+	b = appendString(b, 6, c.Ibge)
+	b = appendString(b, 7, c.Ddd)
+	b = appendString(b, 8, c.Region)
+	b = appendBool(b, 9, c.Partial)
+	return b, nil
+}
+
+// MarshalCSV returns the header and one row per address of the page. The paging
+// fields are not part of the csv.
+func (p CepPage) MarshalCSV() [][]string {
+	records := [][]string{cepCSVHeader}
+	for _, c := range p.Items {
+		records = append(records, c.csvRecord())
+	}
+	return records
+}
+
+// MarshalProto returns the CepPage message of the page.
+func (p CepPage) MarshalProto() ([]byte, error) {
+	var b []byte
+	for _, c := range p.Items {
+		item, err := c.MarshalProto()
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, item)
+	}
+	b = appendInt(b, 2, p.Page)
+	b = appendInt(b, 3, p.PageSize)
+	b = appendInt(b, 4, p.Total)
+	return b, nil
+}
+
+// MarshalCSV returns the header and one row per violation of the error, or a single
+// row without violation fields when there are none.
+func (e ErrorResponse) MarshalCSV() [][]string {
+	records := [][]string{{"code", "message", "field", "rule", "value", "violation"}}
+	if len(e.Violations) == 0 {
+		return append(records, []string{e.Code, e.Message, "", "", "", ""})
+	}
+	for _, v := range e.Violations {
+		records = append(records, []string{e.Code, e.Message, v.Field, v.Rule, v.Value, v.Message})
+	}
+	return records
+}
+
+// MarshalProto returns the ErrorResponse message of the error.
+func (e ErrorResponse) MarshalProto() ([]byte, error) {
+	var b []byte
+	b = appendString(b, 1, e.Code)
+	b = appendString(b, 2, e.Message)
+	for _, v := range e.Violations {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, marshalViolation(v))
+	}
+	return b, nil
+}
+
+func marshalViolation(v validation.Violation) []byte {
+	var b []byte
+	b = appendString(b, 1, v.Field)
+	b = appendString(b, 2, v.Rule)
+	b = appendString(b, 3, v.Value)
+	b = appendString(b, 4, v.Message)
+	return b
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// The append helpers follow proto3: fields with the zero value are not written.
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendDouble(b []byte, num protowire.Number, f float64) []byte {
+	if f == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(f))
+}
+
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, protowire.EncodeBool(v))
+}
+
+func appendInt(b []byte, num protowire.Number, i int) []byte {
+	if i == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(int64(i)))
+}
@@ -0,0 +1,104 @@
+package dto
+
+import (
+	"encoding/xml"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/validation"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protoFields decodes the top level fields of a protobuf message, keeping the last value
+// of each field number; bytes fields are returned as strings.
+func protoFields(t *testing.T, b []byte) map[protowire.Number]any {
+	t.Helper()
+	fields := map[protowire.Number]any{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("invalid tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			fields[num], b = v, b[n:]
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			fields[num], b = math.Float64frombits(v), b[n:]
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			fields[num], b = string(v), b[n:]
+		default:
+			t.Fatalf("unexpected wire type %v", typ)
+		}
+	}
+	return fields
+}
+
+func TestTempResponse_MarshalProto(t *testing.T) {
+	temp := 80.6
+	b, err := TempResponse{City: "Montes Claros", Temp_C: 27, Temp_F: 80.6, Temp_K: 300.15, Temp: &temp, Unit: "F", Units: "imperial"}.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[protowire.Number]any{1: "Montes Claros", 2: 27.0, 3: 80.6, 4: 300.15, 5: 80.6, 6: "F", 7: "imperial"}
+	if got := protoFields(t, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("MarshalProto() = %v, want %v", got, want)
+	}
+}
+
+func TestTempResponse_MarshalProto_Stale(t *testing.T) {
+	b, err := TempResponse{City: "Montes Claros", Temp_C: 27, ObservedAt: time.Unix(1792411200, 0), Stale: true}.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[protowire.Number]any{1: "Montes Claros", 2: 27.0, 9: uint64(1792411200), 10: uint64(1)}
+	if got := protoFields(t, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("MarshalProto() = %v, want %v", got, want)
+	}
+}
+
+func TestErrorResponse_MarshalProto(t *testing.T) {
+	b, err := ErrorResponse{Code: "invalid_input", Message: "Unprocessable Entity",
+		Violations: []validation.Violation{{Field: "cep", Rule: "format", Value: "1", Message: "invalid zipcode"}}}.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := protoFields(t, b)
+	if got[1] != "invalid_input" || got[2] != "Unprocessable Entity" {
+		t.Errorf("MarshalProto() = %v", got)
+	}
+	violation := protoFields(t, []byte(got[3].(string)))
+	want := map[protowire.Number]any{1: "cep", 2: "format", 3: "1", 4: "invalid zipcode"}
+	if !reflect.DeepEqual(violation, want) {
+		t.Errorf("violation = %v, want %v", violation, want)
+	}
+}
+
+func TestCepPage_MarshalCSV(t *testing.T) {
+	p := CepPage{Items: []Cep{{Cep: "39400-001", State: "MG", City: "Montes Claros"}}, Page: 1, PageSize: 10, Total: 1}
+	want := [][]string{
+		{"cep", "state", "city", "neighborhood", "street", "ibge", "ddd", "region", "partial"},
+		{"39400-001", "MG", "Montes Claros", "", "", "", "", "", "false"},
+	}
+	if got := p.MarshalCSV(); !reflect.DeepEqual(got, want) {
+		t.Errorf("MarshalCSV() = %v, want %v", got, want)
+	}
+}
+
+func TestCepPage_MarshalXML(t *testing.T) {
+	p := CepPage{Items: []Cep{{Cep: "39400-001", State: "MG"}}, Page: 1, PageSize: 10, Total: 1}
+	b, err := xml.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<cep_page><items><cep><cep>39400-001</cep><state>MG</state><city></city><neighborhood></neighborhood>" +
+		"<street></street><ibge></ibge><ddd></ddd><region></region></cep></items><page>1</page><page_size>10</page_size><total>1</total></cep_page>"
+	if string(b) != want {
+		t.Errorf("xml.Marshal() = %s, want %s", b, want)
+	}
+}
@@ -0,0 +1,47 @@
+package dto
+
+import (
+	"encoding/xml"
+	"net/http"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/validation"
+)
+
+// ErrorResponse is the json body of the error responses.
+type ErrorResponse struct {
+	XMLName    xml.Name               `json:"-" xml:"error"`
+	Code       string                 `json:"code" xml:"code"`
+	Message    string                 `json:"message" xml:"message"`
+	Violations []validation.Violation `json:"violations,omitempty" xml:"violations>violation,omitempty"`
+}
+
+// ErrorCodeHeader carries the code of the error responses, so clients can read it
+// whatever the media type of the body.
+const ErrorCodeHeader = "X-Error-Code"
+
+var errorCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusNotFound:              "not_found",
+	http.StatusNotAcceptable:         "not_acceptable",
+	http.StatusRequestEntityTooLarge: "too_large",
+	http.StatusRequestTimeout:        "timeout",
+	http.StatusUnprocessableEntity:   "invalid_input",
+	http.StatusTooManyRequests:       "rate_limited",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusServiceUnavailable:    "unavailable",
+	http.StatusGatewayTimeout:        "not_cached",
+}
+
+// NewErrorResponse returns the error response for status, with a machine readable code
+// derived from it, message and the validation violations found in err, if any.
+func NewErrorResponse(status int, message string, err error) ErrorResponse {
+	code, ok := errorCodes[status]
+	if !ok {
+		code = "error"
+	}
+	return ErrorResponse{
+		Code:       code,
+		Message:    message,
+		Violations: validation.Violations(err),
+	}
+}
@@ -0,0 +1,44 @@
+package dto
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// History is the response of /history: the temperatures observed in the city of a cep
+// from From to To, with their statistics, by Interval if one was requested.
+type History struct {
+	XMLName  xml.Name        `json:"-" xml:"history"`
+	Cep      string          `json:"cep" xml:"cep"`
+	City     string          `json:"city,omitempty" xml:"city,omitempty"`
+	State    string          `json:"state,omitempty" xml:"state,omitempty"`
+	From     time.Time       `json:"from" xml:"from"`
+	To       time.Time       `json:"to" xml:"to"`
+	Interval string          `json:"interval,omitempty" xml:"interval,omitempty"`
+	Summary  HistoryStats    `json:"summary" xml:"summary"`
+	Buckets  []HistoryBucket `json:"buckets,omitempty" xml:"buckets>bucket,omitempty"`
+	Points   []HistoryPoint  `json:"points" xml:"points>point"`
+}
+
+// HistoryPoint is a temperature observed by Provider.
+type HistoryPoint struct {
+	ObservedAt time.Time `json:"observed_at" xml:"observed_at"`
+	Temp_C     float64   `json:"temp_C" xml:"temp_C"`
+	Provider   string    `json:"provider" xml:"provider"`
+}
+
+// HistoryStats are the minimum, maximum and average of Count temperatures, in °C.
+// They are zero when Count is.
+type HistoryStats struct {
+	Count int     `json:"count" xml:"count"`
+	Min_C float64 `json:"min_C" xml:"min_C"`
+	Max_C float64 `json:"max_C" xml:"max_C"`
+	Avg_C float64 `json:"avg_C" xml:"avg_C"`
+}
+
+// HistoryBucket are the statistics of the temperatures observed in the interval
+// starting at Start.
+type HistoryBucket struct {
+	Start time.Time `json:"start" xml:"start"`
+	HistoryStats
+}
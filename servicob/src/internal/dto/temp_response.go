@@ -1,8 +1,84 @@
 package dto
 
+import (
+	"encoding/xml"
+	"time"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/units"
+)
+
 type TempResponse struct {
-	City   string  `json:"city"`
-	Temp_C float64 `json:"temp_C"`
-	Temp_F float64 `json:"temp_F"`
-	Temp_K float64 `json:"temp_K"`
+	XMLName xml.Name `json:"-" xml:"weather"`
+	City    string   `json:"city" xml:"city"`
+	Temp_C  float64  `json:"temp_C" xml:"temp_C"`
+	Temp_F  float64  `json:"temp_F" xml:"temp_F"`
+	Temp_K  float64  `json:"temp_K" xml:"temp_K"`
+	// Temp is the temperature in Unit, the unit of the requested Units system.
+	Temp  *float64     `json:"temp,omitempty" xml:"temp,omitempty"`
+	Unit  units.Unit   `json:"unit,omitempty" xml:"unit,omitempty"`
+	Units units.System `json:"units,omitempty" xml:"units,omitempty"`
+	// Partial is true when the address of the cep was accepted with validation warnings.
+	Partial bool `json:"partial,omitempty" xml:"partial,omitempty"`
+	// ObservedAt is when the weather provider observed the temperature, zero if unknown.
+	ObservedAt time.Time `json:"observed_at,omitzero" xml:"-"`
+	// Stale is true when the observation is served from the cache after its TTL, because
+	// it is being refreshed or because the weather provider failed.
+	Stale bool `json:"stale,omitempty" xml:"stale,omitempty"`
+}
+
+// MarshalXML encodes the response with observed_at, omitted when unknown as in json.
+func (t TempResponse) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type plain TempResponse
+	v := struct {
+		plain
+		ObservedAt *time.Time `xml:"observed_at,omitempty"`
+	}{plain: plain(t)}
+	if !t.ObservedAt.IsZero() {
+		v.ObservedAt = &t.ObservedAt
+	}
+	// a Marshaler gets the name of its type, not the one of its XMLName field
+	start.Name = xml.Name{Local: "weather"}
+	return e.EncodeElement(v, start)
+}
+
+// NewTempResponse returns the TempResponse of the temperature t in city, in every unit
+// and without rounding.
+func NewTempResponse(city string, t units.Temperature) TempResponse {
+	return TempResponse{
+		City:   city,
+		Temp_C: t.Celsius(),
+		Temp_F: t.Fahrenheit(),
+		Temp_K: t.Kelvin(),
+	}
+}
+
+// Format returns the response with the temperatures rounded to decimals places, and
+// Temp set to the temperature in the unit of system.
+// The conversions start from Temp_C, so rounding is applied only once.
+func (t TempResponse) Format(system units.System, decimals int) TempResponse {
+	temp := units.FromCelsius(t.Temp_C)
+	value := units.Round(temp.In(system.Unit()), decimals)
+
+	t.Temp_C = units.Round(temp.Celsius(), decimals)
+	t.Temp_F = units.Round(temp.Fahrenheit(), decimals)
+	t.Temp_K = units.Round(temp.Kelvin(), decimals)
+	t.Temp = &value
+	t.Unit = system.Unit()
+	t.Units = system
+	return t
+}
+
+// TempResponseV1 is the response of /v1/weather: the original model, with the city and
+// its temperature in every unit only. It must not change; new fields go in TempResponse.
+type TempResponseV1 struct {
+	XMLName xml.Name `json:"-" xml:"weather"`
+	City    string   `json:"city" xml:"city"`
+	Temp_C  float64  `json:"temp_C" xml:"temp_C"`
+	Temp_F  float64  `json:"temp_F" xml:"temp_F"`
+	Temp_K  float64  `json:"temp_K" xml:"temp_K"`
+}
+
+// V1 returns the response in the v1 model.
+func (t TempResponse) V1() TempResponseV1 {
+	return TempResponseV1{City: t.City, Temp_C: t.Temp_C, Temp_F: t.Temp_F, Temp_K: t.Temp_K}
 }
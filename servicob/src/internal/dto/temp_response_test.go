@@ -0,0 +1,107 @@
+package dto
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/units"
+)
+
+func TestTempResponse_Format(t *testing.T) {
+	temps := NewTempResponse("Montes Claros", units.FromCelsius(26.2))
+	tests := []struct {
+		name     string
+		system   units.System
+		decimals int
+		want     string
+	}{
+		{
+			name:     "metric",
+			system:   units.Metric,
+			decimals: 2,
+			want:     `{"city":"Montes Claros","temp_C":26.2,"temp_F":79.16,"temp_K":299.35,"temp":26.2,"unit":"C","units":"metric"}`,
+		},
+		{
+			name:     "imperial",
+			system:   units.Imperial,
+			decimals: 1,
+			// 26.2 + 273.15 is 299.34999999999997 in float64
+			want: `{"city":"Montes Claros","temp_C":26.2,"temp_F":79.2,"temp_K":299.3,"temp":79.2,"unit":"F","units":"imperial"}`,
+		},
+		{
+			name:     "si",
+			system:   units.SI,
+			decimals: 0,
+			want:     `{"city":"Montes Claros","temp_C":26,"temp_F":79,"temp_K":299,"temp":299,"unit":"K","units":"si"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j, err := json.Marshal(temps.Format(tt.system, tt.decimals))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(j) != tt.want {
+				t.Errorf("TempResponse.Format() = %s, want %s", j, tt.want)
+			}
+		})
+	}
+}
+
+func TestTempResponse_V1(t *testing.T) {
+	temps := NewTempResponse("Montes Claros", units.FromCelsius(26.2)).Format(units.Imperial, 2)
+	temps.Partial = true
+	j, err := json.Marshal(temps.V1())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"city":"Montes Claros","temp_C":26.2,"temp_F":79.16,"temp_K":299.35}`
+	if string(j) != want {
+		t.Errorf("TempResponse.V1() = %s, want %s", j, want)
+	}
+}
+
+func TestTempResponse_ObservedAtAndStale(t *testing.T) {
+	observed := NewTempResponse("Montes Claros", units.FromCelsius(27))
+	observed.ObservedAt = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	observed.Stale = true
+	tests := []struct {
+		name     string
+		temps    TempResponse
+		wantJSON string
+		wantXML  string
+	}{
+		{
+			name:     "unknown observation",
+			temps:    NewTempResponse("Montes Claros", units.FromCelsius(27)),
+			wantJSON: `{"city":"Montes Claros","temp_C":27,"temp_F":80.6,"temp_K":300.15}`,
+			wantXML:  `<weather><city>Montes Claros</city><temp_C>27</temp_C><temp_F>80.6</temp_F><temp_K>300.15</temp_K></weather>`,
+		},
+		{
+			name:     "stale observation",
+			temps:    observed,
+			wantJSON: `{"city":"Montes Claros","temp_C":27,"temp_F":80.6,"temp_K":300.15,"observed_at":"2026-10-19T12:00:00Z","stale":true}`,
+			wantXML:  `<weather><city>Montes Claros</city><temp_C>27</temp_C><temp_F>80.6</temp_F><temp_K>300.15</temp_K><stale>true</stale><observed_at>2026-10-19T12:00:00Z</observed_at></weather>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j, err := json.Marshal(tt.temps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(j) != tt.wantJSON {
+				t.Errorf("json.Marshal() = %s, want %s", j, tt.wantJSON)
+			}
+			x, err := xml.Marshal(tt.temps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(x) != tt.wantXML {
+				t.Errorf("xml.Marshal() = %s, want %s", x, tt.wantXML)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package dto
+
+import (
+	"errors"
+	"strings"
+)
+
+// ValidationProfile selects how strictly the provider responses are validated.
+type ValidationProfile string
+
+const (
+	// Strict requires every address field: cep, uf, estado, regiao, localidade,
+	// bairro and logradouro.
+	Strict ValidationProfile = "strict"
+	// Lenient only requires cep, uf and localidade, so general ceps, which cover a
+	// whole city and have no street or neighborhood, are accepted. Any other problem
+	// is reported as a warning.
+	Lenient ValidationProfile = "lenient"
+)
+
+// ParseValidationProfile parses the name of a profile, ignoring case.
+// An empty name is the Lenient profile.
+func ParseValidationProfile(name string) (ValidationProfile, error) {
+	switch ValidationProfile(strings.ToLower(strings.TrimSpace(name))) {
+	case Strict:
+		return Strict, nil
+	case Lenient, "":
+		return Lenient, nil
+	default:
+		return "", errors.New("unknown validation profile " + name + ", want strict or lenient")
+	}
+}
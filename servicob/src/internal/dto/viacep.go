@@ -2,9 +2,10 @@ package dto
 
 import (
 	"encoding/json"
-	"errors"
+	"strings"
 
-	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/shared"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/shared"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/validation"
 )
 
 type Viacep struct {
@@ -64,25 +65,87 @@ func NewViacepFromJson(jsonString string) (*Viacep, error) {
 	return &v, nil
 }
 
-// Validate validates the Viacep fields and returns an error if any of them are invalid.
-// It checks if the cep is valid, uf is a valid short state name, estado is a valid long state name,
-// regiao is a valid region, localidade, bairro and logradouro are not empty.
+// ToCep converts the Viacep response to a normalized Cep, trimming the white space
+// around every field.
+func (v *Viacep) ToCep() Cep {
+	return Cep{
+		Cep:          strings.TrimSpace(v.Cep),
+		State:        strings.TrimSpace(v.Uf),
+		City:         strings.TrimSpace(v.Localidade),
+		Neighborhood: strings.TrimSpace(v.Bairro),
+		Street:       strings.TrimSpace(v.Logradouro),
+		Ibge:         strings.TrimSpace(v.Ibge),
+		Ddd:          strings.TrimSpace(v.Ddd),
+		Region:       strings.TrimSpace(v.Regiao),
+	}
+}
+
+// ParseViacep creates a new Viacep instance from a JSON string and validates it with the
+// given profile. It returns the Viacep instance and the validation warnings, or an error if
+// the JSON is invalid or validation fails.
+func ParseViacep(jsonString string, profile ValidationProfile) (*Viacep, validation.Errors, error) {
+	var v Viacep
+	if err := json.Unmarshal([]byte(jsonString), &v); err != nil {
+		return nil, nil, err
+	}
+	warnings, err := v.ValidateWith(profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &v, warnings, nil
+}
+
+// Validate validates the Viacep fields with the Strict profile and returns an error if any
+// of them are invalid.
+// It checks if the cep is valid, uf is a valid short state name, estado is the name of
+// that state and regiao is its region, and localidade, bairro and logradouro are not empty.
+// The error is a validation.Errors with every violation found.
 func (v *Viacep) Validate() error {
+	_, err := v.ValidateWith(Strict)
+	return err
+}
+
+// ValidateWith validates the Viacep fields with the given profile.
+//
+// With Strict, any violation is an error, like Validate. With Lenient, only an invalid cep
+// or uf, or an empty localidade, is an error; the other violations are returned as warnings,
+// and the record can still be used. The error, if any, is a validation.Errors.
+func (v *Viacep) ValidateWith(profile ValidationProfile) (warnings validation.Errors, err error) {
+	var required, other validation.Errors
+
 	if _, err := shared.ValidateCepWithDash(v.Cep); err != nil {
-		return err
+		required.Add("cep", validation.RuleFormat, v.Cep, "cep must have 8 digits, with '-'")
 	}
-	if !shared.ValidateStateShort(v.Uf) {
-		return errors.New("uf not found")
+	state, ok := shared.StateByUF(v.Uf)
+	if !ok {
+		required.Add("uf", validation.RuleOneOf, v.Uf, "uf not found")
 	}
-	if !shared.ValidateStateLong(v.Estado) {
-		return errors.New("estado not found")
+	if strings.TrimSpace(v.Localidade) == "" {
+		required.Add("localidade", validation.RuleRequired, v.Localidade, "localidade must not be empty")
+	}
+
+	if estado, found := shared.StateByName(v.Estado); !found {
+		other.Add("estado", validation.RuleOneOf, v.Estado, "estado not found")
+	} else if ok && estado.UF != state.UF {
+		other.Add("estado", validation.RuleMatch, v.Estado, "estado does not match uf "+v.Uf)
 	}
-	if !shared.ValidateRegiao(v.Regiao) {
-		return errors.New("regiao not found")
+	if regiao, found := shared.ParseRegion(v.Regiao); !found {
+		other.Add("regiao", validation.RuleOneOf, v.Regiao, "regiao not found")
+	} else if ok && regiao != state.Region {
+		other.Add("regiao", validation.RuleMatch, v.Regiao, "regiao does not match uf "+v.Uf)
 	}
-	if v.Localidade == "" || v.Bairro == "" || v.Logradouro == "" {
-		return errors.New("localidade, bairro and logradouro must not be empty")
+	if strings.TrimSpace(v.Bairro) == "" {
+		other.Add("bairro", validation.RuleRequired, v.Bairro, "bairro must not be empty")
+	}
+	if strings.TrimSpace(v.Logradouro) == "" {
+		other.Add("logradouro", validation.RuleRequired, v.Logradouro, "logradouro must not be empty")
 	}
 
-	return nil
+	if profile == Strict {
+		return nil, append(required, other...).Err()
+	}
+	if err := required.Err(); err != nil {
+		return nil, err
+	}
+	return other, nil
 }
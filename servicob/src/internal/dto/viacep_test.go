@@ -1,8 +1,14 @@
 package dto
 
 import (
+	"encoding/json"
+	"errors"
+	"net/http"
 	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/validation"
 )
 
 func TestNewViacep(t *testing.T) {
@@ -288,6 +294,57 @@ func TestViacep_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "validate viacep estado without accents",
+			v: &Viacep{
+				Cep:        "29010-000",
+				Logradouro: "Avenida Jerônimo Monteiro",
+				Bairro:     "Centro",
+				Localidade: "Vitória",
+				Uf:         "ES",
+				Estado:     "Espirito Santo",
+				Regiao:     "Sudeste",
+			},
+			wantErr: false,
+		},
+		{
+			name: "validate viacep estado does not match uf",
+			v: &Viacep{
+				Cep:         "39408-078",
+				Logradouro:  "Avenida Herlindo Silveira",
+				Complemento: "Apto 101",
+				Unidade:     "Sala 101",
+				Bairro:      "Centro",
+				Localidade:  "Montes Claros",
+				Uf:          "MG",
+				Estado:      "São Paulo",
+				Regiao:      "Sudeste",
+				Ibge:        "3143302",
+				Gia:         "",
+				Ddd:         "38",
+				Siafi:       "4865",
+			},
+			wantErr: true,
+		},
+		{
+			name: "validate viacep regiao does not match uf",
+			v: &Viacep{
+				Cep:         "39408-078",
+				Logradouro:  "Avenida Herlindo Silveira",
+				Complemento: "Apto 101",
+				Unidade:     "Sala 101",
+				Bairro:      "Centro",
+				Localidade:  "Montes Claros",
+				Uf:          "MG",
+				Estado:      "Minas Gerais",
+				Regiao:      "Nordeste",
+				Ibge:        "3143302",
+				Gia:         "",
+				Ddd:         "38",
+				Siafi:       "4865",
+			},
+			wantErr: true,
+		},
 		{
 			name: "validate viacep logradouro error",
 			v: &Viacep{
@@ -354,3 +411,129 @@ func TestViacep_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestViacep_ValidateWith(t *testing.T) {
+	general := Viacep{
+		Cep:        "39480-000",
+		Localidade: "Janaúba",
+		Uf:         "MG",
+		Estado:     "Minas Gerais",
+		Regiao:     "Sudeste",
+		Ibge:       "3135100",
+		Ddd:        "38",
+	}
+	mismatch := general
+	mismatch.Estado = "Bahia"
+	noCity := general
+	noCity.Localidade = " "
+	noUf := general
+	noUf.Uf = ""
+
+	tests := []struct {
+		name         string
+		v            Viacep
+		profile      ValidationProfile
+		wantWarnings int
+		wantErr      bool
+	}{
+		{
+			name:    "strict general cep",
+			v:       general,
+			profile: Strict,
+			wantErr: true,
+		},
+		{
+			name:         "lenient general cep",
+			v:            general,
+			profile:      Lenient,
+			wantWarnings: 2,
+		},
+		{
+			name:         "lenient estado mismatch",
+			v:            mismatch,
+			profile:      Lenient,
+			wantWarnings: 3,
+		},
+		{
+			name:    "lenient without city",
+			v:       noCity,
+			profile: Lenient,
+			wantErr: true,
+		},
+		{
+			name:    "lenient without uf",
+			v:       noUf,
+			profile: Lenient,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, err := tt.v.ValidateWith(tt.profile)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Viacep.ValidateWith() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("Viacep.ValidateWith() warnings = %v, want %v warnings", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestParseValidationProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		want    ValidationProfile
+		wantErr bool
+	}{
+		{name: "default", profile: "", want: Lenient},
+		{name: "strict", profile: "STRICT", want: Strict},
+		{name: "lenient", profile: " lenient ", want: Lenient},
+		{name: "unknown", profile: "loose", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseValidationProfile(tt.profile)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseValidationProfile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseValidationProfile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestViacep_ValidateViolations(t *testing.T) {
+	v := &Viacep{Cep: "39408078", Uf: "MG", Estado: "Bahia", Regiao: "Sul", Localidade: "Montes Claros"}
+	err := v.Validate()
+
+	want := []validation.Violation{
+		{Field: "cep", Rule: validation.RuleFormat, Value: "39408078", Message: "cep must have 8 digits, with '-'"},
+		{Field: "estado", Rule: validation.RuleMatch, Value: "Bahia", Message: "estado does not match uf MG"},
+		{Field: "regiao", Rule: validation.RuleMatch, Value: "Sul", Message: "regiao does not match uf MG"},
+		{Field: "bairro", Rule: validation.RuleRequired, Value: "", Message: "bairro must not be empty"},
+		{Field: "logradouro", Rule: validation.RuleRequired, Value: "", Message: "logradouro must not be empty"},
+	}
+	if got := validation.Violations(err); !reflect.DeepEqual(got, want) {
+		t.Errorf("Viacep.Validate() violations = %v, want %v", got, want)
+	}
+	if !errors.Is(err, validation.Violation{Field: "estado", Rule: validation.RuleMatch}) {
+		t.Errorf("errors.Is(Viacep.Validate(), estado match) = false")
+	}
+
+	got := NewErrorResponse(http.StatusUnprocessableEntity, "Unprocessable Entity", err)
+	if got.Code != "invalid_input" || !reflect.DeepEqual(got.Violations, want) {
+		t.Errorf("NewErrorResponse() = %v", got)
+	}
+	j, jerr := json.Marshal(got)
+	if jerr != nil {
+		t.Fatal(jerr)
+	}
+	if !strings.Contains(string(j), `{"field":"cep","rule":"format","value":"39408078","message":"cep must have 8 digits, with '-'"}`) {
+		t.Errorf("json.Marshal(NewErrorResponse()) = %s", j)
+	}
+}
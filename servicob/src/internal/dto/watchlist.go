@@ -0,0 +1,41 @@
+package dto
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Watchlist is the response of /watchlist: the ceps whose weather is refreshed in
+// background, and the state of the scheduler refreshing them. PausedUntil is set while
+// the scheduler waits after the weather api throttled it.
+type Watchlist struct {
+	XMLName     xml.Name        `json:"-" xml:"watchlist"`
+	Interval    string          `json:"interval" xml:"interval"`
+	Jitter      float64         `json:"jitter" xml:"jitter"`
+	Running     bool            `json:"running" xml:"running"`
+	PausedUntil *time.Time      `json:"paused_until,omitempty" xml:"paused_until,omitempty"`
+	Quota       *WatchlistQuota `json:"quota,omitempty" xml:"quota,omitempty"`
+	Ceps        []WatchedCep    `json:"ceps" xml:"ceps>watched"`
+}
+
+// WatchlistQuota is the use of the calls to the weather api allowed per hour.
+type WatchlistQuota struct {
+	Limit    int       `json:"limit" xml:"limit"`
+	Used     int       `json:"used" xml:"used"`
+	ResetsAt time.Time `json:"resets_at" xml:"resets_at"`
+}
+
+// WatchedCep is a cep of the watchlist with the outcome of its refreshes. Fetches
+// counts the refreshes that called the weather api, the others found the weather of
+// the city already fresh in the cache.
+type WatchedCep struct {
+	Cep         string     `json:"cep" xml:"cep"`
+	AddedAt     time.Time  `json:"added_at" xml:"added_at"`
+	NextRefresh time.Time  `json:"next_refresh" xml:"next_refresh"`
+	LastRefresh *time.Time `json:"last_refresh,omitempty" xml:"last_refresh,omitempty"`
+	LastStatus  int        `json:"last_status,omitempty" xml:"last_status,omitempty"`
+	LastError   string     `json:"last_error,omitempty" xml:"last_error,omitempty"`
+	Refreshes   int        `json:"refreshes" xml:"refreshes"`
+	Fetches     int        `json:"fetches" xml:"fetches"`
+	Failures    int        `json:"failures" xml:"failures"`
+}
@@ -0,0 +1,110 @@
+// Package history stores the weather observations fetched by servicob, for the
+// /history queries.
+//
+// The observations are stored by city: the weather is fetched for the city of a cep and
+// every cep of the city shares it. The ceps are mapped to their city, so the history of
+// a cep is the one of its city, whichever cep the observations were fetched for.
+//
+// The stores implement Repository: Memory keeps the observations in memory, for tests,
+// and SQLite stores them in a SQLite database, so they survive restarts.
+package history
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/shared"
+)
+
+// Observation is a temperature observed in the city of a cep.
+type Observation struct {
+	// Cep is the cep the observation was fetched for.
+	Cep      string  `json:"cep"`
+	City     string  `json:"city"`
+	State    string  `json:"state"`
+	Provider string  `json:"provider"`
+	TempC    float64 `json:"temp_C"`
+	// ObservedAt is when the provider observed the temperature, or when it was fetched
+	// if the provider does not tell.
+	ObservedAt time.Time `json:"observed_at"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// Repository stores the observations.
+type Repository interface {
+	// Record stores o in the history of its city and maps o.Cep to the city, unless an
+	// observation of the city by the same provider at the same time is already stored.
+	Record(ctx context.Context, o Observation) error
+	// MapCep maps cep to city, of state, as Record does, for the ceps whose weather was
+	// served without fetching it.
+	MapCep(ctx context.Context, cep, city, state string) error
+	// Observations returns the observations of the city cep is mapped to, observed from
+	// from, inclusive, to to, exclusive, the oldest first.
+	Observations(ctx context.Context, cep string, from, to time.Time) ([]Observation, error)
+	Close() error
+}
+
+// cityKey is the key of the history of city, of state.
+func cityKey(city, state string) string {
+	return shared.CacheKey(city, state)
+}
+
+// Memory is a Repository keeping the observations in memory.
+type Memory struct {
+	mu     sync.RWMutex
+	byCity map[string][]Observation // by cityKey, sorted by ObservedAt
+	ceps   map[string]string        // the cityKey of the ceps
+}
+
+func NewMemory() *Memory {
+	return &Memory{byCity: map[string][]Observation{}, ceps: map[string]string{}}
+}
+
+func (m *Memory) Record(ctx context.Context, o Observation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := cityKey(o.City, o.State)
+	m.ceps[o.Cep] = key
+	observations := m.byCity[key]
+	i, _ := slices.BinarySearchFunc(observations, o.ObservedAt, func(e Observation, t time.Time) int {
+		return e.ObservedAt.Compare(t)
+	})
+	// observations of the same time keep the order they were recorded in
+	for ; i < len(observations) && observations[i].ObservedAt.Equal(o.ObservedAt); i++ {
+		if observations[i].Provider == o.Provider {
+			return nil
+		}
+	}
+	m.byCity[key] = slices.Insert(observations, i, o)
+	return nil
+}
+
+func (m *Memory) MapCep(ctx context.Context, cep, city, state string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ceps[cep] = cityKey(city, state)
+	return nil
+}
+
+func (m *Memory) Observations(ctx context.Context, cep string, from, to time.Time) ([]Observation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	key, ok := m.ceps[cep]
+	if !ok {
+		return nil, nil
+	}
+	observations := m.byCity[key]
+	byTime := func(e Observation, t time.Time) int { return e.ObservedAt.Compare(t) }
+	i, _ := slices.BinarySearchFunc(observations, from, byTime)
+	j, _ := slices.BinarySearchFunc(observations, to, byTime)
+	if j <= i {
+		return nil, nil
+	}
+	return slices.Clone(observations[i:j]), nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
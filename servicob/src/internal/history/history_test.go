@@ -0,0 +1,217 @@
+package history
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+// cities are the cities of the ceps of the tests.
+var cities = map[string][2]string{
+	"39408078": {"Montes Claros", "MG"},
+	"39400001": {"Montes Claros", "MG"},
+	"39400002": {"Montes Claros", "MG"},
+	"01001000": {"São Paulo", "SP"},
+}
+
+func observation(cep string, minutes int, tempC float64) Observation {
+	at := t0.Add(time.Duration(minutes) * time.Minute)
+	city := cities[cep]
+	return Observation{Cep: cep, City: city[0], State: city[1], Provider: "weatherapi", TempC: tempC, ObservedAt: at, RecordedAt: at}
+}
+
+func temps(observations []Observation) []float64 {
+	var got []float64
+	for _, o := range observations {
+		got = append(got, o.TempC)
+	}
+	return got
+}
+
+func equal(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// testRepository checks the queries of a Repository holding the observations recorded
+// by record.
+func testRepository(t *testing.T, repo Repository) {
+	t.Helper()
+	ctx := context.Background()
+	for _, o := range []Observation{
+		observation("39408078", 30, 3),
+		observation("39408078", 0, 1),
+		observation("39408078", 15, 2),
+		observation("39408078", 15, 20), // same time and provider
+		observation("01001000", 15, 9),
+		observation("39400001", 45, 4), // another cep of the city
+	} {
+		if err := repo.Record(ctx, o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other := observation("39408078", 15, 5)
+	other.Provider = "other"
+	if err := repo.Record(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	// a cep of the city whose weather was served from the cache
+	if err := repo.MapCep(ctx, "39400002", "MONTES CLAROS", "mg"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		cep      string
+		from, to time.Time
+		want     []float64
+	}{
+		{name: "all", cep: "39408078", from: t0, to: t0.Add(time.Hour), want: []float64{1, 2, 5, 3, 4}},
+		{name: "from inclusive to exclusive", cep: "39408078", from: t0.Add(15 * time.Minute), to: t0.Add(45 * time.Minute), want: []float64{2, 5, 3}},
+		{name: "other cep of the city", cep: "39400001", from: t0, to: t0.Add(time.Hour), want: []float64{1, 2, 5, 3, 4}},
+		{name: "mapped cep", cep: "39400002", from: t0, to: t0.Add(time.Hour), want: []float64{1, 2, 5, 3, 4}},
+		{name: "other city", cep: "01001000", from: t0, to: t0.Add(time.Hour), want: []float64{9}},
+		{name: "empty range", cep: "39408078", from: t0.Add(time.Hour), to: t0, want: nil},
+		{name: "unknown cep", cep: "69900000", from: t0, to: t0.Add(time.Hour), want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.Observations(ctx, tt.cep, tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equal(temps(got), tt.want) {
+				t.Errorf("Observations() = %v, want %v", temps(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testRepository(t, NewMemory())
+}
+
+func TestSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	repo, err := OpenSQLite(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRepository(t, repo)
+	if err := repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err = OpenSQLite(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	ctx := context.Background()
+	got, err := repo.Observations(ctx, "39408078", t0, t0.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float64{1, 2, 5, 3, 4}; !equal(temps(got), want) {
+		t.Errorf("Observations() after reopening = %v, want %v", temps(got), want)
+	}
+	if !got[0].ObservedAt.Equal(t0) || got[0].City != "Montes Claros" || got[0].State != "MG" {
+		t.Errorf("Observations()[0] = %+v", got[0])
+	}
+
+	// the observations before the retention are deleted
+	deleted, err := repo.Prune(ctx, t0.Add(15*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 {
+		t.Errorf("Prune() = %d, want 1", deleted)
+	}
+	got, err = repo.Observations(ctx, "39408078", t0, t0.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float64{2, 5, 3, 4}; !equal(temps(got), want) {
+		t.Errorf("Observations() after pruning = %v, want %v", temps(got), want)
+	}
+}
+
+func TestSQLitePath(t *testing.T) {
+	tests := []struct {
+		name string
+		path func(dir string) string
+	}{
+		{name: "absolute", path: func(dir string) string { return filepath.Join(dir, "history.db") }},
+		{name: "uri characters", path: func(dir string) string { return filepath.Join(dir, "my history?mode=ro#1 100%.db") }},
+		{name: "relative", path: func(dir string) string { return "history.db" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Chdir(dir)
+			path := tt.path(dir)
+			repo, err := OpenSQLite(path, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer repo.Close()
+			if err := repo.Record(context.Background(), Observation{Cep: "39408078", Provider: "weatherapi", TempC: 1, ObservedAt: t0, RecordedAt: t0}); err != nil {
+				t.Fatal(err)
+			}
+			// the database is at path, in WAL mode, rather than at a path cut at the ? or #;
+			// the relative paths are relative to dir
+			for _, name := range []string{path, path + "-wal"} {
+				if _, err := os.Stat(name); err != nil {
+					t.Error(err)
+				}
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) > 3 {
+				t.Errorf("files created in %s: %v", dir, entries)
+			}
+		})
+	}
+}
+
+func TestSQLiteRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	repo, err := OpenSQLite(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	now := time.Now().UTC()
+	for _, o := range []Observation{
+		{Cep: "39408078", Provider: "weatherapi", TempC: 1, ObservedAt: now.Add(-2 * time.Hour), RecordedAt: now},
+		{Cep: "39408078", Provider: "weatherapi", TempC: 2, ObservedAt: now.Add(-time.Minute), RecordedAt: now},
+	} {
+		if err := repo.Record(ctx, o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo.Close()
+
+	// opening prunes the observations older than the retention
+	repo, err = OpenSQLite(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	got, err := repo.Observations(ctx, "39408078", now.Add(-3*time.Hour), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float64{2}; !equal(temps(got), want) {
+		t.Errorf("Observations() = %v, want %v", temps(got), want)
+	}
+}
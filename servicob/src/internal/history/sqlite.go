@@ -0,0 +1,181 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+
+	// the pure Go SQLite driver, registered as "sqlite"
+	_ "modernc.org/sqlite"
+)
+
+// DefaultRetention is how long the SQLite store keeps the observations by default,
+// longer than the range of the history queries.
+const DefaultRetention = 90 * 24 * time.Hour
+
+// pruneInterval is the period of the deletion of the observations older than the
+// retention.
+const pruneInterval = time.Hour
+
+const schema = `
+CREATE TABLE IF NOT EXISTS observations (
+	city_key    TEXT    NOT NULL,
+	cep         TEXT    NOT NULL,
+	city        TEXT    NOT NULL,
+	state       TEXT    NOT NULL,
+	provider    TEXT    NOT NULL,
+	temp_c      REAL    NOT NULL,
+	observed_at INTEGER NOT NULL, -- unix nanoseconds
+	recorded_at INTEGER NOT NULL  -- unix nanoseconds
+);
+CREATE UNIQUE INDEX IF NOT EXISTS observations_city_observed_at ON observations (city_key, observed_at, provider);
+CREATE INDEX IF NOT EXISTS observations_observed_at ON observations (observed_at);
+CREATE TABLE IF NOT EXISTS ceps (
+	cep      TEXT PRIMARY KEY,
+	city_key TEXT NOT NULL
+);
+`
+
+// mapCep is the statement mapping a cep to the key of its city.
+const mapCep = `
+INSERT INTO ceps (cep, city_key) VALUES (?, ?)
+ON CONFLICT (cep) DO UPDATE SET city_key = excluded.city_key WHERE city_key != excluded.city_key`
+
+// SQLite is a Repository storing the observations in a SQLite database, through the
+// pure Go driver modernc.org/sqlite, indexed by city and time. The observations older than its retention are
+// deleted when it is opened, then every hour.
+type SQLite struct {
+	db        *sql.DB
+	retention time.Duration
+	stop      context.CancelFunc
+	pruning   sync.WaitGroup
+}
+
+// OpenSQLite opens the SQLite store at path, creating the database if needed. A
+// retention of 0 keeps the observations forever.
+func OpenSQLite(path string, retention time.Duration) (*SQLite, error) {
+	db, err := sql.Open("sqlite", sqliteDSN(path))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating the history schema in %s: %w", path, err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	s := &SQLite{db: db, retention: retention, stop: stop}
+	if retention > 0 {
+		if _, err := s.Prune(ctx, time.Now().Add(-retention)); err != nil {
+			stop()
+			db.Close()
+			return nil, fmt.Errorf("pruning the history in %s: %w", path, err)
+		}
+		s.pruning.Add(1)
+		go s.prune(ctx)
+	}
+	return s, nil
+}
+
+// sqliteDSN returns the file: URI of the database at path, escaped so the ?, # and %
+// of a file name are not taken for the query or the fragment of the URI, with the
+// pragmas of the connections. The host is omitted, so relative paths stay relative.
+func sqliteDSN(path string) string {
+	u := url.URL{
+		Scheme:   "file",
+		Path:     path,
+		OmitHost: true,
+		RawQuery: url.Values{"_pragma": {"busy_timeout(5000)", "journal_mode(WAL)"}}.Encode(),
+	}
+	return u.String()
+}
+
+// prune deletes the observations older than the retention every pruneInterval, until
+// ctx is done.
+func (s *SQLite) prune(ctx context.Context) {
+	defer s.pruning.Done()
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		deleted, err := s.Prune(ctx, time.Now().Add(-s.retention))
+		switch {
+		case err != nil && ctx.Err() == nil:
+			slog.Warn("history not pruned", "error", err)
+		case deleted > 0:
+			slog.Info("history pruned", "deleted", deleted)
+		}
+	}
+}
+
+// Prune deletes the observations observed before before, returning how many.
+func (s *SQLite) Prune(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM observations WHERE observed_at < ?`, before.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLite) Record(ctx context.Context, o Observation) error {
+	key := cityKey(o.City, o.State)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO observations (city_key, cep, city, state, provider, temp_c, observed_at, recorded_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING`,
+		key, o.Cep, o.City, o.State, o.Provider, o.TempC, o.ObservedAt.UnixNano(), o.RecordedAt.UnixNano()); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, mapCep, o.Cep, key); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLite) MapCep(ctx context.Context, cep, city, state string) error {
+	_, err := s.db.ExecContext(ctx, mapCep, cep, cityKey(city, state))
+	return err
+}
+
+func (s *SQLite) Observations(ctx context.Context, cep string, from, to time.Time) ([]Observation, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT o.cep, o.city, o.state, o.provider, o.temp_c, o.observed_at, o.recorded_at
+		FROM ceps c JOIN observations o ON o.city_key = c.city_key
+		WHERE c.cep = ? AND o.observed_at >= ? AND o.observed_at < ?
+		ORDER BY o.observed_at, o.rowid`,
+		cep, from.UnixNano(), to.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var observations []Observation
+	for rows.Next() {
+		var o Observation
+		var observedAt, recordedAt int64
+		if err := rows.Scan(&o.Cep, &o.City, &o.State, &o.Provider, &o.TempC, &observedAt, &recordedAt); err != nil {
+			return nil, err
+		}
+		o.ObservedAt, o.RecordedAt = time.Unix(0, observedAt).UTC(), time.Unix(0, recordedAt).UTC()
+		observations = append(observations, o)
+	}
+	return observations, rows.Err()
+}
+
+// Close stops the pruning and closes the database.
+func (s *SQLite) Close() error {
+	s.stop()
+	s.pruning.Wait()
+	return s.db.Close()
+}
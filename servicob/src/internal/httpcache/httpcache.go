@@ -0,0 +1,81 @@
+// Package httpcache sets the http cache headers of the responses derived from an
+// observation, such as the current weather, and answers their conditional requests.
+package httpcache
+
+import (
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ETag returns the weak entity tag of the representation of the observation made at
+// observedAt: W/"<unix seconds>-<hash of variant>". The variant, e.g. the media type,
+// tells apart the representations of the same observation.
+func ETag(observedAt time.Time, variant ...string) string {
+	h := fnv.New32a()
+	h.Write([]byte(strings.Join(variant, "|")))
+	return `W/"` + strconv.FormatInt(observedAt.Unix(), 10) + "-" + strconv.FormatUint(uint64(h.Sum32()), 36) + `"`
+}
+
+// MaxAge returns how long, in whole seconds, the observation made at observedAt is
+// still fresh at now, if observations are fresh for ttl. It is never negative.
+func MaxAge(observedAt time.Time, ttl time.Duration, now time.Time) int {
+	left := observedAt.Add(ttl).Sub(now)
+	if left <= 0 {
+		return 0
+	}
+	return int(left / time.Second)
+}
+
+// Matches reports whether the If-None-Match header ifNoneMatch matches etag, with the
+// weak comparison of RFC 9110.
+func Matches(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// now is replaced in tests.
+var now = time.Now
+
+// Serve sets the ETag, Last-Modified and Cache-Control headers of the representation
+// variant of the observation made at observedAt, fresh for ttl. If the If-None-Match
+// header of r matches the ETag, it writes 304 Not Modified and returns true; the
+// caller must not write the response then.
+//
+// A zero observedAt is unknown: the response is marked no-cache and Serve returns false.
+func Serve(w http.ResponseWriter, r *http.Request, observedAt time.Time, ttl time.Duration, variant ...string) bool {
+	if observedAt.IsZero() {
+		w.Header().Set("Cache-Control", "no-cache")
+		return false
+	}
+	etag := ETag(observedAt, variant...)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", observedAt.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(MaxAge(observedAt, ttl, now())))
+	if inm := r.Header.Get("If-None-Match"); inm != "" && Matches(inm, etag) {
+		w.Header().Set("Vary", "Accept")
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// OnlyIfCached reports whether the Cache-Control header of r has the only-if-cached
+// directive of RFC 9111: the client wants a stored response or 504 Gateway Timeout.
+func OnlyIfCached(r *http.Request) bool {
+	for _, v := range r.Header.Values("Cache-Control") {
+		for _, directive := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(directive), "only-if-cached") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package httpcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMatches(t *testing.T) {
+	etag := ETag(time.Unix(1760000000, 0), "application/json")
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        bool
+	}{
+		{name: "same", ifNoneMatch: etag, want: true},
+		{name: "strong form", ifNoneMatch: etag[2:], want: true},
+		{name: "list", ifNoneMatch: `"other", ` + etag, want: true},
+		{name: "any", ifNoneMatch: "*", want: true},
+		{name: "other observation", ifNoneMatch: ETag(time.Unix(1760000900, 0), "application/json")},
+		{name: "other variant", ifNoneMatch: ETag(time.Unix(1760000000, 0), "text/csv")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Matches(tt.ifNoneMatch, etag); got != tt.want {
+				t.Errorf("Matches(%q, %q) = %v, want %v", tt.ifNoneMatch, etag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	observed := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		now  time.Time
+		want int
+	}{
+		{name: "just observed", now: observed, want: 900},
+		{name: "half way", now: observed.Add(7*time.Minute + 500*time.Millisecond), want: 479},
+		{name: "expired", now: observed.Add(time.Hour), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MaxAge(observed, 15*time.Minute, tt.now); got != tt.want {
+				t.Errorf("MaxAge() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServe(t *testing.T) {
+	observed := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	defer func(f func() time.Time) { now = f }(now)
+	now = func() time.Time { return observed.Add(5 * time.Minute) }
+	etag := ETag(observed, "application/json")
+
+	tests := []struct {
+		name             string
+		observedAt       time.Time
+		ifNoneMatch      string
+		want             bool
+		wantCacheControl string
+	}{
+		{name: "fresh", observedAt: observed, want: false, wantCacheControl: "public, max-age=600"},
+		{name: "not modified", observedAt: observed, ifNoneMatch: etag, want: true, wantCacheControl: "public, max-age=600"},
+		{name: "modified", observedAt: observed, ifNoneMatch: ETag(observed.Add(-15*time.Minute), "application/json"), want: false, wantCacheControl: "public, max-age=600"},
+		{name: "unknown observation", ifNoneMatch: "*", want: false, wantCacheControl: "no-cache"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v2/weather?cep=39408078", nil)
+			if tt.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			if got := Serve(w, r, tt.observedAt, 15*time.Minute, "application/json"); got != tt.want {
+				t.Fatalf("Serve() = %v, want %v", got, tt.want)
+			}
+			if got := w.Header().Get("Cache-Control"); got != tt.wantCacheControl {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.wantCacheControl)
+			}
+			if tt.observedAt.IsZero() {
+				return
+			}
+			if got := w.Header().Get("ETag"); got != etag {
+				t.Errorf("ETag = %q, want %q", got, etag)
+			}
+			if got := w.Header().Get("Last-Modified"); got != "Mon, 19 Oct 2026 12:00:00 GMT" {
+				t.Errorf("Last-Modified = %q", got)
+			}
+			if tt.want && w.Code != http.StatusNotModified {
+				t.Errorf("status = %d, want 304", w.Code)
+			}
+		})
+	}
+}
+
+func TestOnlyIfCached(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheControl []string
+		want         bool
+	}{
+		{name: "none"},
+		{name: "only", cacheControl: []string{"only-if-cached"}, want: true},
+		{name: "list", cacheControl: []string{"max-stale, Only-If-Cached"}, want: true},
+		{name: "several headers", cacheControl: []string{"no-transform", "only-if-cached"}, want: true},
+		{name: "other directives", cacheControl: []string{"no-cache, max-age=0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v2/weather?cep=39408078", nil)
+			for _, v := range tt.cacheControl {
+				r.Header.Add("Cache-Control", v)
+			}
+			if got := OnlyIfCached(r); got != tt.want {
+				t.Errorf("OnlyIfCached() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
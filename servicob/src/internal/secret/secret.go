@@ -0,0 +1,160 @@
+package secret
+
+import (
+	"errors"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+const redacted = "REDACTED"
+
+// secretsDir is where Docker (and docker-compose) mounts secrets.
+var secretsDir = "/run/secrets"
+
+// sensitiveParams are the query string parameters whose values are never
+// written to logs or spans.
+var sensitiveParams = []string{"key", "api_key", "apikey", "token", "access_token", "secret", "password"}
+
+var ErrNotFound = errors.New("secret not found")
+
+// Secret holds a sensitive value such as an API key.
+//
+// String, GoString, LogValue and MarshalText never return the value, so a
+// Secret passed by mistake to fmt, slog or encoding/json does not leak.
+// Use Reveal to get the real value.
+type Secret string
+
+// Reveal returns the secret value.
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// String returns a redacted placeholder for the secret.
+func (s Secret) String() string {
+	return redacted
+}
+
+// GoString returns a redacted placeholder for the secret.
+func (s Secret) GoString() string {
+	return redacted
+}
+
+// LogValue returns a redacted slog.Value for the secret.
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
+
+// MarshalText returns a redacted placeholder for the secret.
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
+
+// Load reads the secret called name.
+//
+// It looks, in order, at the environment variable name (e.g. API_KEY), at the
+// file named by the environment variable name+"_FILE" (e.g. API_KEY_FILE) and
+// at the Docker secret /run/secrets/<name in lower case> (e.g.
+// /run/secrets/api_key). Surrounding white space is trimmed from file contents.
+//
+// It returns ErrNotFound if the secret is not set anywhere.
+func Load(name string) (Secret, error) {
+	if v := os.Getenv(name); v != "" {
+		return Secret(v), nil
+	}
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		return loadFile(path)
+	}
+	s, err := loadFile(filepath.Join(secretsDir, strings.ToLower(name)))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", errors.Join(ErrNotFound, errors.New(name+" is not set"))
+	}
+	return s, err
+}
+
+func loadFile(path string) (Secret, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	v := strings.TrimSpace(string(b))
+	if v == "" {
+		return "", errors.Join(ErrNotFound, errors.New(path+" is empty"))
+	}
+	return Secret(v), nil
+}
+
+// SanitizeURL returns rawURL with the values of sensitive query parameters
+// (key, token, password, ...) and any user password replaced by REDACTED.
+//
+// If rawURL can not be parsed, the whole string is redacted.
+func SanitizeURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return redacted
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	q := u.Query()
+	changed := false
+	for name := range q {
+		if isSensitive(name) {
+			q.Set(name, redacted)
+			changed = true
+		}
+	}
+	if changed {
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+func isSensitive(param string) bool {
+	return slices.Contains(sensitiveParams, strings.ToLower(param))
+}
+
+// SanitizeError returns err with the URL of a *url.Error sanitized by
+// SanitizeURL, and with every given secret redacted from the message.
+// The returned error still wraps err, so errors.Is and errors.As keep working.
+// It returns nil if err is nil.
+func SanitizeError(err error, secrets ...Secret) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	if uerr, ok := err.(*url.Error); ok {
+		msg = (&url.Error{Op: uerr.Op, URL: SanitizeURL(uerr.URL), Err: uerr.Err}).Error()
+	}
+	msg = Redact(msg, secrets...)
+	if msg == err.Error() {
+		return err
+	}
+	return &sanitizedError{msg: msg, err: err}
+}
+
+type sanitizedError struct {
+	msg string
+	err error
+}
+
+func (e *sanitizedError) Error() string { return e.msg }
+
+func (e *sanitizedError) Unwrap() error { return e.err }
+
+// Redact replaces every occurrence of the given secrets in s by REDACTED.
+// The query escaped form of each secret is redacted too.
+func Redact(s string, secrets ...Secret) string {
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		s = strings.ReplaceAll(s, secret.Reveal(), redacted)
+		s = strings.ReplaceAll(s, url.QueryEscape(secret.Reveal()), redacted)
+	}
+	return s
+}
@@ -0,0 +1,21 @@
+package secret
+
+import (
+	"strconv"
+
+	"github.com/openzipkin/zipkin-go"
+	zipkinhttp "github.com/openzipkin/zipkin-go/middleware/http"
+)
+
+// ZipkinErrHandler returns a zipkinhttp.ErrHandler that tags errors like the
+// zipkin default handler, but sanitizes the error message with SanitizeError
+// so that the given secrets never reach a span.
+func ZipkinErrHandler(secrets ...Secret) zipkinhttp.ErrHandler {
+	return func(sp zipkin.Span, err error, statusCode int) {
+		if err != nil {
+			zipkin.TagError.Set(sp, SanitizeError(err, secrets...).Error())
+			return
+		}
+		zipkin.TagError.Set(sp, strconv.Itoa(statusCode))
+	}
+}
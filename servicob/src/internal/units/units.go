@@ -0,0 +1,151 @@
+package units
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Unit is a temperature unit.
+type Unit string
+
+const (
+	Celsius    Unit = "C"
+	Fahrenheit Unit = "F"
+	Kelvin     Unit = "K"
+)
+
+// KelvinOffset is the difference between kelvin and degrees Celsius.
+const KelvinOffset = 273.15
+
+// System is a system of units, as accepted by the units query parameter.
+type System string
+
+const (
+	Metric   System = "metric"   // degrees Celsius
+	Imperial System = "imperial" // degrees Fahrenheit
+	SI       System = "si"       // kelvin
+)
+
+// MaxDecimals is the largest number of decimal places accepted for rounding.
+const MaxDecimals = 6
+
+// DefaultDecimals is the number of decimal places used when a request does not choose one.
+// main sets it from the TEMP_DECIMALS environment variable.
+var DefaultDecimals = 2
+
+// Temperature is a temperature. The zero value is 0 °C.
+type Temperature struct {
+	celsius float64
+}
+
+// FromCelsius returns the temperature of c degrees Celsius.
+func FromCelsius(c float64) Temperature {
+	return Temperature{celsius: c}
+}
+
+// FromFahrenheit returns the temperature of f degrees Fahrenheit.
+func FromFahrenheit(f float64) Temperature {
+	return Temperature{celsius: (f - 32) / 1.8}
+}
+
+// FromKelvin returns the temperature of k kelvin.
+func FromKelvin(k float64) Temperature {
+	return Temperature{celsius: k - KelvinOffset}
+}
+
+// New returns the temperature of value in unit u. Unknown units are taken as Celsius.
+func New(value float64, u Unit) Temperature {
+	switch u {
+	case Fahrenheit:
+		return FromFahrenheit(value)
+	case Kelvin:
+		return FromKelvin(value)
+	default:
+		return FromCelsius(value)
+	}
+}
+
+// Celsius returns the temperature in degrees Celsius.
+func (t Temperature) Celsius() float64 {
+	return t.celsius
+}
+
+// Fahrenheit returns the temperature in degrees Fahrenheit, F = C * 1.8 + 32.
+func (t Temperature) Fahrenheit() float64 {
+	return t.celsius*1.8 + 32
+}
+
+// Kelvin returns the temperature in kelvin, K = C + 273.15.
+func (t Temperature) Kelvin() float64 {
+	return t.celsius + KelvinOffset
+}
+
+// In returns the temperature in unit u. Unknown units are taken as Celsius.
+func (t Temperature) In(u Unit) float64 {
+	switch u {
+	case Fahrenheit:
+		return t.Fahrenheit()
+	case Kelvin:
+		return t.Kelvin()
+	default:
+		return t.Celsius()
+	}
+}
+
+// ParseSystem parses the name of a system of units, ignoring case.
+// An empty name is the Metric system.
+func ParseSystem(name string) (System, error) {
+	switch System(strings.ToLower(strings.TrimSpace(name))) {
+	case Metric, "":
+		return Metric, nil
+	case Imperial:
+		return Imperial, nil
+	case SI:
+		return SI, nil
+	default:
+		return "", errors.New("unknown units " + name + ", want metric, imperial or si")
+	}
+}
+
+// Unit returns the temperature unit of the system.
+func (s System) Unit() Unit {
+	switch s {
+	case Imperial:
+		return Fahrenheit
+	case SI:
+		return Kelvin
+	default:
+		return Celsius
+	}
+}
+
+// ParseDecimals parses a number of decimal places, between 0 and MaxDecimals.
+// An empty string is DefaultDecimals.
+func ParseDecimals(s string) (int, error) {
+	if s == "" {
+		return DefaultDecimals, nil
+	}
+	d, err := strconv.Atoi(s)
+	if err != nil || d < 0 || d > MaxDecimals {
+		return 0, errors.New("decimals must be an integer between 0 and 6")
+	}
+	return d, nil
+}
+
+// Round rounds v to the given number of decimal places.
+//
+// The result is the float64 closest to the decimal number, so it is marshalled to
+// json without noise digits: 26.200000000000003 rounded to 2 places is 26.2.
+// NaN and infinities are returned as they are.
+func Round(v float64, decimals int) float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return v
+	}
+	r, err := strconv.ParseFloat(strconv.FormatFloat(v, 'f', decimals, 64), 64)
+	if err != nil {
+		return v
+	}
+	return r
+}
@@ -0,0 +1,201 @@
+package units
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+// plausible maps any float64 to a temperature between -273.15 and 726.85 °C.
+func plausible(v float64) float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0
+	}
+	return math.Mod(math.Abs(v), 1000) - KelvinOffset
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(1, math.Abs(a))
+}
+
+func TestTemperature(t *testing.T) {
+	tests := []struct {
+		name    string
+		temp    Temperature
+		wantC   float64
+		wantF   float64
+		wantK   float64
+		wantSI  float64
+		wantImp float64
+	}{
+		{name: "freezing", temp: FromCelsius(0), wantC: 0, wantF: 32, wantK: 273.15},
+		{name: "boiling", temp: FromFahrenheit(212), wantC: 100, wantF: 212, wantK: 373.15},
+		{name: "absolute zero", temp: FromKelvin(0), wantC: -273.15, wantF: -459.67, wantK: 0},
+		{name: "minus forty", temp: New(-40, Fahrenheit), wantC: -40, wantF: -40, wantK: 233.15},
+		{name: "montes claros", temp: New(31.1, Celsius), wantC: 31.1, wantF: 87.98, wantK: 304.25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.temp.Celsius(); !near(got, tt.wantC) {
+				t.Errorf("Celsius() = %v, want %v", got, tt.wantC)
+			}
+			if got := tt.temp.In(Fahrenheit); !near(got, tt.wantF) {
+				t.Errorf("In(Fahrenheit) = %v, want %v", got, tt.wantF)
+			}
+			if got := tt.temp.In(Kelvin); !near(got, tt.wantK) {
+				t.Errorf("In(Kelvin) = %v, want %v", got, tt.wantK)
+			}
+		})
+	}
+}
+
+func TestConversionProperties(t *testing.T) {
+	properties := map[string]any{
+		"celsius round trips through fahrenheit": func(v float64) bool {
+			c := plausible(v)
+			return near(FromFahrenheit(FromCelsius(c).Fahrenheit()).Celsius(), c)
+		},
+		"celsius round trips through kelvin": func(v float64) bool {
+			c := plausible(v)
+			return near(FromKelvin(FromCelsius(c).Kelvin()).Celsius(), c)
+		},
+		"kelvin is never negative": func(v float64) bool {
+			return FromCelsius(plausible(v)).Kelvin() >= -1e-9
+		},
+		"kelvin is celsius plus the offset": func(v float64) bool {
+			c := plausible(v)
+			return near(FromCelsius(c).Kelvin()-c, KelvinOffset)
+		},
+		"conversions keep the order": func(a, b float64) bool {
+			ta, tb := FromCelsius(plausible(a)), FromCelsius(plausible(b))
+			if ta.Celsius() > tb.Celsius() {
+				ta, tb = tb, ta
+			}
+			return ta.Fahrenheit() <= tb.Fahrenheit() && ta.Kelvin() <= tb.Kelvin()
+		},
+		"in is the same as the unit methods": func(v float64) bool {
+			temp := FromCelsius(plausible(v))
+			return temp.In(Celsius) == temp.Celsius() && temp.In(Fahrenheit) == temp.Fahrenheit() && temp.In(Kelvin) == temp.Kelvin()
+		},
+	}
+	for name, property := range properties {
+		t.Run(name, func(t *testing.T) {
+			if err := quick.Check(property, nil); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRoundProperties(t *testing.T) {
+	properties := map[string]any{
+		"round is close to the value": func(v float64, d uint8) bool {
+			c, decimals := plausible(v), int(d)%(MaxDecimals+1)
+			return math.Abs(Round(c, decimals)-c) <= 0.5*math.Pow10(-decimals)+1e-9
+		},
+		"round is idempotent": func(v float64, d uint8) bool {
+			c, decimals := plausible(v), int(d)%(MaxDecimals+1)
+			return Round(Round(c, decimals), decimals) == Round(c, decimals)
+		},
+		"round marshals without noise digits": func(v float64, d uint8) bool {
+			c, decimals := plausible(v), int(d)%(MaxDecimals+1)
+			j, err := json.Marshal(Round(c, decimals))
+			if err != nil {
+				return false
+			}
+			_, frac, _ := strings.Cut(string(j), ".")
+			return len(frac) <= decimals
+		},
+	}
+	for name, property := range properties {
+		t.Run(name, func(t *testing.T) {
+			if err := quick.Check(property, nil); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		name     string
+		v        float64
+		decimals int
+		want     string
+	}{
+		{name: "noise", v: 26.200000000000003, decimals: 2, want: "26.2"},
+		{name: "fahrenheit", v: 25.1*1.8 + 32, decimals: 2, want: "77.18"},
+		{name: "kelvin", v: 25.1 + KelvinOffset, decimals: 2, want: "298.25"},
+		{name: "no decimals", v: 298.25, decimals: 0, want: "298"},
+		{name: "negative", v: -0.04, decimals: 1, want: "-0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strconv.FormatFloat(Round(tt.v, tt.decimals), 'f', -1, 64); got != tt.want {
+				t.Errorf("Round() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if got := Round(math.Inf(1), 2); !math.IsInf(got, 1) {
+		t.Errorf("Round(+Inf) = %v", got)
+	}
+}
+
+func TestParseSystem(t *testing.T) {
+	tests := []struct {
+		name     string
+		system   string
+		want     System
+		wantUnit Unit
+		wantErr  bool
+	}{
+		{name: "default", system: "", want: Metric, wantUnit: Celsius},
+		{name: "metric", system: "metric", want: Metric, wantUnit: Celsius},
+		{name: "imperial", system: "Imperial", want: Imperial, wantUnit: Fahrenheit},
+		{name: "si", system: "SI", want: SI, wantUnit: Kelvin},
+		{name: "unknown", system: "rankine", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSystem(tt.system)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseSystem() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want || (!tt.wantErr && got.Unit() != tt.wantUnit) {
+				t.Errorf("ParseSystem() = %v (%v), want %v (%v)", got, got.Unit(), tt.want, tt.wantUnit)
+			}
+		})
+	}
+}
+
+func TestParseDecimals(t *testing.T) {
+	tests := []struct {
+		name     string
+		decimals string
+		want     int
+		wantErr  bool
+	}{
+		{name: "default", decimals: "", want: DefaultDecimals},
+		{name: "zero", decimals: "0", want: 0},
+		{name: "max", decimals: "6", want: 6},
+		{name: "too many", decimals: "7", wantErr: true},
+		{name: "negative", decimals: "-1", wantErr: true},
+		{name: "not a number", decimals: "two", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDecimals(tt.decimals)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseDecimals() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseDecimals() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package usecase
+
+import (
+	"sync"
+	"time"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/dto"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// AddressTTL is how long a ViaCEP lookup stays cached: the addresses of the ceps seldom
+// change.
+var AddressTTL = 24 * time.Hour
+
+// MaxCachedAddresses bounds the number of ceps in the address cache.
+var MaxCachedAddresses = 10000
+
+// AddressCacheStatusKey tells how getCep used the address cache: fresh or miss.
+const AddressCacheStatusKey = attribute.Key("address.cache")
+
+// addresses is the cache of the ViaCEP lookups, by canonical cep. The lookups are cached
+// before being validated, so every call validates them with the current
+// ValidationProfile and reports their warnings.
+var addresses = newAddressCache()
+
+type cachedAddress struct {
+	viacep    dto.Viacep
+	fetchedAt time.Time
+}
+
+type addressCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedAddress
+}
+
+func newAddressCache() *addressCache {
+	return &addressCache{entries: map[string]cachedAddress{}}
+}
+
+// get returns the lookup of cep, if it was fetched less than AddressTTL ago.
+func (c *addressCache) get(cep string) (dto.Viacep, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[cep]
+	if !ok || now().Sub(e.fetchedAt) >= AddressTTL {
+		return dto.Viacep{}, false
+	}
+	return e.viacep, true
+}
+
+// put caches the lookup of cep, evicting the expired entries and, if the cache is still
+// full, the oldest one.
+func (c *addressCache) put(cep string, viacep dto.Viacep) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fetchedAt := now()
+	if _, ok := c.entries[cep]; !ok && len(c.entries) >= MaxCachedAddresses {
+		oldest := ""
+		for k, e := range c.entries {
+			if fetchedAt.Sub(e.fetchedAt) >= AddressTTL {
+				delete(c.entries, k)
+			} else if oldest == "" || e.fetchedAt.Before(c.entries[oldest].fetchedAt) {
+				oldest = k
+			}
+		}
+		if len(c.entries) >= MaxCachedAddresses {
+			delete(c.entries, oldest)
+		}
+	}
+	c.entries[cep] = cachedAddress{viacep: viacep, fetchedAt: fetchedAt}
+}
@@ -0,0 +1,22 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/dto"
+	zipkinhttp "github.com/openzipkin/zipkin-go/middleware/http"
+)
+
+// GetAddress gets the full address for a given cep.
+//
+// It looks the cep up with getCep, the same cached lookup used by GetWeather, calling
+// ViaCEP with zipkinClient when it is not cached, and returns the normalized address,
+// including the IBGE code, DDD and region reported by ViaCEP.
+//
+// It returns the same status and message as getCep: 200, "OK" on success,
+// 404, "Not Found" if the cep can not be found, 422, "Unprocessable Entity" if the
+// cep is invalid, 408, "Request Timeout", 500, "Internal Server Error" and
+// 503, "Service Unavailable" on failures.
+func GetAddress(ctx context.Context, cep string, zipkinClient *zipkinhttp.Client) (address dto.Cep, status int, message string, err error) {
+	return getCep(ctx, cep, zipkinClient)
+}
@@ -0,0 +1,208 @@
+package usecase
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/dto"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestGetAddress(t *testing.T) {
+	tests := []struct {
+		name        string
+		viacep      http.HandlerFunc
+		want        dto.Cep
+		wantStatus  int
+		wantMessage string
+		wantErr     bool
+	}{
+		{
+			name: "get address",
+			want: dto.Cep{
+				Cep:          "39408-078",
+				State:        "MG",
+				City:         "Montes Claros",
+				Neighborhood: "Centro",
+				Street:       "Avenida Herlindo Silveira",
+				Ibge:         "3143302",
+				Ddd:          "38",
+				Region:       "Sudeste",
+			},
+			wantStatus:  http.StatusOK,
+			wantMessage: "OK",
+		},
+		{
+			name: "get not found zipcode",
+			viacep: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"erro": "true"}`))
+			},
+			wantStatus:  http.StatusNotFound,
+			wantMessage: "Not Found",
+			wantErr:     true,
+		},
+		{
+			name: "get invalid zipcode",
+			viacep: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+			},
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantMessage: "Unprocessable Entity",
+			wantErr:     true,
+		},
+	}
+	client := newZipkinClient(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			startFakeApis(t, tt.viacep, nil)
+			got, gotStatus, gotMessage, err := GetAddress(context.Background(), "39408078", client)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetAddress() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetAddress() = %v, want %v", got, tt.want)
+			}
+			if gotStatus != tt.wantStatus {
+				t.Errorf("GetAddress() gotStatus = %v, want %v", gotStatus, tt.wantStatus)
+			}
+			if gotMessage != tt.wantMessage {
+				t.Errorf("GetAddress() gotMessage = %v, want %v", gotMessage, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestGetAddressGeneralCep(t *testing.T) {
+	startFakeApis(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"cep": "39480-000", "logradouro": "", "bairro": "", "localidade": "Janaúba", "uf": "MG", "estado": "Minas Gerais", "regiao": "Sudeste", "ibge": "3135100", "ddd": "38"}`))
+	}, nil)
+
+	spans := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)).Tracer("test")
+	client := newZipkinClient(t)
+
+	tests := []struct {
+		name        string
+		profile     dto.ValidationProfile
+		wantStatus  int
+		wantPartial bool
+		wantEvents  int
+	}{
+		{
+			name:        "lenient",
+			profile:     dto.Lenient,
+			wantStatus:  http.StatusOK,
+			wantPartial: true,
+			wantEvents:  2,
+		},
+		{
+			name:       "strict",
+			profile:    dto.Strict,
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := ValidationProfile
+			ValidationProfile = tt.profile
+			defer func() { ValidationProfile = old }()
+
+			ctx, span := tracer.Start(context.Background(), tt.name)
+			got, gotStatus, _, _ := GetAddress(ctx, "39480000", client)
+			span.End()
+
+			if gotStatus != tt.wantStatus {
+				t.Errorf("GetAddress() gotStatus = %v, want %v", gotStatus, tt.wantStatus)
+			}
+			if got.Partial != tt.wantPartial {
+				t.Errorf("GetAddress() Partial = %v, want %v", got.Partial, tt.wantPartial)
+			}
+			ended := spans.Ended()
+			if events := ended[len(ended)-1].Events(); len(events) != tt.wantEvents {
+				t.Errorf("span events = %v, want %v events", events, tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestGetAddressCached(t *testing.T) {
+	var calls atomic.Int32
+	var gotTraceID string
+	startFakeApis(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		gotTraceID = r.Header.Get("X-B3-TraceId")
+		w.Write([]byte(montesClarosViacep))
+	}, nil)
+	spans := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)).Tracer("test")
+	client := newZipkinClient(t)
+
+	start := time.Now()
+	now = func() time.Time { return start }
+	t.Cleanup(func() { now = time.Now })
+
+	tests := []struct {
+		name       string
+		cep        string
+		after      time.Duration
+		wantCalls  int32
+		wantStatus string
+	}{
+		{name: "miss", cep: "39408-078", wantCalls: 1, wantStatus: "miss"},
+		{name: "same cep in another format", cep: "39408.078", after: time.Hour, wantCalls: 1, wantStatus: "fresh"},
+		{name: "expired", cep: "39408078", after: AddressTTL, wantCalls: 2, wantStatus: "miss"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = func() time.Time { return start.Add(tt.after) }
+			ctx, span := tracer.Start(context.Background(), tt.name)
+			got, status, _, err := GetAddress(ctx, tt.cep, client)
+			span.End()
+			if err != nil || status != http.StatusOK || got.Cep != "39408-078" {
+				t.Fatalf("GetAddress() = %v, %d, error %v", got.Cep, status, err)
+			}
+			if n := calls.Load(); n != tt.wantCalls {
+				t.Errorf("%d ViaCEP calls, want %d", n, tt.wantCalls)
+			}
+			ended := spans.Ended()
+			var gotStatus string
+			for _, a := range ended[len(ended)-1].Attributes() {
+				if a.Key == AddressCacheStatusKey {
+					gotStatus = a.Value.AsString()
+				}
+			}
+			if gotStatus != tt.wantStatus {
+				t.Errorf("address cache status = %q, want %q", gotStatus, tt.wantStatus)
+			}
+		})
+	}
+	if gotTraceID == "" {
+		t.Error("GetAddress() did not propagate the trace to ViaCEP")
+	}
+}
+
+func TestAddressCacheEviction(t *testing.T) {
+	old := MaxCachedAddresses
+	MaxCachedAddresses = 2
+	t.Cleanup(func() { MaxCachedAddresses = old; now = time.Now })
+	c := newAddressCache()
+	start := time.Now()
+	for i, cep := range []string{"01001-000", "39408-078", "39480-000"} {
+		now = func() time.Time { return start.Add(time.Duration(i) * time.Minute) }
+		c.put(cep, dto.Viacep{Cep: cep})
+	}
+	if _, ok := c.get("01001-000"); ok {
+		t.Error("the oldest entry was not evicted")
+	}
+	for _, cep := range []string{"39408-078", "39480-000"} {
+		if _, ok := c.get(cep); !ok {
+			t.Errorf("entry %s was evicted", cep)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/dto"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/history"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/units"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/shared"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/validation"
+)
+
+// History stores the observations fetched by GetWeather, by city, and the city of the
+// ceps it served. It is nil when the history is disabled.
+var History history.Repository
+
+const (
+	// DefaultHistoryRange is the range of the history queries without from: the last day.
+	DefaultHistoryRange = 24 * time.Hour
+	// MaxHistoryRange is the largest range of a history query.
+	MaxHistoryRange = 31 * 24 * time.Hour
+	// MinHistoryInterval is the smallest interval of the history buckets.
+	MinHistoryInterval = time.Minute
+	// MaxHistoryBuckets is the largest number of buckets of a history query.
+	MaxHistoryBuckets = 1000
+)
+
+// weatherProvider is the provider of the observations of GetWeather.
+const weatherProvider = "weatherapi"
+
+// OnObservation, if set, is called with each observation fetched from the weather api,
+// such as to evaluate the alert rules.
+var OnObservation func(ctx context.Context, o history.Observation)
+
+// canonicalCep returns the cep of rcep without its hyphen, as the history stores it.
+func canonicalCep(rcep dto.Cep) string {
+	if parsed, err := shared.ParseCep(rcep.Cep); err == nil {
+		return parsed.Canonical()
+	}
+	return rcep.Cep
+}
+
+// recordCep maps the cep of rcep to its city in History, if enabled, when its weather
+// is served without fetching it, so the cep shares the history of its city.
+func recordCep(ctx context.Context, rcep dto.Cep) {
+	if History == nil {
+		return
+	}
+	cep := canonicalCep(rcep)
+	if err := History.MapCep(ctx, cep, rcep.City, rcep.State); err != nil {
+		slog.Warn("cep not mapped to its city", "cep", cep, "error", err)
+	}
+}
+
+// recordObservation records the weather of rcep fetched from the weather api in History,
+// if enabled, and passes it to OnObservation. Failures are only logged: the history must
+// not fail the weather requests.
+func recordObservation(ctx context.Context, rcep dto.Cep, temps dto.TempResponse) {
+	if History == nil && OnObservation == nil {
+		return
+	}
+	cep := canonicalCep(rcep)
+	recordedAt := now().UTC()
+	observedAt := temps.ObservedAt
+	if observedAt.IsZero() {
+		observedAt = recordedAt
+	}
+	o := history.Observation{
+		Cep:        cep,
+		City:       rcep.City,
+		State:      rcep.State,
+		Provider:   weatherProvider,
+		TempC:      temps.Temp_C,
+		ObservedAt: observedAt,
+		RecordedAt: recordedAt,
+	}
+	if History != nil {
+		if err := History.Record(ctx, o); err != nil {
+			slog.Warn("observation not recorded", "cep", cep, "error", err)
+		}
+	}
+	if OnObservation != nil {
+		OnObservation(ctx, o)
+	}
+}
+
+// GetHistory returns the temperatures observed in the city of cep from from, inclusive,
+// to to, exclusive, with their minimum, maximum and average, by interval if it is not empty.
+//
+// from and to are RFC 3339 times or dates (2006-01-02, midnight UTC). An empty to is now
+// and an empty from is DefaultHistoryRange before to. interval is a time.Duration, e.g.
+// 1h; the buckets start at the multiples of interval since the zero time, so 1h buckets
+// start on the hour.
+//
+// It returns 200, "OK" on success, even when nothing was observed,
+// 422, "Unprocessable Entity" if cep, from, to or interval are invalid, with a
+// validation.Errors listing all of them,
+// 503, "Service Unavailable" if the history is disabled,
+// and 500, "Internal Server Error" if the history can not be read.
+func GetHistory(ctx context.Context, cep, from, to, interval string) (result dto.History, status int, message string, err error) {
+	var errs validation.Errors
+	parsed, cerr := shared.ParseCep(cep)
+	if cerr != nil {
+		errs.Add("cep", validation.RuleFormat, cep, "invalid zipcode")
+	}
+	end, endErr := now().UTC(), error(nil)
+	if to != "" {
+		if end, endErr = parseHistoryTime(to); endErr != nil {
+			errs.Add("to", validation.RuleFormat, to, "to must be a RFC 3339 time or a date")
+		}
+	}
+	start, startErr := end.Add(-DefaultHistoryRange), error(nil)
+	if from != "" {
+		if start, startErr = parseHistoryTime(from); startErr != nil {
+			errs.Add("from", validation.RuleFormat, from, "from must be a RFC 3339 time or a date")
+		}
+	}
+	if startErr == nil && endErr == nil {
+		if !start.Before(end) {
+			errs.Add("from", validation.RuleRange, from, "from must be before to")
+		} else if end.Sub(start) > MaxHistoryRange {
+			errs.Add("from", validation.RuleRange, from, "the range must not exceed 31 days")
+		}
+	}
+	var step time.Duration
+	if interval != "" {
+		step, err = time.ParseDuration(interval)
+		switch {
+		case err != nil:
+			errs.Add("interval", validation.RuleFormat, interval, "interval must be a duration, e.g. 1h")
+		case step < MinHistoryInterval:
+			errs.Add("interval", validation.RuleRange, interval, "interval must be at least 1m")
+		case startErr == nil && endErr == nil && end.Sub(start)/step > MaxHistoryBuckets:
+			errs.Add("interval", validation.RuleRange, interval, "interval is too small for the range")
+		}
+	}
+	if err := errs.Err(); err != nil {
+		return dto.History{}, 422, "Unprocessable Entity", err
+	}
+	if History == nil {
+		return dto.History{}, 503, "Service Unavailable", errors.New("history is disabled")
+	}
+
+	observations, err := History.Observations(ctx, parsed.Canonical(), start, end)
+	if err != nil {
+		return dto.History{}, 500, "Internal Server Error", err
+	}
+	result = dto.History{Cep: parsed.Canonical(), From: start, To: end, Interval: interval, Points: []dto.HistoryPoint{}}
+	for _, o := range observations {
+		result.City, result.State = o.City, o.State
+		result.Points = append(result.Points, dto.HistoryPoint{ObservedAt: o.ObservedAt.UTC(), Temp_C: o.TempC, Provider: o.Provider})
+	}
+	result.Summary = historyStats(result.Points)
+	if step > 0 {
+		result.Buckets = historyBuckets(result.Points, step)
+	}
+	return result, 200, "OK", nil
+}
+
+// parseHistoryTime parses a RFC 3339 time or a date.
+func parseHistoryTime(s string) (time.Time, error) {
+	if !strings.Contains(s, "T") {
+		return time.Parse(time.DateOnly, s)
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	return t.UTC(), err
+}
+
+func historyStats(points []dto.HistoryPoint) dto.HistoryStats {
+	if len(points) == 0 {
+		return dto.HistoryStats{}
+	}
+	stats := dto.HistoryStats{Count: len(points), Min_C: math.Inf(1), Max_C: math.Inf(-1)}
+	var sum float64
+	for _, p := range points {
+		stats.Min_C = min(stats.Min_C, p.Temp_C)
+		stats.Max_C = max(stats.Max_C, p.Temp_C)
+		sum += p.Temp_C
+	}
+	stats.Avg_C = units.Round(sum/float64(len(points)), units.DefaultDecimals)
+	return stats
+}
+
+// historyBuckets returns the statistics of the points by interval, for the intervals
+// with observations. The points are sorted by time.
+func historyBuckets(points []dto.HistoryPoint, interval time.Duration) []dto.HistoryBucket {
+	var buckets []dto.HistoryBucket
+	for i := 0; i < len(points); {
+		start := points[i].ObservedAt.Truncate(interval)
+		j := i
+		for j < len(points) && points[j].ObservedAt.Before(start.Add(interval)) {
+			j++
+		}
+		buckets = append(buckets, dto.HistoryBucket{Start: start, HistoryStats: historyStats(points[i:j])})
+		i = j
+	}
+	return buckets
+}
@@ -0,0 +1,206 @@
+package usecase
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/dto"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/history"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/validation"
+	"github.com/openzipkin/zipkin-go"
+	zipkinhttp "github.com/openzipkin/zipkin-go/middleware/http"
+	"github.com/openzipkin/zipkin-go/reporter/recorder"
+)
+
+// useHistory enables the history with the observations of 39408078 at t0 plus the
+// given minutes, at the given temperatures.
+func useHistory(t *testing.T, t0 time.Time, temps map[int]float64) *history.Memory {
+	t.Helper()
+	repo := history.NewMemory()
+	for minutes, temp := range temps {
+		at := t0.Add(time.Duration(minutes) * time.Minute)
+		repo.Record(context.Background(), history.Observation{
+			Cep: "39408078", City: "Montes Claros", State: "MG", Provider: "weatherapi", TempC: temp, ObservedAt: at, RecordedAt: at,
+		})
+	}
+	old := History
+	History = repo
+	t.Cleanup(func() { History = old })
+	return repo
+}
+
+func TestGetHistory(t *testing.T) {
+	t0 := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	useHistory(t, t0, map[int]float64{0: 20, 20: 26, 50: 23, 70: 30, 24 * 60: 18})
+	now = func() time.Time { return t0.Add(2 * time.Hour) }
+	t.Cleanup(func() { now = time.Now })
+
+	result, status, _, err := GetHistory(context.Background(), "39408-078", "2026-10-19T12:00:00Z", "", "1h")
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("GetHistory() status = %d, error = %v", status, err)
+	}
+	want := dto.History{
+		Cep: "39408078", City: "Montes Claros", State: "MG",
+		From: t0, To: t0.Add(2 * time.Hour), Interval: "1h",
+		Summary: dto.HistoryStats{Count: 4, Min_C: 20, Max_C: 30, Avg_C: 24.75},
+		Buckets: []dto.HistoryBucket{
+			{Start: t0, HistoryStats: dto.HistoryStats{Count: 3, Min_C: 20, Max_C: 26, Avg_C: 23}},
+			{Start: t0.Add(time.Hour), HistoryStats: dto.HistoryStats{Count: 1, Min_C: 30, Max_C: 30, Avg_C: 30}},
+		},
+		Points: []dto.HistoryPoint{
+			{ObservedAt: t0, Temp_C: 20, Provider: "weatherapi"},
+			{ObservedAt: t0.Add(20 * time.Minute), Temp_C: 26, Provider: "weatherapi"},
+			{ObservedAt: t0.Add(50 * time.Minute), Temp_C: 23, Provider: "weatherapi"},
+			{ObservedAt: t0.Add(70 * time.Minute), Temp_C: 30, Provider: "weatherapi"},
+		},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("GetHistory() = %+v, want %+v", result, want)
+	}
+
+	// the default range is the last day, and there are no buckets without interval
+	result, _, _, err = GetHistory(context.Background(), "39408078", "", "2026-10-20", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Summary.Count != 4 || result.Buckets != nil || !result.From.Equal(t0.Add(-12*time.Hour)) {
+		t.Errorf("GetHistory() = %+v, want the 4 observations of the day without buckets", result)
+	}
+
+	result, _, _, err = GetHistory(context.Background(), "01001000", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Summary.Count != 0 || result.Points == nil {
+		t.Errorf("GetHistory() = %+v, want no observation", result)
+	}
+}
+
+func TestGetHistoryInvalid(t *testing.T) {
+	useHistory(t, time.Now(), nil)
+	tests := []struct {
+		name           string
+		cep            string
+		from, to       string
+		interval       string
+		wantViolations []string
+	}{
+		{name: "invalid cep", cep: "3940807", wantViolations: []string{"cep"}},
+		{name: "invalid times", cep: "39408078", from: "yesterday", to: "19/10/2026", wantViolations: []string{"to", "from"}},
+		{name: "from after to", cep: "39408078", from: "2026-10-20", to: "2026-10-19", wantViolations: []string{"from"}},
+		{name: "range too large", cep: "39408078", from: "2026-01-01", to: "2026-10-19", wantViolations: []string{"from"}},
+		{name: "invalid interval", cep: "39408078", interval: "hourly", wantViolations: []string{"interval"}},
+		{name: "interval too small", cep: "39408078", interval: "30s", wantViolations: []string{"interval"}},
+		{name: "too many buckets", cep: "39408078", from: "2026-10-01", to: "2026-10-19", interval: "5m", wantViolations: []string{"interval"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, status, _, err := GetHistory(context.Background(), tt.cep, tt.from, tt.to, tt.interval)
+			if status != http.StatusUnprocessableEntity {
+				t.Fatalf("GetHistory() status = %d, want 422 (error %v)", status, err)
+			}
+			var fields []string
+			for _, v := range validation.Violations(err) {
+				fields = append(fields, v.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantViolations) {
+				t.Errorf("GetHistory() violations = %v, want %v", fields, tt.wantViolations)
+			}
+		})
+	}
+}
+
+func TestGetHistoryDisabled(t *testing.T) {
+	old := History
+	History = nil
+	t.Cleanup(func() { History = old })
+	_, status, _, err := GetHistory(context.Background(), "39408078", "", "", "")
+	if status != http.StatusServiceUnavailable || err == nil {
+		t.Errorf("GetHistory() status = %d, error = %v, want 503", status, err)
+	}
+}
+
+func TestGetWeatherRecordsObservations(t *testing.T) {
+	// ViaCEP answers Montes Claros for every cep
+	viacep := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		cep := strings.Split(strings.TrimPrefix(r.URL.Path, "/ws/"), "/")[0]
+		w.Write([]byte(strings.Replace(montesClarosViacep, "39408-078", cep[:5]+"-"+cep[5:], 1)))
+	}
+	startFakeApis(t, viacep, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"location": {"name": "Montes Claros"}, "current": {"last_updated_epoch": 1792411200, "temp_c": 31.1}}`))
+	})
+	repo := useHistory(t, time.Now(), nil)
+	tracer, err := zipkin.NewTracer(recorder.NewReporter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := zipkinhttp.NewClient(tracer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the second call is served from the cache and records nothing
+	for range 2 {
+		if _, _, _, err := GetWeather(context.Background(), "39408-078", client, testAPIKey); err != nil {
+			t.Fatal(err)
+		}
+	}
+	observedAt := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	got, err := repo.Observations(context.Background(), "39408078", observedAt, observedAt.Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("%d observations recorded, want 1", len(got))
+	}
+	want := history.Observation{Cep: "39408078", City: "Montes Claros", State: "MG", Provider: "weatherapi", TempC: 31.1, ObservedAt: observedAt}
+	got[0].RecordedAt = time.Time{}
+	if got[0] != want {
+		t.Errorf("recorded %+v, want %+v", got[0], want)
+	}
+
+	// another cep of the city, served from the cache, shares the history of the city
+	if _, _, _, err := GetWeather(context.Background(), "39400-001", client, testAPIKey); err != nil {
+		t.Fatal(err)
+	}
+	got, err = repo.Observations(context.Background(), "39400001", observedAt, observedAt.Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].TempC != 31.1 {
+		t.Errorf("observations of 39400001 = %+v, want the one of the city", got)
+	}
+}
+
+func TestOnObservation(t *testing.T) {
+	startFakeApis(t, nil, nil)
+	old := History
+	History = nil
+	t.Cleanup(func() { History = old })
+	var observed []history.Observation
+	OnObservation = func(ctx context.Context, o history.Observation) { observed = append(observed, o) }
+	t.Cleanup(func() { OnObservation = nil })
+	tracer, err := zipkin.NewTracer(recorder.NewReporter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := zipkinhttp.NewClient(tracer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without history, the observations are still passed to OnObservation
+	for range 2 {
+		if _, _, _, err := GetWeather(context.Background(), "39408-078", client, testAPIKey); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(observed) != 1 || observed[0].Cep != "39408078" || observed[0].City != "Montes Claros" {
+		t.Errorf("observed %+v, want the fetched observation of 39408078", observed)
+	}
+}
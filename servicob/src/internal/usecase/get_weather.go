@@ -2,25 +2,37 @@ package usecase
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"io"
 	"log/slog"
 	"net/http"
 	neturl "net/url"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/dto"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/secret"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/units"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/shared"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/validation"
 	zipkinhttp "github.com/openzipkin/zipkin-go/middleware/http"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var viacepURL = "http://viacep.com.br/ws/{{cep}}/json/"
+
+var weatherApiURL = "http://api.weatherapi.com/v1/current.json?key={{key}}&q={{city}}&aqi=no"
+
 // getCep retrieves the cep information from the ViaCEP API.
 //
-// It constructs a request to the ViaCEP API using the given cep and sends an HTTP GET request.
-// If the request is successful and the response contains valid data, it unmarshals the JSON response
-// into a Viacep struct and converts it to a Cep struct. It returns the Cep instance, along with
+// It parses the given cep with shared.ParseCep, so dashes, dots and spaces are accepted,
+// then looks its canonical form up in the address cache or, when it is not cached, with
+// lookupCep, which calls ViaCEP with zipkinClient so the lookup appears in the traces.
+// The lookup is validated with ValidationProfile and converted to a Cep struct.
+// Validation warnings are reported on the current spans and flag the Cep as Partial. It returns the Cep instance, along with
 // a status code and a message indicating the success or failure of the operation.
 //
 // Possible return scenarios include:
@@ -32,105 +44,189 @@ import (
 // - 503, "Service Unavailable": if the ViaCEP service is unavailable.
 // It returns an error if any network or processing error occurs.
 
-func getCep(ctx context.Context, cep string) (rcep dto.Cep, status int, message string, error error) {
-	url := "http://viacep.com.br/ws/{{cep}}/json/"
-	url = strings.Replace(url, "{{cep}}", cep, 1)
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+func getCep(ctx context.Context, cep string, zipkinClient *zipkinhttp.Client) (rcep dto.Cep, status int, message string, error error) {
+	parsed, err := shared.ParseCep(cep)
 	if err != nil {
-		return dto.Cep{}, 500, "Internal Server Error", err
+		var errs validation.Errors
+		errs.Add("cep", validation.RuleFormat, cep, "invalid zipcode")
+		return dto.Cep{}, 422, "Unprocessable Entity", errs
+	}
+
+	span := trace.SpanFromContext(ctx)
+	cepdto, ok := addresses.get(parsed.Canonical())
+	if ok {
+		span.SetAttributes(AddressCacheStatusKey.String("fresh"))
+	} else {
+		span.SetAttributes(AddressCacheStatusKey.String("miss"))
+		cepdto, status, message, err = lookupCep(ctx, parsed.Canonical(), zipkinClient)
+		if err != nil {
+			return dto.Cep{}, status, message, err
+		}
+		addresses.put(parsed.Canonical(), cepdto)
 	}
-	res, err := http.DefaultClient.Do(req)
+
+	return toCep(ctx, cepdto)
+}
+
+// toCep validates a ViaCEP lookup with ValidationProfile and converts it to a Cep,
+// reporting the validation warnings on the current spans. It returns 500,
+// "Internal Server Error" if the lookup is not valid.
+func toCep(ctx context.Context, cepdto dto.Viacep) (rcep dto.Cep, status int, message string, err error) {
+	warnings, err := cepdto.ValidateWith(ValidationProfile)
 	if err != nil {
 		return dto.Cep{}, 500, "Internal Server Error", err
 	}
+	rcep = cepdto.ToCep()
+	rcep.Partial = len(warnings) > 0
+	reportWarnings(ctx, rcep.Cep, warnings)
+	slog.Info(rcep.City)
+	return rcep, 200, "OK", nil
+}
+
+// lookupCep gets the canonical cep from the ViaCEP API with zipkinClient, propagating the
+// trace of ctx. It returns the status, message and error described by getCep.
+func lookupCep(ctx context.Context, cep string, zipkinClient *zipkinhttp.Client) (viacep dto.Viacep, status int, message string, err error) {
+	url := strings.Replace(viacepURL, "{{cep}}", cep, 1)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return dto.Viacep{}, 500, "Internal Server Error", err
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	res, err := zipkinClient.Do(req)
+	if err != nil {
+		return dto.Viacep{}, 500, "Internal Server Error", err
+	}
+	defer res.Body.Close()
 
 	switch res.StatusCode {
 	case http.StatusOK:
-
-		body, error := io.ReadAll(res.Body)
-		if error != nil {
-			return dto.Cep{}, 500, "Internal Server Error", errors.New("fail to read the body response: " + error.Error())
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return dto.Viacep{}, 500, "Internal Server Error", errors.New("fail to read the body response: " + err.Error())
 		}
-		defer res.Body.Close()
 
 		// obs this api doesnt return a 404 error if the cep is not found
 		// the return is 200 status with a body with "erro": "true"
 		if strings.Contains(string(body), `"erro": "true"`) {
-			return dto.Cep{}, 404, "Not Found", errors.New("can not find zipcode")
+			return dto.Viacep{}, 404, "Not Found", errors.New("can not find zipcode")
 		}
 
-		cepdto, err := dto.NewViacepFromJson(string(body))
-		if err != nil {
-			return dto.Cep{}, 500, "Internal Server Error", err
-		}
-		rcep := dto.Cep{
-			Cep:          cepdto.Cep,
-			State:        cepdto.Uf,
-			City:         cepdto.Localidade,
-			Neighborhood: cepdto.Bairro,
-			Street:       cepdto.Logradouro,
+		if err := json.Unmarshal(body, &viacep); err != nil {
+			return dto.Viacep{}, 500, "Internal Server Error", err
 		}
-		slog.Info(rcep.City)
-		return rcep, 200, "OK", nil
+		return viacep, 200, "OK", nil
 	case http.StatusRequestTimeout:
-		return dto.Cep{}, 408, "Request Timeout", errors.New("time exceeded")
+		return dto.Viacep{}, 408, "Request Timeout", errors.New("time exceeded")
 
 	case http.StatusNotFound:
-		return dto.Cep{}, 404, "Not Found", errors.New("can not find zipcode")
+		return dto.Viacep{}, 404, "Not Found", errors.New("can not find zipcode")
 
 	case http.StatusBadRequest:
-		return dto.Cep{}, 422, "Unprocessable Entity", errors.New("invalid zipcode")
+		return dto.Viacep{}, 422, "Unprocessable Entity", errors.New("invalid zipcode")
 
 	case http.StatusInternalServerError:
-		return dto.Cep{}, 500, "Internal Server Error", errors.New("internal server error")
+		return dto.Viacep{}, 500, "Internal Server Error", errors.New("internal server error")
 
 	case http.StatusServiceUnavailable:
-		return dto.Cep{}, 503, "Service Unavailable", errors.New("service unavailable")
+		return dto.Viacep{}, 503, "Service Unavailable", errors.New("service unavailable")
 
 	default:
-		return dto.Cep{}, 404, "Not Found", errors.New("can not find zipcode")
+		return dto.Viacep{}, 404, "Not Found", errors.New("can not find zipcode")
 	}
-
 }
 
+// WeatherTTL is how long an observation of the current weather stays fresh:
+// WeatherAPI updates the current weather every 15 minutes.
+const WeatherTTL = 15 * time.Minute
+
 // GetWeather gets the current weather for a given cep.
 //
-// It first calls getCep to get the cep information, then makes a request to the weather api
-// using the city name from the cep information. It then marshalls the response into a TempResponse
-// and returns it, along with the appropriate status and message.
+// It first calls getCep, with zipkinClient, to get the cep information, then serves the weather of its city
+// from the cache while it is fresh, for WeatherTTL after it was fetched. Later, it is
+// still served, flagged Stale, for StaleWhileRevalidate while it is refreshed in
+// background; and for StaleIfError when fetching it fails because of the weather api.
+// Otherwise the weather is fetched with fetchWeather. The fetched observations are
+// recorded in History and passed to OnObservation; the ceps served from the cache are
+// mapped to their city in History. apiKey is the key of the weather api, loaded once at
+// startup.
+//
+// It returns the status, message and error of getCep or of fetchWeather when they fail.
+func GetWeather(ctx context.Context, cep string, zipkinClient *zipkinhttp.Client, apiKey secret.Secret) (temps dto.TempResponse, status int, message string, eror error) {
+	rcep, status, message, err := getCep(ctx, cep, zipkinClient)
+	if err != nil {
+		return dto.TempResponse{}, status, message, err
+	}
+
+	span := trace.SpanFromContext(ctx)
+	key := shared.CacheKey(rcep.City, rcep.State)
+	cached, ok := weathers.get(key)
+	age := now().Sub(cached.fetchedAt)
+	switch {
+	case ok && age < WeatherTTL:
+		span.SetAttributes(CacheStatusKey.String("fresh"))
+		recordCep(ctx, rcep)
+		return cached.served(rcep, false), 200, "OK", nil
+	case ok && age < WeatherTTL+StaleWhileRevalidate:
+		span.SetAttributes(CacheStatusKey.String("stale"))
+		recordCep(ctx, rcep)
+		weathers.refresh(ctx, key, rcep, zipkinClient, apiKey)
+		return cached.served(rcep, true), 200, "OK", nil
+	}
+
+	temps, status, message, err = fetchWeather(ctx, rcep, zipkinClient, apiKey)
+	if err == nil {
+		span.SetAttributes(CacheStatusKey.String("miss"))
+		weathers.put(key, temps)
+		recordObservation(ctx, rcep, temps)
+		return temps, status, message, nil
+	}
+	if ok && age < WeatherTTL+StaleIfError && upstreamFailed(status) {
+		span.SetAttributes(CacheStatusKey.String("stale_if_error"))
+		span.RecordError(err)
+		slog.Warn("serving stale weather", "city", rcep.City, "age", age, "error", err)
+		recordCep(ctx, rcep)
+		return cached.served(rcep, true), 200, "OK", nil
+	}
+	return dto.TempResponse{}, status, message, err
+}
+
+// fetchWeather gets the current weather of the city of rcep from the weather api.
+//
+// It makes a request to the weather api with apiKey
+// using the city name from the cep information. It then marshalls the response into a TempResponse,
+// in every unit and without rounding (see TempResponse.Format), and returns it, along with the
+// appropriate status and message.
 //
-// It returns an error if the cep is invalid, the request to the weather api fails, or if the
+// It returns an error if apiKey is empty, if the request to the weather api fails, or if the
 // response from the weather api is invalid.
 //
 // It returns 200, "OK" if the request is successful, 408, "Request Timeout" if the request times out,
-// 404, "Not Found" if the cep is invalid or the weather api can not find the city,
+// 404, "Not Found" if the weather api can not find the city,
 // 400, "Bad Request" if the request is invalid,
 // 422, "Unprocessable Entity" if the city is invalid,
+// 429, "Too Many Requests" if the weather api throttles the requests,
 // 500, "Internal Server Error" if there is an internal error,
 // 503, "Service Unavailable" if the weather api is unavailable,
 // or an error if an unknown error occurs.
-func GetWeather(ctx context.Context, cep string, zipkinClient *zipkinhttp.Client) (temps dto.TempResponse, status int, message string, eror error) {
-	rcep, status, message, err := getCep(ctx, cep)
-	if err != nil {
-		return dto.TempResponse{}, status, message, err
+func fetchWeather(ctx context.Context, rcep dto.Cep, zipkinClient *zipkinhttp.Client, apiKey secret.Secret) (temps dto.TempResponse, status int, message string, eror error) {
+	if apiKey == "" {
+		return dto.TempResponse{}, 500, "Internal Server Error", errors.Join(secret.ErrNotFound, errors.New("API_KEY is not set"))
 	}
 
-	api_key := os.Getenv("API_KEY")
-
-	url := "http://api.weatherapi.com/v1/current.json?key={{key}}&q={{city}}&aqi=no"
-	url = strings.Replace(url, "{{key}}", api_key, 1)
+	url := strings.Replace(weatherApiURL, "{{key}}", neturl.QueryEscape(apiKey.Reveal()), 1)
 	url = strings.Replace(url, "{{city}}", neturl.QueryEscape(rcep.City), 1)
 
-	slog.Info(url)
+	// the url carries the api key, only its sanitized form may be logged
+	slog.Info("weather request", "url", secret.SanitizeURL(url))
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return dto.TempResponse{}, 500, "Internal Server Error", err
+		return dto.TempResponse{}, 500, "Internal Server Error", secret.SanitizeError(err, apiKey)
 	}
 	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header)) // !
 	// res, err := http.DefaultClient.Do(req)
 	res, err := zipkinClient.Do(req)
 	if err != nil {
-		return dto.TempResponse{}, 500, "Internal Server Error", err
+		return dto.TempResponse{}, 500, "Internal Server Error", secret.SanitizeError(err, apiKey)
 	}
 
 	slog.Info("Status: ", "Status Code: ", res.StatusCode)
@@ -146,11 +242,13 @@ func GetWeather(ctx context.Context, cep string, zipkinClient *zipkinhttp.Client
 		if err != nil {
 			return dto.TempResponse{}, 500, "Internal Server Error", err
 		}
-		rtemp := dto.TempResponse{
-			City:   tempdto.Location.Name,
-			Temp_C: tempdto.Current.TempC,
-			Temp_F: tempdto.Current.TempC*1.8 + 32,
-			Temp_K: tempdto.Current.TempC + 273.0,
+		if !shared.EqualText(tempdto.Location.Name, rcep.City) {
+			slog.Warn("weather location does not match the cep city", "location", tempdto.Location.Name, "city", rcep.City)
+		}
+		rtemp := dto.NewTempResponse(tempdto.Location.Name, units.FromCelsius(tempdto.Current.TempC))
+		rtemp.Partial = rcep.Partial
+		if tempdto.Current.LastUpdatedEpoch > 0 {
+			rtemp.ObservedAt = time.Unix(int64(tempdto.Current.LastUpdatedEpoch), 0).UTC()
 		}
 		return rtemp, 200, "OK", nil
 	case http.StatusRequestTimeout:
@@ -165,6 +263,9 @@ func GetWeather(ctx context.Context, cep string, zipkinClient *zipkinhttp.Client
 	case http.StatusUnprocessableEntity:
 		return dto.TempResponse{}, 422, "Unprocessable Entity", errors.New("invalid city")
 
+	case http.StatusTooManyRequests:
+		return dto.TempResponse{}, 429, "Too Many Requests", errors.New("weather api quota exceeded")
+
 	case http.StatusInternalServerError:
 		return dto.TempResponse{}, 500, "Internal Server Error", errors.New("internal server error")
 
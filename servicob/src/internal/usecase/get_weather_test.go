@@ -1,9 +1,27 @@
 package usecase
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/dto"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/secret"
+	"github.com/openzipkin/zipkin-go"
+	zipkinhttp "github.com/openzipkin/zipkin-go/middleware/http"
+	"github.com/openzipkin/zipkin-go/reporter/recorder"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestGetWeather(t *testing.T) {
@@ -50,9 +68,10 @@ func TestGetWeather(t *testing.T) {
 			wantErr:     true,
 		},
 	}
+	client := newZipkinClient(t)
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, gotStatus, gotMessage, err := GetWeather(tt.args.ctx, tt.args.cep, nil)
+			_, gotStatus, gotMessage, err := GetWeather(tt.args.ctx, tt.args.cep, client, testAPIKey)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetWeather() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -66,3 +85,465 @@ func TestGetWeather(t *testing.T) {
 		})
 	}
 }
+
+const montesClarosViacep = `{
+	"cep": "39408-078",
+	"logradouro": "Avenida Herlindo Silveira",
+	"complemento": "",
+	"unidade": "",
+	"bairro": "Centro",
+	"localidade": "Montes Claros",
+	"uf": "MG",
+	"estado": "Minas Gerais",
+	"regiao": "Sudeste",
+	"ibge": "3143302",
+	"gia": "",
+	"ddd": "38",
+	"siafi": "4865"
+}`
+
+const montesClarosWeather = `{"location": {"name": "Montes Claros"}, "current": {"temp_c": 31.1}}`
+
+// testAPIKey is the weather api key the tests pass to the usecase.
+const testAPIKey secret.Secret = "test"
+
+// startFakeApis starts fake viacep and weather api servers and points the usecase to them.
+// A nil handler answers with the Montes Claros fixtures.
+func startFakeApis(t *testing.T, viacepHandler, weatherHandler http.HandlerFunc) {
+	t.Helper()
+	if viacepHandler == nil {
+		viacepHandler = func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(montesClarosViacep))
+		}
+	}
+	if weatherHandler == nil {
+		weatherHandler = func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(montesClarosWeather))
+		}
+	}
+	viacep := httptest.NewServer(viacepHandler)
+	t.Cleanup(viacep.Close)
+	weatherapi := httptest.NewServer(weatherHandler)
+	t.Cleanup(weatherapi.Close)
+
+	oldViacep, oldWeather, oldCache, oldAddresses := viacepURL, weatherApiURL, weathers, addresses
+	viacepURL = viacep.URL + "/ws/{{cep}}/json/"
+	weatherApiURL = weatherapi.URL + "/v1/current.json?key={{key}}&q={{city}}&aqi=no"
+	weathers = newWeatherCache()
+	addresses = newAddressCache()
+	t.Cleanup(func() {
+		weathers.refreshes.Wait()
+		viacepURL, weatherApiURL, weathers, addresses = oldViacep, oldWeather, oldCache, oldAddresses
+	})
+}
+
+// newZipkinClient returns a zipkin client whose spans are recorded and discarded.
+func newZipkinClient(t *testing.T) *zipkinhttp.Client {
+	t.Helper()
+	tracer, err := zipkin.NewTracer(recorder.NewReporter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := zipkinhttp.NewClient(tracer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestGetWeatherDoesNotLeakApiKey(t *testing.T) {
+	const apiKey = "c0ffee0123456789abcdef"
+
+	tests := []struct {
+		name       string
+		weather    http.HandlerFunc
+		closed     bool
+		wantStatus int
+	}{
+		{
+			name: "ok",
+			weather: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("key") != apiKey {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.Write([]byte(montesClarosWeather))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "service unavailable",
+			weather: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "connection refused",
+			weather:    func(w http.ResponseWriter, r *http.Request) {},
+			closed:     true,
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			startFakeApis(t, nil, tt.weather)
+			if tt.closed {
+				weatherApiURL = "http://127.0.0.1:1/v1/current.json?key={{key}}&q={{city}}&aqi=no"
+			}
+
+			var logs bytes.Buffer
+			oldLogger := slog.Default()
+			slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+			t.Cleanup(func() { slog.SetDefault(oldLogger) })
+
+			spans := tracetest.NewSpanRecorder()
+			oldProvider := otel.GetTracerProvider()
+			otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+			t.Cleanup(func() { otel.SetTracerProvider(oldProvider) })
+
+			reporter := recorder.NewReporter()
+			tracer, err := zipkin.NewTracer(reporter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client, err := zipkinhttp.NewClient(tracer, zipkinhttp.ClientTrace(true),
+				zipkinhttp.TransportOptions(zipkinhttp.TransportErrHandler(secret.ZipkinErrHandler(secret.Secret(apiKey)))),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, gotStatus, _, err := GetWeather(context.Background(), "39408078", client, secret.Secret(apiKey))
+			if gotStatus != tt.wantStatus {
+				t.Errorf("GetWeather() gotStatus = %v, want %v (error %v)", gotStatus, tt.wantStatus, err)
+			}
+			if err != nil && strings.Contains(err.Error(), apiKey) {
+				t.Errorf("GetWeather() error contains the api key: %v", err)
+			}
+			if strings.Contains(logs.String(), apiKey) {
+				t.Errorf("log records contain the api key: %s", logs.String())
+			}
+			for _, span := range reporter.Flush() {
+				j, err := json.Marshal(span)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if strings.Contains(string(j), apiKey) {
+					t.Errorf("zipkin span contains the api key: %s", j)
+				}
+			}
+			for _, span := range spans.Ended() {
+				j := fmt.Sprintf("%s %v %v %v", span.Name(), span.Attributes(), span.Events(), span.Status())
+				if strings.Contains(j, apiKey) {
+					t.Errorf("otel span contains the api key: %s", j)
+				}
+			}
+		})
+	}
+}
+
+func TestGetWeatherWithoutApiKey(t *testing.T) {
+	var calls atomic.Int32
+	startFakeApis(t, nil, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(montesClarosWeather))
+	})
+	tracer, err := zipkin.NewTracer(recorder.NewReporter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := zipkinhttp.NewClient(tracer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, status, _, err := GetWeather(context.Background(), "39408078", client, "")
+	if status != http.StatusInternalServerError || !errors.Is(err, secret.ErrNotFound) {
+		t.Errorf("GetWeather() status = %d, error = %v, want 500 and secret.ErrNotFound", status, err)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("the weather api was called %d times without a key", calls.Load())
+	}
+}
+
+func TestGetWeatherObservedAt(t *testing.T) {
+	tests := []struct {
+		name    string
+		weather string
+		want    time.Time
+	}{
+		{
+			name:    "observed",
+			weather: `{"location": {"name": "Montes Claros"}, "current": {"last_updated_epoch": 1792411200, "temp_c": 31.1}}`,
+			want:    time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+		},
+		{name: "unknown", weather: montesClarosWeather},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			startFakeApis(t, nil, func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.weather))
+			})
+			tracer, err := zipkin.NewTracer(recorder.NewReporter())
+			if err != nil {
+				t.Fatal(err)
+			}
+			client, err := zipkinhttp.NewClient(tracer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _, _, err := GetWeather(context.Background(), "39408078", client, testAPIKey)
+			if err != nil {
+				t.Fatalf("GetWeather() error = %v", err)
+			}
+			if !got.ObservedAt.Equal(tt.want) {
+				t.Errorf("GetWeather() ObservedAt = %v, want %v", got.ObservedAt, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetWeatherStale(t *testing.T) {
+	const observed = `{"location": {"name": "Montes Claros"}, "current": {"last_updated_epoch": 1792411200, "temp_c": %v}}`
+	observedAt := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		age        time.Duration // of the cached observation
+		upstream   int           // status of the weather api for the second call
+		wantStatus int
+		wantTemp   float64
+		wantStale  bool
+		wantCache  string
+		wantCalls  int32 // to the weather api, including the one filling the cache
+	}{
+		{name: "fresh", age: time.Minute, upstream: 200, wantStatus: 200, wantTemp: 20, wantCache: "fresh", wantCalls: 1},
+		{name: "stale while revalidate", age: WeatherTTL + time.Minute, upstream: 200, wantStatus: 200, wantTemp: 20, wantStale: true, wantCache: "stale", wantCalls: 2},
+		{name: "expired", age: WeatherTTL + StaleWhileRevalidate, upstream: 200, wantStatus: 200, wantTemp: 30, wantCache: "miss", wantCalls: 2},
+		{name: "stale if error", age: 2 * time.Hour, upstream: 503, wantStatus: 200, wantTemp: 20, wantStale: true, wantCache: "stale_if_error", wantCalls: 2},
+		{name: "timeout", age: 2 * time.Hour, upstream: 408, wantStatus: 200, wantTemp: 20, wantStale: true, wantCache: "stale_if_error", wantCalls: 2},
+		{name: "too old for stale if error", age: WeatherTTL + StaleIfError, upstream: 503, wantStatus: 503, wantCalls: 2},
+		{name: "city not found", age: 2 * time.Hour, upstream: 404, wantStatus: 404, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			startFakeApis(t, nil, func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) > 1 && tt.upstream != 200 {
+					w.WriteHeader(tt.upstream)
+					return
+				}
+				fmt.Fprintf(w, observed, 10*(calls.Load()+1))
+			})
+			tracer, err := zipkin.NewTracer(recorder.NewReporter())
+			if err != nil {
+				t.Fatal(err)
+			}
+			client, err := zipkinhttp.NewClient(tracer)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			now = func() time.Time { return start }
+			t.Cleanup(func() { now = time.Now })
+			if _, _, _, err := GetWeather(context.Background(), "39408078", client, testAPIKey); err != nil {
+				t.Fatal(err)
+			}
+
+			spans := tracetest.NewSpanRecorder()
+			ctx, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)).Tracer("test").Start(context.Background(), "test")
+			now = func() time.Time { return start.Add(tt.age) }
+			got, gotStatus, _, err := GetWeather(ctx, "39408078", client, testAPIKey)
+			span.End()
+			weathers.refreshes.Wait()
+
+			if gotStatus != tt.wantStatus {
+				t.Fatalf("GetWeather() status = %d, want %d (error %v)", gotStatus, tt.wantStatus, err)
+			}
+			if gotStatus == 200 {
+				if got.Temp_C != tt.wantTemp || got.Stale != tt.wantStale {
+					t.Errorf("GetWeather() temp_C = %v stale = %v, want %v %v", got.Temp_C, got.Stale, tt.wantTemp, tt.wantStale)
+				}
+				if !got.ObservedAt.Equal(observedAt) {
+					t.Errorf("GetWeather() ObservedAt = %v, want %v", got.ObservedAt, observedAt)
+				}
+			}
+			if n := calls.Load(); n != tt.wantCalls {
+				t.Errorf("%d weather api calls, want %d", n, tt.wantCalls)
+			}
+			var gotCache string
+			for _, kv := range spans.Ended()[0].Attributes() {
+				if kv.Key == CacheStatusKey {
+					gotCache = kv.Value.AsString()
+				}
+			}
+			if gotCache != tt.wantCache {
+				t.Errorf("%s = %q, want %q", CacheStatusKey, gotCache, tt.wantCache)
+			}
+		})
+	}
+}
+
+func TestGetWeatherRevalidated(t *testing.T) {
+	var calls atomic.Int32
+	startFakeApis(t, nil, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"location": {"name": "Montes Claros"}, "current": {"temp_c": %d}}`, 10*calls.Add(1))
+	})
+	tracer, err := zipkin.NewTracer(recorder.NewReporter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := zipkinhttp.NewClient(tracer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	now = func() time.Time { return start }
+	t.Cleanup(func() { now = time.Now })
+	get := func() dto.TempResponse {
+		t.Helper()
+		got, _, _, err := GetWeather(context.Background(), "39408078", client, testAPIKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	get()
+
+	now = func() time.Time { return start.Add(WeatherTTL) }
+	if got := get(); got.Temp_C != 10 || !got.Stale {
+		t.Errorf("GetWeather() = %v stale %v, want the stale 10", got.Temp_C, got.Stale)
+	}
+	weathers.refreshes.Wait()
+	if got := get(); got.Temp_C != 20 || got.Stale {
+		t.Errorf("GetWeather() = %v stale %v, want the refreshed 20", got.Temp_C, got.Stale)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("%d weather api calls, want 2", n)
+	}
+}
+
+func TestWeatherCacheEviction(t *testing.T) {
+	old := MaxCachedWeathers
+	MaxCachedWeathers = 2
+	t.Cleanup(func() { MaxCachedWeathers = old; now = time.Now })
+	c := newWeatherCache()
+	start := time.Now()
+	for i, key := range []string{"a", "b", "c"} {
+		now = func() time.Time { return start.Add(time.Duration(i) * time.Minute) }
+		c.put(key, dto.TempResponse{City: key})
+	}
+	if _, ok := c.get("a"); ok {
+		t.Error("the oldest entry was not evicted")
+	}
+	for _, key := range []string{"b", "c"} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("entry %s was evicted", key)
+		}
+	}
+}
+
+func TestRefreshWeather(t *testing.T) {
+	var calls atomic.Int32
+	startFakeApis(t, nil, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 3 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprintf(w, `{"location": {"name": "Montes Claros"}, "current": {"temp_c": %d}}`, 10*calls.Load())
+	})
+	tracer, err := zipkin.NewTracer(recorder.NewReporter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := zipkinhttp.NewClient(tracer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	now = func() time.Time { return start }
+	t.Cleanup(func() { now = time.Now })
+	refresh := func(wantFetched bool, wantStatus int) {
+		t.Helper()
+		fetched, status, _, _ := RefreshWeather(context.Background(), "39408078", 5*time.Minute, client, testAPIKey)
+		if fetched != wantFetched || status != wantStatus {
+			t.Errorf("RefreshWeather() = %v, %d, want %v, %d", fetched, status, wantFetched, wantStatus)
+		}
+	}
+
+	refresh(true, http.StatusOK)
+	// the city was refreshed less than maxAge ago
+	now = func() time.Time { return start.Add(time.Minute) }
+	refresh(false, http.StatusOK)
+
+	// the refresh keeps the weather fresh past WeatherTTL
+	now = func() time.Time { return start.Add(10 * time.Minute) }
+	refresh(true, http.StatusOK)
+	now = func() time.Time { return start.Add(WeatherTTL + time.Minute) }
+	got, _, _, err := GetWeather(context.Background(), "39408078", client, testAPIKey)
+	if err != nil || got.Temp_C != 20 || got.Stale {
+		t.Errorf("GetWeather() = %v stale %v, error %v, want the fresh 20", got.Temp_C, got.Stale, err)
+	}
+
+	now = func() time.Time { return start.Add(20 * time.Minute) }
+	refresh(true, http.StatusTooManyRequests)
+}
+
+func TestGetCachedWeather(t *testing.T) {
+	var viacepCalls, weatherCalls atomic.Int32
+	startFakeApis(t, func(w http.ResponseWriter, r *http.Request) {
+		viacepCalls.Add(1)
+		w.Write([]byte(montesClarosViacep))
+	}, func(w http.ResponseWriter, r *http.Request) {
+		weatherCalls.Add(1)
+		w.Write([]byte(montesClarosWeather))
+	})
+	client := newZipkinClient(t)
+	start := time.Now()
+	t.Cleanup(func() { now = time.Now })
+
+	tests := []struct {
+		name       string
+		cep        string
+		after      time.Duration
+		fetch      bool
+		wantStatus int
+		wantStale  bool
+		wantErr    error
+	}{
+		{name: "invalid cep", cep: "3940807", wantStatus: http.StatusUnprocessableEntity},
+		{name: "not cached", cep: "39408078", wantStatus: http.StatusGatewayTimeout, wantErr: ErrNotCached},
+		{name: "fresh", cep: "39408-078", fetch: true, after: time.Minute, wantStatus: http.StatusOK},
+		{name: "stale", cep: "39408078", after: WeatherTTL, wantStatus: http.StatusOK, wantStale: true},
+		{name: "expired", cep: "39408078", after: WeatherTTL + max(StaleWhileRevalidate, StaleIfError), wantStatus: http.StatusGatewayTimeout, wantErr: ErrNotCached},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = func() time.Time { return start }
+			if tt.fetch {
+				if _, _, _, err := GetWeather(context.Background(), tt.cep, client, testAPIKey); err != nil {
+					t.Fatal(err)
+				}
+			}
+			viacep, weather := viacepCalls.Load(), weatherCalls.Load()
+			now = func() time.Time { return start.Add(tt.after) }
+			got, status, _, err := GetCachedWeather(context.Background(), tt.cep)
+			if status != tt.wantStatus {
+				t.Fatalf("GetCachedWeather() status = %d, want %d (error %v)", status, tt.wantStatus, err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("GetCachedWeather() error = %v, want %v", err, tt.wantErr)
+			}
+			if status == http.StatusOK && (got.Temp_C != 31.1 || got.Stale != tt.wantStale) {
+				t.Errorf("GetCachedWeather() = %v stale %v, want 31.1 stale %v", got.Temp_C, got.Stale, tt.wantStale)
+			}
+			if viacepCalls.Load() != viacep || weatherCalls.Load() != weather {
+				t.Error("GetCachedWeather() called the apis")
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/dto"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/shared"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/validation"
+	zipkinhttp "github.com/openzipkin/zipkin-go/middleware/http"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+var viacepSearchURL = "http://viacep.com.br/ws/{{uf}}/{{city}}/{{street}}/json/"
+
+const (
+	// MinSearchLength is the minimum length of the city and street of a search, as required by ViaCEP.
+	MinSearchLength = 3
+	// DefaultPageSize is the page size used when none is given.
+	DefaultPageSize = 10
+	// MaxPageSize is the largest page size accepted. ViaCEP never returns more than 50 results.
+	MaxPageSize = 50
+)
+
+// SearchCeps searches the ceps of a street in a city of the state uf.
+//
+// The street may be partial. The results are deduplicated by cep and ranked by how well
+// the street matches: exact matches first, then streets starting with it, then streets
+// with a word starting with it, then the remaining ones. Streets are compared with
+// shared.NormalizeText, so accents, case and white space do not matter; ceps of the same
+// street are ordered by neighborhood, compared the same way. The page-th page (starting at 1)
+// with pageSize results is returned; pageSize 0 means DefaultPageSize. ViaCEP is called
+// with zipkinClient, so the search appears in the traces.
+//
+// It returns 200, "OK" on success, even when nothing is found,
+// 422, "Unprocessable Entity" if uf is not a valid state, city or street are shorter than
+// MinSearchLength, or the page is out of range, with a validation.Errors listing all of them,
+// 408, "Request Timeout", 500, "Internal Server Error" and 503, "Service Unavailable" on failures.
+func SearchCeps(ctx context.Context, uf, city, street string, page, pageSize int, zipkinClient *zipkinhttp.Client) (result dto.CepPage, status int, message string, err error) {
+	uf = strings.ToUpper(strings.TrimSpace(uf))
+	city = strings.TrimSpace(city)
+	street = strings.TrimSpace(street)
+	if pageSize == 0 {
+		pageSize = DefaultPageSize
+	}
+
+	var errs validation.Errors
+	if !shared.ValidateStateShort(uf) {
+		errs.Add("uf", validation.RuleOneOf, uf, "invalid state")
+	}
+	if utf8.RuneCountInString(city) < MinSearchLength {
+		errs.Add("city", validation.RuleMinLength, city, "city must have at least 3 characters")
+	}
+	if utf8.RuneCountInString(street) < MinSearchLength {
+		errs.Add("street", validation.RuleMinLength, street, "street must have at least 3 characters")
+	}
+	if page < 1 {
+		errs.Add("page", validation.RuleRange, strconv.Itoa(page), "page must be at least 1")
+	}
+	if pageSize < 1 || pageSize > MaxPageSize {
+		errs.Add("page_size", validation.RuleRange, strconv.Itoa(pageSize), "page size must be between 1 and 50")
+	}
+	if err := errs.Err(); err != nil {
+		return dto.CepPage{}, 422, "Unprocessable Entity", err
+	}
+
+	url := strings.Replace(viacepSearchURL, "{{uf}}", uf, 1)
+	url = strings.Replace(url, "{{city}}", neturl.PathEscape(city), 1)
+	url = strings.Replace(url, "{{street}}", neturl.PathEscape(street), 1)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return dto.CepPage{}, 500, "Internal Server Error", err
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	res, err := zipkinClient.Do(req)
+	if err != nil {
+		return dto.CepPage{}, 500, "Internal Server Error", err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return dto.CepPage{}, 500, "Internal Server Error", errors.New("fail to read the body response: " + err.Error())
+		}
+		var found []dto.Viacep
+		if err := json.Unmarshal(body, &found); err != nil {
+			return dto.CepPage{}, 500, "Internal Server Error", err
+		}
+		ceps := rankCeps(found, street)
+		slog.Info("search", "uf", uf, "city", city, "street", street, "found", len(ceps))
+		return dto.NewCepPage(ceps, page, pageSize), 200, "OK", nil
+
+	case http.StatusRequestTimeout:
+		return dto.CepPage{}, 408, "Request Timeout", errors.New("time exceeded")
+
+	case http.StatusBadRequest:
+		return dto.CepPage{}, 422, "Unprocessable Entity", errors.New("invalid search")
+
+	case http.StatusServiceUnavailable:
+		return dto.CepPage{}, 503, "Service Unavailable", errors.New("service unavailable")
+
+	default:
+		return dto.CepPage{}, 500, "Internal Server Error", errors.New("internal server error")
+	}
+}
+
+// rankCeps validates with ValidationProfile, deduplicates by cep and sorts the search
+// results by how well their street matches street. Ties are ordered by street, then by
+// neighborhood, both compared with shared.NormalizeText, and then by cep.
+func rankCeps(found []dto.Viacep, street string) []dto.Cep {
+	type ranked struct {
+		cep          dto.Cep
+		rank         int
+		street       string
+		neighborhood string
+	}
+	street = shared.NormalizeText(street)
+	seen := make(map[string]bool, len(found))
+	results := make([]ranked, 0, len(found))
+	for _, v := range found {
+		warnings, err := v.ValidateWith(ValidationProfile)
+		if err != nil {
+			slog.Debug("search", "skipping", v.Cep, "error", err)
+			continue
+		}
+		c := v.ToCep()
+		c.Partial = len(warnings) > 0
+		if seen[c.Cep] {
+			continue
+		}
+		seen[c.Cep] = true
+		normalized := shared.NormalizeText(c.Street)
+		results = append(results, ranked{
+			cep:          c,
+			rank:         streetRank(normalized, street),
+			street:       normalized,
+			neighborhood: shared.NormalizeText(c.Neighborhood),
+		})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.rank != b.rank {
+			return a.rank < b.rank
+		}
+		if a.street != b.street {
+			return a.street < b.street
+		}
+		if a.neighborhood != b.neighborhood {
+			return a.neighborhood < b.neighborhood
+		}
+		return a.cep.Cep < b.cep.Cep
+	})
+	ceps := make([]dto.Cep, len(results))
+	for i, r := range results {
+		ceps[i] = r.cep
+	}
+	return ceps
+}
+
+// streetRank returns 0 if candidate is query, 1 if it starts with query, 2 if one of
+// its words starts with query and 3 otherwise. Both must be normalized with shared.NormalizeText.
+func streetRank(candidate, query string) int {
+	switch {
+	case candidate == query:
+		return 0
+	case strings.HasPrefix(candidate, query):
+		return 1
+	case strings.Contains(candidate, " "+query):
+		return 2
+	default:
+		return 3
+	}
+}
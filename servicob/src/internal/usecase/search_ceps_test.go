@@ -0,0 +1,209 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/dto"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/validation"
+	"github.com/openzipkin/zipkin-go"
+	zipkinhttp "github.com/openzipkin/zipkin-go/middleware/http"
+	"github.com/openzipkin/zipkin-go/reporter/recorder"
+)
+
+const herlindoSearch = `[
+	{"cep": "39401-001", "logradouro": "Rua Doutor Herlindo", "bairro": "Centro", "localidade": "Montes Claros", "uf": "MG", "estado": "Minas Gerais", "regiao": "Sudeste"},
+	{"cep": "39408-078", "logradouro": "Avenida Herlindo Silveira", "complemento": "até 999", "bairro": "Centro", "localidade": "Montes Claros", "uf": "MG", "estado": "Minas Gerais", "regiao": "Sudeste"},
+	{"cep": "39408-078", "logradouro": "Avenida Herlindo Silveira", "complemento": "de 1000 ao fim", "bairro": "Centro", "localidade": "Montes Claros", "uf": "MG", "estado": "Minas Gerais", "regiao": "Sudeste"},
+	{"cep": "39400-100", "logradouro": "Herlindo Silveira", "bairro": "Centro", "localidade": "Montes Claros", "uf": "MG", "estado": "Minas Gerais", "regiao": "Sudeste"},
+	{"cep": "39400-200", "logradouro": "Herlindo Silveira Filho", "bairro": "Centro", "localidade": "Montes Claros", "uf": "MG", "estado": "Minas Gerais", "regiao": "Sudeste"},
+	{"cep": "39400-300", "logradouro": "Travessa Sherlindo", "bairro": "Centro", "localidade": "Montes Claros", "uf": "MG", "estado": "Minas Gerais", "regiao": "Sudeste"},
+	{"cep": "39400-400", "logradouro": "Rua Zé Herlindo", "bairro": "São José", "localidade": "Montes Claros", "uf": "MG", "estado": "Minas Gerais", "regiao": "Sudeste"}
+]`
+
+func TestSearchCeps(t *testing.T) {
+	var gotPath, gotTraceID string
+	viacep := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotTraceID = r.Header.Get("X-B3-TraceId")
+		w.Write([]byte(herlindoSearch))
+	}))
+	defer viacep.Close()
+	old := viacepSearchURL
+	viacepSearchURL = viacep.URL + "/ws/{{uf}}/{{city}}/{{street}}/json/"
+	defer func() { viacepSearchURL = old }()
+	tracer, err := zipkin.NewTracer(recorder.NewReporter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := zipkinhttp.NewClient(tracer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type args struct {
+		uf       string
+		city     string
+		street   string
+		page     int
+		pageSize int
+	}
+	tests := []struct {
+		name       string
+		args       args
+		wantCeps   []string
+		wantTotal  int
+		wantStatus int
+		wantErr    bool
+		// the violations, as field/rule, of the validation error
+		wantViolations []string
+	}{
+		{
+			name:       "search ranked and deduplicated",
+			args:       args{uf: "mg", city: "Montes Claros", street: "Herlindo Silveira", page: 1},
+			wantCeps:   []string{"39400-100", "39400-200", "39408-078", "39401-001", "39400-400", "39400-300"},
+			wantTotal:  6,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "search without accents and case",
+			args:       args{uf: "MG", city: "Montes Claros", street: "HERLÍNDO  silveira", page: 1},
+			wantCeps:   []string{"39400-100", "39400-200", "39408-078", "39401-001", "39400-400", "39400-300"},
+			wantTotal:  6,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "search second page",
+			args:       args{uf: "MG", city: "Montes Claros", street: "Herlindo Silveira", page: 2, pageSize: 2},
+			wantCeps:   []string{"39408-078", "39401-001"},
+			wantTotal:  6,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "search page past the end",
+			args:       args{uf: "MG", city: "Montes Claros", street: "Herlindo", page: 9},
+			wantCeps:   []string{},
+			wantTotal:  6,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid state",
+			args:           args{uf: "MM", city: "Montes Claros", street: "Herlindo", page: 1},
+			wantStatus:     http.StatusUnprocessableEntity,
+			wantErr:        true,
+			wantViolations: []string{"uf/one_of"},
+		},
+		{
+			name:           "short city",
+			args:           args{uf: "MG", city: "Mo", street: "Herlindo", page: 1},
+			wantStatus:     http.StatusUnprocessableEntity,
+			wantErr:        true,
+			wantViolations: []string{"city/min_length"},
+		},
+		{
+			name:           "short street",
+			args:           args{uf: "MG", city: "Montes Claros", street: " He ", page: 1},
+			wantStatus:     http.StatusUnprocessableEntity,
+			wantErr:        true,
+			wantViolations: []string{"street/min_length"},
+		},
+		{
+			name:           "page size too large",
+			args:           args{uf: "MG", city: "Montes Claros", street: "Herlindo", page: 1, pageSize: 51},
+			wantStatus:     http.StatusUnprocessableEntity,
+			wantErr:        true,
+			wantViolations: []string{"page_size/range"},
+		},
+		{
+			name:           "every field invalid",
+			args:           args{uf: "", city: "", street: "", page: -1, pageSize: -1},
+			wantStatus:     http.StatusUnprocessableEntity,
+			wantErr:        true,
+			wantViolations: []string{"uf/one_of", "city/min_length", "street/min_length", "page/range", "page_size/range"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotStatus, _, err := SearchCeps(context.Background(), tt.args.uf, tt.args.city, tt.args.street, tt.args.page, tt.args.pageSize, client)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SearchCeps() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotStatus != tt.wantStatus {
+				t.Errorf("SearchCeps() gotStatus = %v, want %v", gotStatus, tt.wantStatus)
+			}
+			if tt.wantErr {
+				var gotViolations []string
+				for _, v := range validation.Violations(err) {
+					gotViolations = append(gotViolations, v.Field+"/"+v.Rule)
+				}
+				if !reflect.DeepEqual(gotViolations, tt.wantViolations) {
+					t.Errorf("SearchCeps() violations = %v, want %v", gotViolations, tt.wantViolations)
+				}
+				return
+			}
+			gotCeps := []string{}
+			for _, c := range got.Items {
+				gotCeps = append(gotCeps, c.Cep)
+			}
+			if !reflect.DeepEqual(gotCeps, tt.wantCeps) {
+				t.Errorf("SearchCeps() ceps = %v, want %v", gotCeps, tt.wantCeps)
+			}
+			if got.Total != tt.wantTotal {
+				t.Errorf("SearchCeps() total = %v, want %v", got.Total, tt.wantTotal)
+			}
+			if gotPath != "/ws/MG/Montes Claros/"+tt.args.street+"/json/" {
+				t.Errorf("SearchCeps() requested %v", gotPath)
+			}
+			if gotTraceID == "" {
+				t.Error("SearchCeps() did not propagate the trace to ViaCEP")
+			}
+		})
+	}
+}
+
+func TestRankCeps(t *testing.T) {
+	var found []dto.Viacep
+	err := json.Unmarshal([]byte(`[
+		{"cep": "39400-500", "logradouro": "Rua Herlindo", "bairro": "vila Alegre", "localidade": "Montes Claros", "uf": "MG", "estado": "Minas Gerais", "regiao": "Sudeste"},
+		{"cep": "39400-600", "logradouro": "RUA HERLINDO", "bairro": "Vila Élida", "localidade": "Montes Claros", "uf": "MG", "estado": "Minas Gerais", "regiao": "Sudeste"},
+		{"cep": "39400-700", "logradouro": "Rua Herlindo", "bairro": "Centro", "localidade": "Montes Claros", "uf": "MG", "estado": "Minas Gerais", "regiao": "Sudeste"},
+		{"cep": "39400-400", "logradouro": "Rua Herlindo", "bairro": "Vila Elida", "localidade": "Montes Claros", "uf": "MG", "estado": "Minas Gerais", "regiao": "Sudeste"},
+		{"cep": "39400-100", "logradouro": "Herlindo Silveira", "bairro": "Ibituruna", "localidade": "Montes Claros", "uf": "MG", "estado": "Minas Gerais", "regiao": "Sudeste"}
+	]`), &found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		street   string
+		wantCeps []string
+	}{
+		{
+			name:   "same street ordered by neighborhood without accents and case",
+			street: "rua herlindo",
+			// centro, vila alegre, then both vila elida ordered by cep
+			wantCeps: []string{"39400-700", "39400-500", "39400-400", "39400-600", "39400-100"},
+		},
+		{
+			name:     "rank before neighborhood",
+			street:   "Herlindo",
+			wantCeps: []string{"39400-100", "39400-700", "39400-500", "39400-400", "39400-600"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotCeps := []string{}
+			for _, c := range rankCeps(found, tt.street) {
+				gotCeps = append(gotCeps, c.Cep)
+			}
+			if !reflect.DeepEqual(gotCeps, tt.wantCeps) {
+				t.Errorf("rankCeps() = %v, want %v", gotCeps, tt.wantCeps)
+			}
+		})
+	}
+}
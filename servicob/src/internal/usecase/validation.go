@@ -0,0 +1,41 @@
+package usecase
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/dto"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/validation"
+	"github.com/openzipkin/zipkin-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ValidationProfile is the profile used to validate the ViaCEP responses.
+// main sets it from the VALIDATION_PROFILE environment variable.
+var ValidationProfile = dto.Lenient
+
+// reportWarnings records the validation warnings of the cep as events of the current
+// otel span and annotations of the current zipkin span.
+func reportWarnings(ctx context.Context, cep string, warnings validation.Errors) {
+	if len(warnings) == 0 {
+		return
+	}
+	slog.Warn("partial address", "cep", cep, "warnings", warnings)
+	span := trace.SpanFromContext(ctx)
+	zspan := zipkin.SpanFromContext(ctx)
+	for _, w := range warnings {
+		span.AddEvent("validation warning", trace.WithAttributes(
+			attribute.String("cep", cep),
+			attribute.String("profile", string(ValidationProfile)),
+			attribute.String("field", w.Field),
+			attribute.String("rule", w.Rule),
+			attribute.String("value", w.Value),
+			attribute.String("warning", w.Message),
+		))
+		if zspan != nil {
+			zspan.Annotate(time.Now(), "validation warning: "+w.Error())
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/dto"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/secret"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/shared"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/validation"
+	zipkinhttp "github.com/openzipkin/zipkin-go/middleware/http"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StaleWhileRevalidate is how long after WeatherTTL a cached observation is still
+// served, while it is refreshed in background. 0 disables it.
+var StaleWhileRevalidate = 15 * time.Minute
+
+// StaleIfError is how long after WeatherTTL a cached observation is served when the
+// weather api fails. 0 disables it.
+var StaleIfError = 24 * time.Hour
+
+// MaxCachedWeathers bounds the number of cities in the weather cache.
+var MaxCachedWeathers = 10000
+
+// CacheStatusKey tells how GetWeather used the weather cache: fresh, stale (served while
+// it is refreshed), miss, or stale_if_error (served because the weather api failed);
+// RefreshWeather: fresh or refresh; and GetCachedWeather: fresh or stale.
+const CacheStatusKey = attribute.Key("weather.cache")
+
+// refreshTimeout bounds the background refreshes, like the handlers bound GetWeather.
+const refreshTimeout = 10 * time.Second
+
+var now = time.Now
+
+// weathers is the cache of the weather of the cities, by shared.CacheKey of the city and
+// its state.
+var weathers = newWeatherCache()
+
+type cachedWeather struct {
+	temps     dto.TempResponse
+	fetchedAt time.Time
+}
+
+type weatherCache struct {
+	mu         sync.Mutex
+	entries    map[string]cachedWeather
+	refreshing map[string]bool
+	// refreshes tracks the background refreshes, so tests can wait for them.
+	refreshes sync.WaitGroup
+}
+
+func newWeatherCache() *weatherCache {
+	return &weatherCache{entries: map[string]cachedWeather{}, refreshing: map[string]bool{}}
+}
+
+func (c *weatherCache) get(key string) (cachedWeather, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	return e, ok
+}
+
+// put caches temps, evicting the entries too old to be served and, if the cache is
+// still full, the oldest one.
+func (c *weatherCache) put(key string, temps dto.TempResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fetchedAt := now()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= MaxCachedWeathers {
+		maxAge := WeatherTTL + max(StaleWhileRevalidate, StaleIfError)
+		oldest := ""
+		for k, e := range c.entries {
+			if fetchedAt.Sub(e.fetchedAt) >= maxAge {
+				delete(c.entries, k)
+			} else if oldest == "" || e.fetchedAt.Before(c.entries[oldest].fetchedAt) {
+				oldest = k
+			}
+		}
+		if len(c.entries) >= MaxCachedWeathers {
+			delete(c.entries, oldest)
+		}
+	}
+	c.entries[key] = cachedWeather{temps: temps, fetchedAt: fetchedAt}
+}
+
+// refresh fetches the weather of rcep in background and caches it, unless it is already
+// being refreshed.
+func (c *weatherCache) refresh(ctx context.Context, key string, rcep dto.Cep, zipkinClient *zipkinhttp.Client, apiKey secret.Secret) {
+	c.mu.Lock()
+	if c.refreshing[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing[key] = true
+	c.refreshes.Add(1)
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+	go func() {
+		defer c.refreshes.Done()
+		defer cancel()
+		defer func() {
+			c.mu.Lock()
+			delete(c.refreshing, key)
+			c.mu.Unlock()
+		}()
+
+		ctx, span := otel.Tracer("microservice-tracer").Start(ctx, "weather refresh", trace.WithAttributes(attribute.String("city", rcep.City)))
+		defer span.End()
+		temps, _, _, err := fetchWeather(ctx, rcep, zipkinClient, apiKey)
+		if err != nil {
+			span.RecordError(err)
+			slog.Warn("weather refresh failed", "city", rcep.City, "error", err)
+			return
+		}
+		c.put(key, temps)
+		recordObservation(ctx, rcep, temps)
+	}()
+}
+
+// served returns the cached response for rcep, flagged stale or not.
+func (e cachedWeather) served(rcep dto.Cep, stale bool) dto.TempResponse {
+	temps := e.temps
+	temps.Partial = rcep.Partial
+	temps.Stale = stale
+	return temps
+}
+
+// upstreamFailed reports whether a failed fetch of the weather is an outage of the
+// weather api, rather than a city it does not know.
+func upstreamFailed(status int) bool {
+	return status >= http.StatusInternalServerError ||
+		status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+}
+
+// RefreshWeather fetches the weather of the city of cep into the cache and History, as
+// the watchlist does for the ceps it watches, unless it was fetched less than maxAge
+// ago: ceps of the same city share their weather. fetched tells whether the weather api
+// was called.
+//
+// It returns the status, message and error of getCep or of fetchWeather when they fail.
+func RefreshWeather(ctx context.Context, cep string, maxAge time.Duration, zipkinClient *zipkinhttp.Client, apiKey secret.Secret) (fetched bool, status int, message string, err error) {
+	rcep, status, message, err := getCep(ctx, cep, zipkinClient)
+	if err != nil {
+		return false, status, message, err
+	}
+
+	span := trace.SpanFromContext(ctx)
+	key := shared.CacheKey(rcep.City, rcep.State)
+	if cached, ok := weathers.get(key); ok && now().Sub(cached.fetchedAt) < maxAge {
+		span.SetAttributes(CacheStatusKey.String("fresh"))
+		recordCep(ctx, rcep)
+		return false, 200, "OK", nil
+	}
+	span.SetAttributes(CacheStatusKey.String("refresh"))
+	temps, status, message, err := fetchWeather(ctx, rcep, zipkinClient, apiKey)
+	if err != nil {
+		return true, status, message, err
+	}
+	weathers.put(key, temps)
+	recordObservation(ctx, rcep, temps)
+	return true, status, message, nil
+}
+
+// ErrNotCached is returned by GetCachedWeather when the weather of the cep is not cached.
+var ErrNotCached = errors.New("weather is not cached")
+
+// GetCachedWeather gets the weather of cep from the caches only, for the clients that
+// poll it, like the streams of servicoa: neither ViaCEP nor the weather api are called,
+// so the polls cost nothing upstream, and the weather changes when the watchlist or the
+// other requests refresh it. It is served for as long as GetWeather serves it from the
+// cache, flagged Stale after WeatherTTL.
+//
+// It returns 422, "Unprocessable Entity" if the cep is invalid, 504, "Gateway Timeout"
+// and ErrNotCached if the address of the cep or the weather of its city are not cached,
+// and the status, message and error of getCep if the cached address is not valid.
+func GetCachedWeather(ctx context.Context, cep string) (temps dto.TempResponse, status int, message string, err error) {
+	parsed, err := shared.ParseCep(cep)
+	if err != nil {
+		var errs validation.Errors
+		errs.Add("cep", validation.RuleFormat, cep, "invalid zipcode")
+		return dto.TempResponse{}, 422, "Unprocessable Entity", errs
+	}
+	cepdto, ok := addresses.get(parsed.Canonical())
+	if !ok {
+		return dto.TempResponse{}, 504, "Gateway Timeout", ErrNotCached
+	}
+	rcep, status, message, err := toCep(ctx, cepdto)
+	if err != nil {
+		return dto.TempResponse{}, status, message, err
+	}
+
+	cached, ok := weathers.get(shared.CacheKey(rcep.City, rcep.State))
+	age := now().Sub(cached.fetchedAt)
+	if !ok || age >= WeatherTTL+max(StaleWhileRevalidate, StaleIfError) {
+		return dto.TempResponse{}, 504, "Gateway Timeout", ErrNotCached
+	}
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(AddressCacheStatusKey.String("fresh"))
+	if age < WeatherTTL {
+		span.SetAttributes(CacheStatusKey.String("fresh"))
+		return cached.served(rcep, false), 200, "OK", nil
+	}
+	span.SetAttributes(CacheStatusKey.String("stale"))
+	return cached.served(rcep, true), 200, "OK", nil
+}
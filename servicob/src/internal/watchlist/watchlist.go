@@ -0,0 +1,278 @@
+// Package watchlist refreshes the weather of a list of ceps in background, so the
+// requests for them are served from the cache instead of waiting for the weather api.
+package watchlist
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/dto"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/shared"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/validation"
+)
+
+// RefreshFunc refreshes the weather of cep, unless it was fetched less than maxAge ago.
+// fetched tells whether the weather api was called, and status is the http status of
+// the refresh: 429 when the weather api throttled it.
+type RefreshFunc func(ctx context.Context, cep string, maxAge time.Duration) (fetched bool, status int, err error)
+
+// Config configures a Scheduler.
+type Config struct {
+	// Interval is the period of the refreshes of each cep. It should be shorter than
+	// the time the weather stays fresh in the cache.
+	Interval time.Duration
+	// Jitter spreads the refreshes by up to this fraction of Interval, earlier or later,
+	// so the ceps added together are not refreshed together.
+	Jitter float64
+	// MaxCallsPerHour bounds the calls to the weather api: the refreshes beyond it wait
+	// for the next hour. 0 is unlimited.
+	MaxCallsPerHour int
+	// MaxCeps bounds the number of ceps of the watchlist.
+	MaxCeps int
+	// Backoff is how long the refreshes pause when the weather api throttles them. It
+	// doubles while the weather api keeps throttling, up to Interval.
+	Backoff time.Duration
+}
+
+// DefaultConfig refreshes every 10 minutes, within the 15 minutes the weather stays
+// fresh, with 10% of jitter.
+func DefaultConfig() Config {
+	return Config{
+		Interval: 10 * time.Minute,
+		Jitter:   .1,
+		MaxCeps:  1000,
+		Backoff:  time.Minute,
+	}
+}
+
+// quotaWindow is the window of Config.MaxCallsPerHour.
+const quotaWindow = time.Hour
+
+// Scheduler refreshes the weather of the ceps of the watchlist every Config.Interval,
+// one at a time, within the quota of calls to the weather api. It is safe for
+// concurrent use.
+type Scheduler struct {
+	cfg     Config
+	refresh RefreshFunc
+	now     func() time.Time
+	// jitter returns a random number in [-1, 1).
+	jitter func() float64
+
+	mu      sync.Mutex
+	ceps    map[string]*dto.WatchedCep
+	running bool
+	// wake interrupts the wait of Run when a cep is added.
+	wake        chan struct{}
+	windowStart time.Time
+	calls       int
+	pausedUntil time.Time
+	backoff     time.Duration
+}
+
+// New returns a Scheduler refreshing the weather of its ceps with refresh. It does not
+// refresh anything before Run.
+func New(cfg Config, refresh RefreshFunc) *Scheduler {
+	return &Scheduler{
+		cfg:     cfg,
+		refresh: refresh,
+		now:     time.Now,
+		jitter:  func() float64 { return 2*rand.Float64() - 1 },
+		ceps:    map[string]*dto.WatchedCep{},
+		wake:    make(chan struct{}, 1),
+		backoff: cfg.Backoff,
+	}
+}
+
+// Add adds cep to the watchlist, to be refreshed within Jitter of Interval. added is
+// false if it was already watched. It returns validation.Errors if cep is invalid or
+// the watchlist is full.
+func (s *Scheduler) Add(cep string) (watched dto.WatchedCep, added bool, err error) {
+	parsed, err := shared.ParseCep(cep)
+	if err != nil {
+		var errs validation.Errors
+		errs.Add("cep", validation.RuleFormat, cep, "invalid zipcode")
+		return dto.WatchedCep{}, false, errs
+	}
+	cep = parsed.Canonical()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.ceps[cep]; ok {
+		return *e, false, nil
+	}
+	if len(s.ceps) >= s.cfg.MaxCeps {
+		var errs validation.Errors
+		errs.Add("cep", validation.RuleRange, cep, fmt.Sprintf("the watchlist is full: at most %d ceps", s.cfg.MaxCeps))
+		return dto.WatchedCep{}, false, errs
+	}
+	t := s.now()
+	e := &dto.WatchedCep{
+		Cep:         cep,
+		AddedAt:     t.UTC(),
+		NextRefresh: t.Add(time.Duration(s.cfg.Jitter * (s.jitter() + 1) / 2 * float64(s.cfg.Interval))).UTC(),
+	}
+	s.ceps[cep] = e
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return *e, true, nil
+}
+
+// Remove removes cep from the watchlist, reporting whether it was watched.
+func (s *Scheduler) Remove(cep string) bool {
+	parsed, err := shared.ParseCep(cep)
+	if err != nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.ceps[parsed.Canonical()]
+	delete(s.ceps, parsed.Canonical())
+	return ok
+}
+
+// Status returns the ceps of the watchlist, by cep, and the state of the scheduler.
+func (s *Scheduler) Status() dto.Watchlist {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.now()
+	status := dto.Watchlist{
+		Interval: s.cfg.Interval.String(),
+		Jitter:   s.cfg.Jitter,
+		Running:  s.running,
+		Ceps:     make([]dto.WatchedCep, 0, len(s.ceps)),
+	}
+	if t.Before(s.pausedUntil) {
+		pausedUntil := s.pausedUntil.UTC()
+		status.PausedUntil = &pausedUntil
+	}
+	if s.cfg.MaxCallsPerHour > 0 {
+		s.resetQuota(t)
+		status.Quota = &dto.WatchlistQuota{
+			Limit:    s.cfg.MaxCallsPerHour,
+			Used:     s.calls,
+			ResetsAt: s.windowStart.Add(quotaWindow).UTC(),
+		}
+	}
+	for _, e := range s.ceps {
+		status.Ceps = append(status.Ceps, *e)
+	}
+	slices.SortFunc(status.Ceps, func(a, b dto.WatchedCep) int { return strings.Compare(a.Cep, b.Cep) })
+	return status
+}
+
+// Run refreshes the ceps when they are due until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.setRunning(true)
+	defer s.setRunning(false)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for ctx.Err() == nil {
+		cep, wait := s.next()
+		if cep != "" {
+			s.refreshCep(ctx, cep)
+			continue
+		}
+		var due <-chan time.Time
+		if wait > 0 {
+			timer.Reset(wait)
+			due = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-s.wake:
+		case <-due:
+		}
+	}
+}
+
+func (s *Scheduler) setRunning(running bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = running
+}
+
+// next returns the cep to refresh now, or how long to wait for the next one: 0 if
+// there are none.
+func (s *Scheduler) next() (cep string, wait time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.now()
+	if t.Before(s.pausedUntil) {
+		return "", s.pausedUntil.Sub(t)
+	}
+	if s.cfg.MaxCallsPerHour > 0 {
+		s.resetQuota(t)
+		if s.calls >= s.cfg.MaxCallsPerHour {
+			return "", s.windowStart.Add(quotaWindow).Sub(t)
+		}
+	}
+	var first *dto.WatchedCep
+	for _, e := range s.ceps {
+		if first == nil || e.NextRefresh.Before(first.NextRefresh) {
+			first = e
+		}
+	}
+	switch {
+	case first == nil:
+		return "", 0
+	case !first.NextRefresh.After(t):
+		return first.Cep, 0
+	default:
+		return "", first.NextRefresh.Sub(t)
+	}
+}
+
+// resetQuota starts a new window of the quota if the current one is over.
+func (s *Scheduler) resetQuota(t time.Time) {
+	if !t.Before(s.windowStart.Add(quotaWindow)) {
+		s.windowStart = t
+		s.calls = 0
+	}
+}
+
+// refreshCep refreshes cep and schedules its next refresh. The ceps of a city
+// refreshed less than half an Interval ago are not fetched again.
+func (s *Scheduler) refreshCep(ctx context.Context, cep string) {
+	fetched, status, err := s.refresh(ctx, cep, s.cfg.Interval/2)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.now()
+	if fetched {
+		s.calls++
+	}
+	e, ok := s.ceps[cep]
+	if !ok {
+		// removed while it was refreshed
+		return
+	}
+	lastRefresh := t.UTC()
+	e.LastRefresh = &lastRefresh
+	e.LastStatus = status
+	e.LastError = ""
+	e.Refreshes++
+	if fetched {
+		e.Fetches++
+	}
+	if err != nil {
+		e.LastError = err.Error()
+		e.Failures++
+	}
+	if status == http.StatusTooManyRequests {
+		// retried, with the others, after the pause
+		s.pausedUntil = t.Add(s.backoff)
+		s.backoff = min(2*s.backoff, s.cfg.Interval)
+		return
+	}
+	s.backoff = s.cfg.Backoff
+	e.NextRefresh = t.Add(s.cfg.Interval + time.Duration(s.cfg.Jitter*s.jitter()*float64(s.cfg.Interval))).UTC()
+}
@@ -0,0 +1,203 @@
+package watchlist
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/validation"
+)
+
+// fakeApi is a RefreshFunc recording the refreshed ceps, answering with status.
+type fakeApi struct {
+	mu        sync.Mutex
+	refreshed []string
+	status    int
+}
+
+func (f *fakeApi) refresh(ctx context.Context, cep string, maxAge time.Duration) (bool, int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.refreshed = append(f.refreshed, cep)
+	if f.status != http.StatusOK {
+		return true, f.status, errors.New(http.StatusText(f.status))
+	}
+	return true, f.status, nil
+}
+
+func (f *fakeApi) calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.refreshed...)
+}
+
+// newTestScheduler returns a Scheduler whose clock is *clock and whose jitter is 0.
+func newTestScheduler(cfg Config, api *fakeApi, clock *time.Time) *Scheduler {
+	s := New(cfg, api.refresh)
+	s.now = func() time.Time { return *clock }
+	s.jitter = func() float64 { return 0 }
+	return s
+}
+
+// runDue refreshes the ceps due at the clock, returning how long to wait for the next.
+func runDue(s *Scheduler) time.Duration {
+	for {
+		cep, wait := s.next()
+		if cep == "" {
+			return wait
+		}
+		s.refreshCep(context.Background(), cep)
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	clock := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	api := &fakeApi{status: http.StatusOK}
+	cfg := Config{Interval: 10 * time.Minute, Jitter: .1, MaxCeps: 2, Backoff: time.Minute}
+	s := newTestScheduler(cfg, api, &clock)
+
+	if wait := runDue(s); wait != 0 {
+		t.Errorf("empty watchlist waits %v, want 0", wait)
+	}
+	if _, added, err := s.Add("39408-078"); !added || err != nil {
+		t.Fatalf("Add() = %v, %v", added, err)
+	}
+	if _, added, err := s.Add("39408078"); added || err != nil {
+		t.Errorf("Add() of a watched cep = %v, %v, want not added", added, err)
+	}
+	s.Add("01001000")
+	if _, _, err := s.Add("20040002"); !errors.Is(err, validation.Violation{Field: "cep", Rule: validation.RuleRange}) {
+		t.Errorf("Add() to a full watchlist error = %v, want a range violation", err)
+	}
+	if _, _, err := s.Add("0100100"); !errors.Is(err, validation.Violation{Field: "cep", Rule: validation.RuleFormat}) {
+		t.Errorf("Add() of an invalid cep error = %v, want a format violation", err)
+	}
+
+	// the jitter of the first refresh is [0, 10%) of the interval, 5% here
+	clock = clock.Add(30 * time.Second)
+	if wait := runDue(s); wait != 10*time.Minute {
+		t.Errorf("next refresh in %v, want 10m", wait)
+	}
+	if got, want := api.calls(), []string{"01001000", "39408078"}; !reflect.DeepEqual(got, want) && !reflect.DeepEqual(got, []string{want[1], want[0]}) {
+		t.Errorf("refreshed %v, want %v", got, want)
+	}
+
+	status := s.Status()
+	if len(status.Ceps) != 2 || status.Ceps[0].Cep != "01001000" || status.Ceps[1].Refreshes != 1 || status.Ceps[1].Fetches != 1 ||
+		status.Ceps[1].LastStatus != http.StatusOK || !status.Ceps[1].NextRefresh.Equal(clock.Add(10*time.Minute)) {
+		t.Errorf("Status() = %+v", status)
+	}
+	if status.Quota != nil || status.PausedUntil != nil || status.Running {
+		t.Errorf("Status() = %+v, want no quota, no pause and not running", status)
+	}
+
+	if !s.Remove("01001-000") || s.Remove("01001000") {
+		t.Error("Remove() does not report whether the cep was watched")
+	}
+	clock = clock.Add(10 * time.Minute)
+	runDue(s)
+	if got := api.calls(); len(got) != 3 || got[2] != "39408078" {
+		t.Errorf("refreshed %v, want 39408078 again", got)
+	}
+}
+
+func TestSchedulerQuota(t *testing.T) {
+	clock := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	api := &fakeApi{status: http.StatusOK}
+	cfg := Config{Interval: time.Minute, MaxCallsPerHour: 3, MaxCeps: 10, Backoff: time.Minute}
+	s := newTestScheduler(cfg, api, &clock)
+	s.Add("39408078")
+	s.Add("01001000")
+
+	// 3 calls in the first minute, then wait for the next hour
+	runDue(s)
+	clock = clock.Add(time.Minute)
+	if wait := runDue(s); wait != 59*time.Minute {
+		t.Errorf("wait %v for the quota, want 59m", wait)
+	}
+	if got := len(api.calls()); got != 3 {
+		t.Errorf("%d calls, want the quota of 3", got)
+	}
+	if q := s.Status().Quota; q == nil || q.Used != 3 || q.Limit != 3 || !q.ResetsAt.Equal(clock.Add(59*time.Minute)) {
+		t.Errorf("Status().Quota = %+v", q)
+	}
+
+	clock = clock.Add(59 * time.Minute)
+	runDue(s)
+	if got := len(api.calls()); got != 5 {
+		t.Errorf("%d calls, want 5 after the quota reset", got)
+	}
+}
+
+func TestSchedulerThrottled(t *testing.T) {
+	clock := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	api := &fakeApi{status: http.StatusTooManyRequests}
+	cfg := Config{Interval: 10 * time.Minute, MaxCeps: 10, Backoff: 4 * time.Minute}
+	s := newTestScheduler(cfg, api, &clock)
+	s.Add("39408078")
+	s.Add("01001000")
+
+	// the backoff doubles up to the interval, and the ceps wait for it
+	for _, want := range []time.Duration{4 * time.Minute, 8 * time.Minute, 10 * time.Minute, 10 * time.Minute} {
+		if wait := runDue(s); wait != want {
+			t.Errorf("paused %v, want %v", wait, want)
+		}
+		if p := s.Status().PausedUntil; p == nil || !p.Equal(clock.Add(want)) {
+			t.Errorf("Status().PausedUntil = %v, want %v", p, clock.Add(want))
+		}
+		clock = clock.Add(want)
+	}
+	if got := len(api.calls()); got != 4 {
+		t.Errorf("%d calls, want one per pause", got)
+	}
+	failures := 0
+	for _, c := range s.Status().Ceps {
+		failures += c.Failures
+	}
+	if failures != 4 {
+		t.Errorf("%d failures, want 4", failures)
+	}
+
+	api.mu.Lock()
+	api.status = http.StatusOK
+	api.mu.Unlock()
+	if wait := runDue(s); wait != 10*time.Minute {
+		t.Errorf("wait %v after recovering, want the interval", wait)
+	}
+	if s.backoff != cfg.Backoff {
+		t.Errorf("backoff %v after recovering, want %v", s.backoff, cfg.Backoff)
+	}
+}
+
+func TestSchedulerRun(t *testing.T) {
+	api := &fakeApi{status: http.StatusOK}
+	s := New(Config{Interval: 20 * time.Millisecond, MaxCeps: 10, Backoff: time.Millisecond}, api.refresh)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	// the cep added while Run waits is refreshed right away, then every interval
+	s.Add("39408078")
+	deadline := time.Now().Add(5 * time.Second)
+	for len(api.calls()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !s.Status().Running {
+		t.Error("Status().Running = false while running")
+	}
+	cancel()
+	<-done
+	if got := len(api.calls()); got < 3 {
+		t.Errorf("%d refreshes, want at least 3", got)
+	}
+	if s.Status().Running {
+		t.Error("Status().Running = true after Run returned")
+	}
+}
@@ -1,20 +1,40 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"log/slog"
-	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/alert"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/api"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/dto"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/history"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/httpcache"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/secret"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/units"
 	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/usecase"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab1/src/internal/watchlist"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/apiversion"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/endpoint"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/openapi"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/render"
+	"github.com/antoniofmoliveira/go-expert-fullcycle-lab2/pkg/validation"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
@@ -23,7 +43,6 @@ import (
 	"google.golang.org/grpc/credentials/insecure"
 
 	"github.com/openzipkin/zipkin-go"
-	"github.com/openzipkin/zipkin-go/model"
 
 	zipkinhttp "github.com/openzipkin/zipkin-go/middleware/http"
 	httpreporter "github.com/openzipkin/zipkin-go/reporter/http"
@@ -32,6 +51,28 @@ import (
 var OtelTracer trace.Tracer
 var ZipkinClient *zipkinhttp.Client
 
+// APIKey is the key of the weather api, loaded once at startup.
+var APIKey secret.Secret
+
+// Watchlist refreshes the weather of the watched ceps in background.
+var Watchlist *watchlist.Scheduler
+
+// Alerts evaluates the alert rules on the observations of the weather.
+var Alerts *alert.Engine
+
+// maxAlertRuleBytes bounds the bodies of the alert rules.
+const maxAlertRuleBytes = 64 << 10
+
+// The api versions. v1, and the unversioned routes of the first releases, are
+// deprecated in favour of v2.
+var (
+	v1            = apiversion.Version{Name: "v1"}.Deprecate(apiDeprecated, apiSunset)
+	v2            = apiversion.Version{Name: "v2"}
+	unversioned   = v2.Deprecate(apiDeprecated, apiSunset)
+	apiDeprecated = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	apiSunset     = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+)
+
 func initOtel(ctx context.Context) {
 
 	res, err := resource.New(ctx,
@@ -67,6 +108,16 @@ func initOtel(ctx context.Context) {
 	otel.SetTextMapPropagator(propagation.TraceContext{})
 
 	OtelTracer = otel.Tracer("microservice-tracer")
+
+	metricExporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithGRPCConn(conn))
+	if err != nil {
+		slog.Error("Metric Exporter", "failed to create metric exporter: %w", err)
+	}
+	meterProvider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
+	)
+	otel.SetMeterProvider(meterProvider)
 }
 
 func main() {
@@ -81,7 +132,7 @@ func main() {
 
 	// init zipkin
 	reporter := httpreporter.NewReporter("http://zipkin-all-in-one:9411/api/v2/spans")
-	localEndpoint := &model.Endpoint{ServiceName: "servicob", IPv4: getOutboundIP(), Port: 8081}
+	localEndpoint := endpoint.Local("servicob", 8081)
 	sampler, err := zipkin.NewCountingSampler(1)
 	if err != nil {
 		log.Fatal(err)
@@ -96,23 +147,171 @@ func main() {
 	}
 	// end of initzipkin
 
-	ctx = context.Background()
-	ctx, span := OtelTracer.Start(ctx, "iniciando Servico B")
+	// ctx is done on the interrupt signal, which shuts the server down
+	_, span := OtelTracer.Start(context.Background(), "iniciando Servico B")
 	defer span.End()
 
-	ZipkinClient, err = zipkinhttp.NewClient(tracer, zipkinhttp.ClientTrace(true))
+	usecase.ValidationProfile, err = dto.ParseValidationProfile(os.Getenv("VALIDATION_PROFILE"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if v := os.Getenv("TEMP_DECIMALS"); v != "" {
+		units.DefaultDecimals, err = units.ParseDecimals(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if v := os.Getenv("WEATHER_STALE_WHILE_REVALIDATE"); v != "" {
+		usecase.StaleWhileRevalidate, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if v := os.Getenv("WEATHER_STALE_IF_ERROR"); v != "" {
+		usecase.StaleIfError, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if v := os.Getenv("ADDRESS_TTL"); v != "" {
+		usecase.AddressTTL, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if path := os.Getenv("HISTORY_DB"); path != "" {
+		retention := history.DefaultRetention
+		if v := os.Getenv("HISTORY_RETENTION"); v != "" {
+			retention, err = time.ParseDuration(v)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		repo, err := history.OpenSQLite(path, retention)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer repo.Close()
+		usecase.History = repo
+	}
+
+	watchlistConfig, err := watchlistConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	Watchlist = watchlist.New(watchlistConfig, refreshWatched)
+	if v := os.Getenv("WATCHLIST"); v != "" {
+		for _, cep := range strings.Split(v, ",") {
+			if _, _, err := Watchlist.Add(strings.TrimSpace(cep)); err != nil {
+				log.Fatalf("WATCHLIST: %v", err)
+			}
+		}
+	}
+
+	webhookConfig := alert.DefaultWebhookConfig()
+	if v := os.Getenv("ALERT_WEBHOOKS"); v != "" {
+		for _, webhook := range strings.Split(v, ",") {
+			webhookConfig.URLs = append(webhookConfig.URLs, strings.TrimSpace(webhook))
+		}
+	}
+	if v := os.Getenv("ALERT_WEBHOOK_ALLOWLIST"); v != "" {
+		for _, allowed := range strings.Split(v, ",") {
+			webhookConfig.Allowed = append(webhookConfig.Allowed, strings.TrimSpace(allowed))
+		}
+	}
+	webhookConfig.Secret, err = secret.Load("ALERT_WEBHOOK_SECRET")
+	if err != nil {
+		slog.Warn("alert notifications are not signed", "error", err)
+	}
+	notifier := alert.NewNotifier(webhookConfig)
+	defer notifier.Close()
+	APIKey, err = secret.Load("API_KEY")
+	if err != nil {
+		slog.Warn("weather api key", "error", err)
+	}
+	ZipkinClient, err = zipkinhttp.NewClient(tracer, zipkinhttp.ClientTrace(true),
+		zipkinhttp.TransportOptions(zipkinhttp.TransportErrHandler(secret.ZipkinErrHandler(APIKey))),
+	)
 	if err != nil {
 		log.Fatalf("unable to create client: %+v\n", err)
 	}
+	Alerts = alert.NewEngine(notifier, func(ctx context.Context, cep string) (dto.Cep, int, string, error) {
+		return usecase.GetAddress(ctx, cep, ZipkinClient)
+	})
+	usecase.OnObservation = Alerts.Observe
+
+	doc, err := openapi.Load(api.Spec)
+	if err != nil {
+		log.Fatalf("invalid openapi spec: %v", err)
+	}
+	validator, err := openapi.NewValidator(doc, func(w http.ResponseWriter, r *http.Request, status int, err error) {
+		writeError(w, r, status, http.StatusText(status), openapi.Violations(err).Err())
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	validator.ValidateResponses = os.Getenv("OPENAPI_VALIDATE_RESPONSES") == "true"
 
 	router := http.NewServeMux()
 	serverMiddleware := zipkinhttp.NewServerMiddleware(
 		tracer, zipkinhttp.TagResponseSize(true),
 	)
-	http.Handle("/", serverMiddleware(router))
-
-	router.HandleFunc("/", weatherHandler)
-	http.ListenAndServe(":8081", nil)
+	http.Handle("/", serverMiddleware(validator.Handler(router)))
+
+	// the watchlist stops on the interrupt signal; its refreshes record observations in
+	// the history, so it is waited for before the history store is closed
+	watching := make(chan struct{})
+	go func() {
+		defer close(watching)
+		Watchlist.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-watching
+	}()
+
+	router.HandleFunc("GET /v1/weather", v1.Handle("/v1/weather", "/v2/weather", weatherV1Handler))
+	router.HandleFunc("GET /v2/weather", v2.Handle("/v2/weather", "", weatherHandler))
+	router.HandleFunc("GET /v2/address", v2.Handle("/v2/address", "", addressHandler))
+	router.HandleFunc("GET /v2/search", v2.Handle("/v2/search", "", searchHandler))
+	router.HandleFunc("GET /v2/history", v2.Handle("/v2/history", "", historyHandler))
+	router.HandleFunc("GET /v2/watchlist", v2.Handle("/v2/watchlist", "", watchlistHandler))
+	router.HandleFunc("PUT /v2/watchlist/{cep}", v2.Handle("/v2/watchlist/{cep}", "", watchHandler))
+	router.HandleFunc("DELETE /v2/watchlist/{cep}", v2.Handle("/v2/watchlist/{cep}", "", unwatchHandler))
+	router.HandleFunc("GET /v2/alerts", v2.Handle("/v2/alerts", "", alertsHandler))
+	router.HandleFunc("POST /v2/alerts", v2.Handle("/v2/alerts", "", createAlertHandler))
+	router.HandleFunc("GET /v2/alerts/{id}", v2.Handle("/v2/alerts/{id}", "", alertHandler))
+	router.HandleFunc("PUT /v2/alerts/{id}", v2.Handle("/v2/alerts/{id}", "", updateAlertHandler))
+	router.HandleFunc("DELETE /v2/alerts/{id}", v2.Handle("/v2/alerts/{id}", "", deleteAlertHandler))
+	router.HandleFunc("GET /healthz", healthHandler)
+	router.HandleFunc("GET /openapi.json", openapi.SpecHandler(api.Spec))
+	router.HandleFunc("GET /docs", openapi.DocsHandler)
+	// unversioned routes of the first releases; the weather is served at / only, the
+	// other paths are not found
+	router.HandleFunc("GET /{$}", v1.Handle("/", "/v2/weather", weatherV1Handler))
+	router.HandleFunc("GET /address", unversioned.Handle("/address", "/v2/address", addressHandler))
+	router.HandleFunc("GET /search", unversioned.Handle("/search", "/v2/search", searchHandler))
+	router.HandleFunc("GET /history", unversioned.Handle("/history", "/v2/history", historyHandler))
+	router.HandleFunc("GET /watchlist", unversioned.Handle("/watchlist", "/v2/watchlist", watchlistHandler))
+	router.HandleFunc("PUT /watchlist/{cep}", unversioned.Handle("/watchlist/{cep}", "/v2/watchlist/{cep}", watchHandler))
+	router.HandleFunc("DELETE /watchlist/{cep}", unversioned.Handle("/watchlist/{cep}", "/v2/watchlist/{cep}", unwatchHandler))
+	router.HandleFunc("GET /alerts", unversioned.Handle("/alerts", "/v2/alerts", alertsHandler))
+	router.HandleFunc("POST /alerts", unversioned.Handle("/alerts", "/v2/alerts", createAlertHandler))
+	router.HandleFunc("GET /alerts/{id}", unversioned.Handle("/alerts/{id}", "/v2/alerts/{id}", alertHandler))
+	router.HandleFunc("PUT /alerts/{id}", unversioned.Handle("/alerts/{id}", "/v2/alerts/{id}", updateAlertHandler))
+	router.HandleFunc("DELETE /alerts/{id}", unversioned.Handle("/alerts/{id}", "/v2/alerts/{id}", deleteAlertHandler))
+	server := &http.Server{Addr: ":8081"}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("server stopped", "error", err)
+	}
 
 	slog.Info("Servico B")
 	select {
@@ -123,52 +322,389 @@ func main() {
 	}
 }
 
-func weatherHandler(w http.ResponseWriter, r *http.Request) {
+// startSpan extracts the propagated otel and zipkin contexts from r and starts
+// the otel span name.
+func startSpan(r *http.Request, name string) (context.Context, trace.Span) {
 	//otel
 	carrier := propagation.HeaderCarrier(r.Header)
 	ctx := r.Context()
 	ctx = otel.GetTextMapPropagator().Extract(ctx, carrier)
-	ctx, span := OtelTracer.Start(ctx, "servicob")
-	defer span.End()
+	ctx, span := OtelTracer.Start(ctx, name, trace.WithAttributes(apiversion.Attributes(r.Context())...))
 
 	//zipkin
 	zspan := zipkin.SpanFromContext(r.Context())
 	ctx = zipkin.NewContext(ctx, zspan)
 
+	return ctx, span
+}
+
+func weatherHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r, "servicob")
+	defer span.End()
+
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	cep := r.URL.Query().Get("cep")
-	temps, status, message, err := usecase.GetWeather(ctx, cep, ZipkinClient)
+	q := r.URL.Query()
+	var errs validation.Errors
+	system, err := units.ParseSystem(q.Get("units"))
+	if err != nil {
+		errs.Add("units", validation.RuleOneOf, q.Get("units"), err.Error())
+	}
+	decimals, err := units.ParseDecimals(q.Get("decimals"))
+	if err != nil {
+		errs.Add("decimals", validation.RuleRange, q.Get("decimals"), err.Error())
+	}
+	if err := errs.Err(); err != nil {
+		writeError(w, r, http.StatusUnprocessableEntity, "Unprocessable Entity", err)
+		return
+	}
+
+	temps, status, message, err := getWeather(ctx, r, q.Get("cep"))
 	if err != nil {
 		slog.Error(err.Error())
-		http.Error(w, message, status)
+		writeError(w, r, status, message, err)
 		return
 	}
+	temps = temps.Format(system, decimals)
 
 	// otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header)) // !
 
-	j, err := json.Marshal(temps)
+	setAge(w, temps)
+	writeCacheable(w, r, temps.ObservedAt, temps)
+}
+
+// weatherV1Handler serves the weather of the cep in the v1 model, rounded to the
+// default decimals.
+func weatherV1Handler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r, "servicob")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	temps, status, message, err := getWeather(ctx, r, r.URL.Query().Get("cep"))
 	if err != nil {
 		slog.Error(err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, status, message, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	setAge(w, temps)
+	writeCacheable(w, r, temps.ObservedAt, temps.Format(units.Metric, units.DefaultDecimals).V1())
+}
+
+// getWeather gets the weather of cep with usecase.GetWeather or, for the requests with
+// Cache-Control: only-if-cached, from the caches only with usecase.GetCachedWeather.
+func getWeather(ctx context.Context, r *http.Request, cep string) (dto.TempResponse, int, string, error) {
+	if httpcache.OnlyIfCached(r) {
+		return usecase.GetCachedWeather(ctx, cep)
+	}
+	return usecase.GetWeather(ctx, cep, ZipkinClient, APIKey)
+}
+
+// healthHandler answers the health probes of the servicoa load balancer: servicob is
+// up as long as it serves requests, whatever the state of ViaCEP and WeatherAPI.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(j))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(`{"status":"ok"}`))
 }
 
-// Get preferred outbound ip of this machine
-func getOutboundIP() net.IP {
-	conn, err := net.Dial("udp", "8.8.8.8:80")
+func addressHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r, "servicob address")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cep := r.URL.Query().Get("cep")
+	address, status, message, err := usecase.GetAddress(ctx, cep, ZipkinClient)
 	if err != nil {
-		log.Fatal(err)
+		slog.Error(err.Error())
+		writeError(w, r, status, message, err)
+		return
+	}
+
+	writeResponse(w, r, address)
+}
+
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r, "servicob search")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	q := r.URL.Query()
+	var errs validation.Errors
+	page, err := queryInt(q.Get("page"), 1)
+	if err != nil {
+		errs.Add("page", validation.RuleFormat, q.Get("page"), "page must be an integer")
+	}
+	pageSize, err := queryInt(q.Get("page_size"), usecase.DefaultPageSize)
+	if err != nil {
+		errs.Add("page_size", validation.RuleFormat, q.Get("page_size"), "page_size must be an integer")
+	}
+	if err := errs.Err(); err != nil {
+		writeError(w, r, http.StatusUnprocessableEntity, "Unprocessable Entity", err)
+		return
 	}
-	defer conn.Close()
 
-	localAddr := conn.LocalAddr().(*net.UDPAddr)
+	result, status, message, err := usecase.SearchCeps(ctx, q.Get("uf"), q.Get("city"), q.Get("street"), page, pageSize, ZipkinClient)
+	if err != nil {
+		slog.Error(err.Error())
+		writeError(w, r, status, message, err)
+		return
+	}
+
+	writeResponse(w, r, result)
+}
 
-	return localAddr.IP
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r, "servicob history")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	q := r.URL.Query()
+	result, status, message, err := usecase.GetHistory(ctx, q.Get("cep"), q.Get("from"), q.Get("to"), q.Get("interval"))
+	if err != nil {
+		slog.Error(err.Error())
+		writeError(w, r, status, message, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeResponse(w, r, result)
+}
+
+func watchlistHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeResponse(w, r, Watchlist.Status())
+}
+
+// watchHandler adds the cep of the path to the watchlist: 201 Created if it was not
+// watched yet.
+func watchHandler(w http.ResponseWriter, r *http.Request) {
+	watched, added, err := Watchlist.Add(r.PathValue("cep"))
+	if err != nil {
+		writeError(w, r, http.StatusUnprocessableEntity, "Unprocessable Entity", err)
+		return
+	}
+	status := http.StatusOK
+	if added {
+		status = http.StatusCreated
+	}
+	writeResponseStatus(w, r, status, watched)
+}
+
+func unwatchHandler(w http.ResponseWriter, r *http.Request) {
+	if !Watchlist.Remove(r.PathValue("cep")) {
+		writeError(w, r, http.StatusNotFound, "Not Found", errors.New("cep is not watched"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func alertsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeResponse(w, r, Alerts.List(r.URL.Query().Get("cep")))
+}
+
+func alertHandler(w http.ResponseWriter, r *http.Request) {
+	rule, err := Alerts.Get(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, "Not Found", err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeResponse(w, r, rule)
+}
+
+func createAlertHandler(w http.ResponseWriter, r *http.Request) {
+	var in dto.AlertRuleInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+	rule, err := Alerts.Create(r.Context(), in)
+	if err != nil {
+		writeAlertError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/v2/alerts/"+rule.ID)
+	writeResponseStatus(w, r, http.StatusCreated, rule)
+}
+
+func updateAlertHandler(w http.ResponseWriter, r *http.Request) {
+	var in dto.AlertRuleInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+	rule, err := Alerts.Update(r.Context(), r.PathValue("id"), in)
+	if errors.Is(err, alert.ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, "Not Found", err)
+		return
+	}
+	if err != nil {
+		writeAlertError(w, r, err)
+		return
+	}
+	writeResponse(w, r, rule)
+}
+
+// writeAlertError writes the error of the creation or of the update of an alert rule:
+// the status of the lookup of its cep when its city can not be located, 422 otherwise.
+func writeAlertError(w http.ResponseWriter, r *http.Request, err error) {
+	var lerr *alert.LocateError
+	if errors.As(err, &lerr) {
+		writeError(w, r, lerr.Status, lerr.Message, lerr.Err)
+		return
+	}
+	writeError(w, r, http.StatusUnprocessableEntity, "Unprocessable Entity", err)
+}
+
+func deleteAlertHandler(w http.ResponseWriter, r *http.Request) {
+	if err := Alerts.Delete(r.PathValue("id")); err != nil {
+		writeError(w, r, http.StatusNotFound, "Not Found", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeJSON decodes the json body of r, of at most maxAlertRuleBytes, into v. Unknown
+// fields are errors.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAlertRuleBytes))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// writeDecodeError writes the error of decodeJSON: 413 for the bodies over
+// maxAlertRuleBytes, 400 for the invalid ones.
+func writeDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, r, http.StatusRequestEntityTooLarge, "Request Entity Too Large", err)
+		return
+	}
+	writeError(w, r, http.StatusBadRequest, "Bad Request", err)
+}
+
+// refreshWatched refreshes the weather of a cep of the watchlist, in a trace of its own.
+func refreshWatched(ctx context.Context, cep string, maxAge time.Duration) (fetched bool, status int, err error) {
+	ctx, span := OtelTracer.Start(ctx, "watchlist refresh", trace.WithAttributes(attribute.String("cep", cep)))
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	fetched, status, _, err = usecase.RefreshWeather(ctx, cep, maxAge, ZipkinClient, APIKey)
+	if err != nil {
+		span.RecordError(err)
+		slog.Warn("watchlist refresh failed", "cep", cep, "status", status, "error", err)
+	}
+	return fetched, status, err
+}
+
+// watchlistConfigFromEnv returns watchlist.DefaultConfig overridden by WATCHLIST_INTERVAL,
+// WATCHLIST_JITTER, WATCHLIST_MAX_CALLS_PER_HOUR and WATCHLIST_MAX_CEPS.
+func watchlistConfigFromEnv() (watchlist.Config, error) {
+	cfg := watchlist.DefaultConfig()
+	var err error
+	if v := os.Getenv("WATCHLIST_INTERVAL"); v != "" {
+		if cfg.Interval, err = time.ParseDuration(v); err != nil || cfg.Interval <= 0 {
+			return cfg, fmt.Errorf("WATCHLIST_INTERVAL: invalid duration %q", v)
+		}
+	}
+	if v := os.Getenv("WATCHLIST_JITTER"); v != "" {
+		if cfg.Jitter, err = strconv.ParseFloat(v, 64); err != nil || cfg.Jitter < 0 || cfg.Jitter > 1 {
+			return cfg, fmt.Errorf("WATCHLIST_JITTER: %q is not a fraction between 0 and 1", v)
+		}
+	}
+	if v := os.Getenv("WATCHLIST_MAX_CALLS_PER_HOUR"); v != "" {
+		if cfg.MaxCallsPerHour, err = strconv.Atoi(v); err != nil || cfg.MaxCallsPerHour < 0 {
+			return cfg, fmt.Errorf("WATCHLIST_MAX_CALLS_PER_HOUR: invalid number %q", v)
+		}
+	}
+	if v := os.Getenv("WATCHLIST_MAX_CEPS"); v != "" {
+		if cfg.MaxCeps, err = strconv.Atoi(v); err != nil || cfg.MaxCeps < 0 {
+			return cfg, fmt.Errorf("WATCHLIST_MAX_CEPS: invalid number %q", v)
+		}
+	}
+	return cfg, nil
+}
+
+// writeCacheable writes the weather v observed at observedAt like writeResponse, with
+// the cache headers of the observation, or 304 Not Modified if the client already has it.
+func writeCacheable(w http.ResponseWriter, r *http.Request, observedAt time.Time, v any) {
+	if contentType, _, err := render.Negotiate(r.Header.Get("Accept"), v); err == nil {
+		if httpcache.Serve(w, r, observedAt, usecase.WeatherTTL, contentType) {
+			return
+		}
+	}
+	writeResponse(w, r, v)
+}
+
+// setAge sets the Age header of the stale weather responses: the seconds since the
+// weather was observed.
+func setAge(w http.ResponseWriter, temps dto.TempResponse) {
+	if temps.Stale && !temps.ObservedAt.IsZero() {
+		w.Header().Set("Age", strconv.Itoa(int(max(time.Since(temps.ObservedAt), 0).Seconds())))
+	}
+}
+
+// queryInt parses the query parameter value v, returning def if it is empty.
+func queryInt(v string, def int) (int, error) {
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
+
+// writeError writes a dto.ErrorResponse with status, message and the validation
+// violations found in err, in the media type negotiated from the Accept header.
+// If the client accepts none of them, the error is written as json anyway.
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string, err error) {
+	body := dto.NewErrorResponse(status, message, err)
+	w.Header().Set(dto.ErrorCodeHeader, body.Code)
+	werr := render.Write(w, r, status, body)
+	if errors.Is(werr, render.ErrNotAcceptable) {
+		var j bytes.Buffer
+		werr = render.JSON{}.Encode(&j, body)
+		if werr == nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.WriteHeader(status)
+			w.Write(j.Bytes())
+			return
+		}
+	}
+	if werr != nil {
+		slog.Error(werr.Error())
+		http.Error(w, message, status)
+	}
+}
+
+// writeResponse writes v with status 200, in the media type negotiated from the Accept
+// header, or a 406 error if v can not be written in any accepted media type.
+func writeResponse(w http.ResponseWriter, r *http.Request, v any) {
+	writeResponseStatus(w, r, http.StatusOK, v)
+}
+
+// writeResponseStatus is writeResponse with another status than 200.
+func writeResponseStatus(w http.ResponseWriter, r *http.Request, status int, v any) {
+	err := render.Write(w, r, status, v)
+	if errors.Is(err, render.ErrNotAcceptable) {
+		writeError(w, r, http.StatusNotAcceptable, "Not Acceptable",
+			errors.New("supported media types: "+strings.Join(render.MediaTypes(), ", ")))
+		return
+	}
+	if err != nil {
+		slog.Error(err.Error())
+		writeError(w, r, http.StatusInternalServerError, "Internal Server Error", err)
+	}
 }